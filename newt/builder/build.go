@@ -29,9 +29,11 @@ import (
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/dachalco/mynewt-newt/newt/event"
 	"github.com/dachalco/mynewt-newt/newt/interfaces"
 	"github.com/dachalco/mynewt-newt/newt/newtutil"
 	"github.com/dachalco/mynewt-newt/newt/pkg"
+	"github.com/dachalco/mynewt-newt/newt/profile"
 	"github.com/dachalco/mynewt-newt/newt/repo"
 	"github.com/dachalco/mynewt-newt/newt/resolve"
 	"github.com/dachalco/mynewt-newt/newt/symbol"
@@ -296,6 +298,10 @@ func (b *Builder) newCompiler(bpkg *BuildPackage,
 
 	c.AddInfo(b.compilerInfo)
 
+	if newtutil.NewtReproducible {
+		c.AddInfo(reproducibleCompilerInfo())
+	}
+
 	if bpkg != nil {
 		log.Debugf("Generating build flags for package %s",
 			bpkg.rpkg.Lpkg.FullName())
@@ -396,6 +402,16 @@ func (b *Builder) ExtractSymbolInfo() (error, *symbol.SymbolMap) {
 	return nil, syms
 }
 
+// appPkgName returns the full name of the builder's app package, or "" if
+// there is none.
+func (b *Builder) appPkgName() string {
+	if b.appPkg == nil {
+		return ""
+	}
+
+	return b.appPkg.rpkg.Lpkg.FullName()
+}
+
 func (b *Builder) link(elfName string, linkerScripts []string,
 	keepSymbols []string, extraADirs []string) error {
 
@@ -431,7 +447,16 @@ func (b *Builder) link(elfName string, linkerScripts []string,
 	}
 
 	c.LinkerScripts = linkerScripts
+
+	span := event.Start("link", event.Event{
+		Package: b.appPkgName(),
+		File:    elfName,
+	})
+	pspan := profile.Begin(profile.CAT_LINK, "link "+filepath.Base(elfName),
+		profile.TID_MAIN)
 	err = c.CompileElf(elfName, trimmedANames, keepSymbols, b.linkElf)
+	pspan.End()
+	span.Finish(err)
 	if err != nil {
 		return err
 	}
@@ -558,103 +583,76 @@ func (b *Builder) addUserPreBuildBpkg() (*BuildPackage, error) {
 		UserPreBuildDir(b.targetPkg.rpkg.Lpkg.FullName()))
 }
 
-// Runs build jobs while any remain.  On failure, signals the other workers to
-// stop via the stop channel.  On error, the error object is signaled via the
-// results channel.  On successful completion, nil is signaled via the results
-// channel.
-func buildWorker(
-	id int,
-	jobs <-chan toolchain.CompilerJob,
-	stop chan struct{},
-	results chan error) {
-
-	// Execute each job until failure or until a stop is signalled.
-	for {
-		select {
-		case s := <-stop:
-			// Re-enqueue the stop signal for the other routines.
-			stop <- s
-
-			// Terminate this go routine.
-			results <- nil
-			return
-
-		case j := <-jobs:
-			if err := toolchain.RunJob(j); err != nil {
-				// Stop the other routines.
-				stop <- struct{}{}
-
-				// Report the error back to the master thread and terminate.
-				results <- err
-				return
-			}
-
-		default:
-			// Terminate this go routine.
-			results <- nil
-			return
-		}
-	}
-}
-
-func (b *Builder) Build() error {
-	b.CleanArtifacts()
-
-	// Build the packages alphabetically to ensure a consistent order.
-	bpkgs := b.sortedBuildPackages()
+// buildJobGraph creates the set of jobs needed to build the specified
+// packages.  Each source file gets its own compile job.  Each package with
+// source files also gets an archive job which depends only on that package's
+// compile jobs, so a package is archived as soon as its own objects are
+// ready.
+//
+// @return                      The job graph, and a map of each package to
+//                                  the compiler used to build it.
+func (b *Builder) buildJobGraph(bpkgs []*BuildPackage) (
+	*jobGraph, map[*BuildPackage]*toolchain.Compiler, error) {
 
-	// Calculate the list of jobs.  Each record represents a single file that
-	// needs to be compiled.
-	entries := []toolchain.CompilerJob{}
+	g := &jobGraph{}
 	bpkgCompilerMap := map[*BuildPackage]*toolchain.Compiler{}
+
 	for _, bpkg := range bpkgs {
-		subEntries, err := b.collectCompileEntriesBpkg(bpkg)
+		entries, err := b.collectCompileEntriesBpkg(bpkg)
 		if err != nil {
-			return err
+			return nil, nil, err
+		}
+		if len(entries) == 0 {
+			continue
 		}
-		entries = append(entries, subEntries...)
 
-		if len(subEntries) > 0 {
-			bpkgCompilerMap[bpkg] = subEntries[0].Compiler
+		c := entries[0].Compiler
+		bpkgCompilerMap[bpkg] = c
+
+		bpkg := bpkg
+		arJob := g.add(BUILD_JOB_ARCHIVE,
+			"archive "+bpkg.rpkg.Lpkg.FullName(), bpkg,
+			func() error {
+				return b.createArchive(c, bpkg)
+			})
+
+		for _, entry := range entries {
+			entry := entry
+			job := g.add(BUILD_JOB_COMPILE, "compile "+entry.Filename, bpkg,
+				func() error {
+					return toolchain.RunJob(entry)
+				})
+			job.File = entry.Filename
+			g.addDep(arJob, job)
 		}
 	}
 
-	// Build each file in parallel.
-	jobs := make(chan toolchain.CompilerJob, len(entries))
-	defer close(jobs)
-
-	stop := make(chan struct{}, newtutil.NewtNumJobs)
-	defer close(stop)
-
-	errors := make(chan error, newtutil.NewtNumJobs)
-	defer close(errors)
+	return g, bpkgCompilerMap, nil
+}
 
-	for _, entry := range entries {
-		jobs <- entry
-	}
+func (b *Builder) Build() error {
+	b.CleanArtifacts()
 
-	for i := 0; i < newtutil.NewtNumJobs; i++ {
-		go buildWorker(i, jobs, stop, errors)
-	}
+	// Build the packages alphabetically to ensure a consistent order.
+	bpkgs := b.sortedBuildPackages()
 
-	var err error
-	for i := 0; i < newtutil.NewtNumJobs; i++ {
-		subErr := <-errors
-		if err == nil && subErr != nil {
-			err = subErr
-		}
-	}
+	// Calculate the graph of jobs.  Each compile job represents a single file
+	// that needs to be compiled.
+	g, bpkgCompilerMap, err := b.buildJobGraph(bpkgs)
 	if err != nil {
 		return err
 	}
 
-	for _, bpkg := range bpkgs {
-		c := bpkgCompilerMap[bpkg]
-		if c != nil {
-			if err := b.createArchive(c, bpkg); err != nil {
-				return err
-			}
-		}
+	// Compile and archive in parallel.  In keep-going mode, a failed package
+	// only prevents its own archive from being created; the link step is
+	// skipped by the caller.
+	g.keepGoing = newtutil.NewtKeepGoing
+	if err := g.run(newtutil.NewtNumJobs); err != nil {
+		return err
+	}
+	if profile.Enabled() {
+		g.recordCriticalPath(b.targetBuilder.target.FullName() + "/" +
+			b.buildName)
 	}
 
 	var compileCommands []toolchain.CompileCommand
@@ -0,0 +1,524 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dachalco/mynewt-newt/newt/parse"
+	"github.com/dachalco/mynewt-newt/newt/pkg"
+	"github.com/dachalco/mynewt-newt/newt/resolve"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+const (
+	DEPGRAPH_FORMAT_TEXT    = "text"
+	DEPGRAPH_FORMAT_DOT     = "dot"
+	DEPGRAPH_FORMAT_MERMAID = "mermaid"
+	DEPGRAPH_FORMAT_JSON    = "json"
+)
+
+var DepGraphFormats = []string{
+	DEPGRAPH_FORMAT_TEXT,
+	DEPGRAPH_FORMAT_DOT,
+	DEPGRAPH_FORMAT_MERMAID,
+	DEPGRAPH_FORMAT_JSON,
+}
+
+const (
+	DEPGRAPH_COLLAPSE_NONE = "none"
+	DEPGRAPH_COLLAPSE_REPO = "repo"
+	DEPGRAPH_COLLAPSE_DIR  = "dir"
+)
+
+var DepGraphCollapses = []string{
+	DEPGRAPH_COLLAPSE_NONE,
+	DEPGRAPH_COLLAPSE_REPO,
+	DEPGRAPH_COLLAPSE_DIR,
+}
+
+// The type of a node that contains packages of different types.
+const depGraphTypeMixed = "mixed"
+
+// Package types (e.g., "lib", "bsp"), keyed by full package name.
+type DepGraphPkgTypes map[string]string
+
+func depGraphPkgTypes(rs *resolve.ResolveSet) DepGraphPkgTypes {
+	types := DepGraphPkgTypes{}
+	for _, rpkg := range rs.Rpkgs {
+		types[rpkg.Lpkg.FullName()] =
+			pkg.PackageTypeNames[rpkg.Lpkg.Type()]
+	}
+
+	return types
+}
+
+// depGraphRepoGroup returns the name of the repo containing the specified
+// package (e.g., "@apache-mynewt-core").  Packages in the project's own repo
+// have no repo prefix; they are grouped under "@local".
+func depGraphRepoGroup(pkgName string) string {
+	if strings.HasPrefix(pkgName, "@") {
+		return strings.SplitN(pkgName, "/", 2)[0]
+	}
+
+	return "@local"
+}
+
+// depGraphDirGroup truncates a package name to its first `depth` directories
+// (not counting the repo prefix).
+func depGraphDirGroup(pkgName string, depth int) string {
+	repo := ""
+	path := pkgName
+	if strings.HasPrefix(pkgName, "@") {
+		parts := strings.SplitN(pkgName, "/", 2)
+		repo = parts[0] + "/"
+		if len(parts) > 1 {
+			path = parts[1]
+		} else {
+			path = ""
+		}
+	}
+
+	dirs := strings.Split(path, "/")
+	if len(dirs) > depth {
+		dirs = dirs[:depth]
+	}
+
+	return repo + strings.Join(dirs, "/")
+}
+
+func mergeExprMap(dst parse.ExprMap, src parse.ExprMap) parse.ExprMap {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = parse.ExprMap{}
+	}
+	for key, es := range src {
+		if dst[key] == nil {
+			dst[key] = parse.ExprSet{}
+		}
+		for k, v := range es {
+			dst[key][k] = v
+		}
+	}
+
+	return dst
+}
+
+// CollapseDepGraph merges packages into a single node per repo
+// (DEPGRAPH_COLLAPSE_REPO) or per directory prefix of the specified depth
+// (DEPGRAPH_COLLAPSE_DIR).  The expressions and APIs of merged edges are
+// combined; edges within a group are dropped.  The returned type map
+// describes the collapsed nodes.
+func CollapseDepGraph(graph DepGraph, types DepGraphPkgTypes,
+	collapse string, depth int) (DepGraph, DepGraphPkgTypes, error) {
+
+	var group func(name string) string
+
+	switch collapse {
+	case DEPGRAPH_COLLAPSE_NONE, "":
+		return graph, types, nil
+
+	case DEPGRAPH_COLLAPSE_REPO:
+		group = depGraphRepoGroup
+
+	case DEPGRAPH_COLLAPSE_DIR:
+		if depth < 1 {
+			return nil, nil, util.FmtNewtError(
+				"Invalid collapse depth %d; must be at least 1", depth)
+		}
+		group = func(name string) string {
+			return depGraphDirGroup(name, depth)
+		}
+
+	default:
+		return nil, nil, util.FmtNewtError(
+			"Invalid collapse mode \"%s\"; must be one of: %s",
+			collapse, strings.Join(DepGraphCollapses, ", "))
+	}
+
+	newTypes := DepGraphPkgTypes{}
+	addType := func(name string) {
+		g := group(name)
+		t := types[name]
+		if old, ok := newTypes[g]; ok && old != t {
+			t = depGraphTypeMixed
+		}
+		newTypes[g] = t
+	}
+
+	// [parent-group][child-group]
+	entries := map[string]map[string]*DepEntry{}
+
+	for parent, children := range graph {
+		pg := group(parent)
+		addType(parent)
+		if entries[pg] == nil {
+			entries[pg] = map[string]*DepEntry{}
+		}
+
+		for _, child := range children {
+			addType(child.PkgName)
+
+			cg := group(child.PkgName)
+			if cg == pg {
+				continue
+			}
+
+			e := entries[pg][cg]
+			if e == nil {
+				e = &DepEntry{PkgName: cg}
+				entries[pg][cg] = e
+			}
+
+			if len(child.DepExprs) > 0 {
+				if e.DepExprs == nil {
+					e.DepExprs = parse.ExprSet{}
+				}
+				for k, v := range child.DepExprs {
+					e.DepExprs[k] = v
+				}
+			}
+			e.ReqApiExprs = mergeExprMap(e.ReqApiExprs, child.ReqApiExprs)
+			e.ApiExprs = mergeExprMap(e.ApiExprs, child.ApiExprs)
+		}
+	}
+
+	newGraph := DepGraph{}
+	for pg, m := range entries {
+		newGraph[pg] = make([]DepEntry, 0, len(m))
+		for _, e := range m {
+			newGraph[pg] = append(newGraph[pg], *e)
+		}
+		SortDepEntries(newGraph[pg])
+	}
+
+	return newGraph, newTypes, nil
+}
+
+type depGraphEdge struct {
+	depender string
+	dependee string
+	entry    DepEntry
+}
+
+// depGraphNodesEdges flattens a graph into a sorted list of nodes and edges.
+// Edges always point from depender to dependee, regardless of the direction
+// of the graph.
+func depGraphNodesEdges(graph DepGraph, reverse bool) (
+	[]string, []depGraphEdge) {
+
+	nodeMap := map[string]struct{}{}
+	var edges []depGraphEdge
+
+	for parent, children := range graph {
+		nodeMap[parent] = struct{}{}
+		for _, child := range children {
+			nodeMap[child.PkgName] = struct{}{}
+
+			e := depGraphEdge{
+				depender: parent,
+				dependee: child.PkgName,
+				entry:    child,
+			}
+			if reverse {
+				e.depender, e.dependee = e.dependee, e.depender
+			}
+			edges = append(edges, e)
+		}
+	}
+
+	nodes := make([]string, 0, len(nodeMap))
+	for name, _ := range nodeMap {
+		nodes = append(nodes, name)
+	}
+	sort.Strings(nodes)
+
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].depender != edges[j].depender {
+			return edges[i].depender < edges[j].depender
+		}
+		return edges[i].dependee < edges[j].dependee
+	})
+
+	return nodes, edges
+}
+
+type depGraphApi struct {
+	Name   string `json:"name"`
+	Syscfg string `json:"syscfg,omitempty"`
+}
+
+// depEdgeApis lists the APIs that created a dependency, along with the
+// syscfg expressions that enable each API requirement.
+func depEdgeApis(entry DepEntry) []depGraphApi {
+	apis := make([]depGraphApi, 0, len(entry.ReqApiExprs))
+	for api, es := range entry.ReqApiExprs {
+		apis = append(apis, depGraphApi{
+			Name:   api,
+			Syscfg: es.Disjunction().String(),
+		})
+	}
+	sort.Slice(apis, func(i, j int) bool {
+		return apis[i].Name < apis[j].Name
+	})
+
+	return apis
+}
+
+// depEdgeExpr returns the expression that enables a hard dependency.  It is
+// empty if the dependency is unconditional; an unconditional dependency
+// outweighs any conditional ones merged with it.
+func depEdgeExpr(entry DepEntry) string {
+	if _, ok := entry.DepExprs[""]; ok {
+		return ""
+	}
+
+	return entry.DepExprs.Disjunction().String()
+}
+
+// depEdgeLabels produces a label for each reason a dependency exists: its
+// enabling syscfg expression and each API it satisfies.
+func depEdgeLabels(entry DepEntry) []string {
+	var labels []string
+
+	if dis := depEdgeExpr(entry); dis != "" {
+		labels = append(labels, dis)
+	}
+
+	for _, api := range depEdgeApis(entry) {
+		s := "api:" + api.Name
+		if api.Syscfg != "" {
+			s += " [" + api.Syscfg + "]"
+		}
+		labels = append(labels, s)
+	}
+
+	return labels
+}
+
+// Graphviz node attributes for each package type.
+var depGraphDotStyles = map[string]string{
+	"target":          "shape=folder, style=filled, fillcolor=lightgray",
+	"app":             "shape=box, style=filled, fillcolor=lightblue",
+	"unittest":        "shape=box, style=filled, fillcolor=lightyellow",
+	"bsp":             "shape=box3d, style=filled, fillcolor=orange",
+	"compiler":        "shape=component, style=filled, fillcolor=gray",
+	"sdk":             "shape=box, style=filled, fillcolor=palegreen",
+	"transient":       "shape=box, style=dashed",
+	depGraphTypeMixed: "shape=tab",
+}
+
+func depGraphDot(graph DepGraph, types DepGraphPkgTypes,
+	reverse bool) string {
+
+	nodes, edges := depGraphNodesEdges(graph, reverse)
+
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "digraph deps {\n")
+	fmt.Fprintf(&buf, "    rankdir=LR;\n")
+	fmt.Fprintf(&buf, "    node [shape=box];\n")
+
+	for _, name := range nodes {
+		if style := depGraphDotStyles[types[name]]; style != "" {
+			fmt.Fprintf(&buf, "    %q [%s];\n", name, style)
+		} else {
+			fmt.Fprintf(&buf, "    %q;\n", name)
+		}
+	}
+
+	for _, e := range edges {
+		labels := depEdgeLabels(e.entry)
+		if len(labels) > 0 {
+			fmt.Fprintf(&buf, "    %q -> %q [label=%q];\n",
+				e.depender, e.dependee, strings.Join(labels, "\n"))
+		} else {
+			fmt.Fprintf(&buf, "    %q -> %q;\n", e.depender, e.dependee)
+		}
+	}
+
+	fmt.Fprintf(&buf, "}\n")
+
+	return buf.String()
+}
+
+// Mermaid class definitions for each package type.
+var depGraphMermaidStyles = map[string]string{
+	"target":          "fill:#ddd,stroke:#333",
+	"app":             "fill:#add8e6,stroke:#333",
+	"unittest":        "fill:#ffffe0,stroke:#333",
+	"bsp":             "fill:#ffa500,stroke:#333",
+	"compiler":        "fill:#aaa,stroke:#333",
+	"sdk":             "fill:#98fb98,stroke:#333",
+	"transient":       "fill:#fff,stroke:#333,stroke-dasharray:4",
+	depGraphTypeMixed: "fill:#fff,stroke:#333,stroke-width:2px",
+}
+
+// mermaidEscape makes a string safe for use in a quoted Mermaid label.
+func mermaidEscape(s string) string {
+	s = strings.ReplaceAll(s, "\"", "#quot;")
+	s = strings.ReplaceAll(s, "|", "#124;")
+	return s
+}
+
+func depGraphMermaid(graph DepGraph, types DepGraphPkgTypes,
+	reverse bool) string {
+
+	nodes, edges := depGraphNodesEdges(graph, reverse)
+
+	// Package names aren't valid Mermaid identifiers; assign each node an ID.
+	ids := make(map[string]string, len(nodes))
+	for i, name := range nodes {
+		ids[name] = fmt.Sprintf("n%d", i)
+	}
+
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "graph LR\n")
+
+	for _, name := range nodes {
+		fmt.Fprintf(&buf, "    %s[\"%s\"]\n", ids[name], mermaidEscape(name))
+	}
+
+	for _, e := range edges {
+		labels := depEdgeLabels(e.entry)
+		if len(labels) > 0 {
+			fmt.Fprintf(&buf, "    %s -->|\"%s\"| %s\n",
+				ids[e.depender], mermaidEscape(strings.Join(labels, "<br>")),
+				ids[e.dependee])
+		} else {
+			fmt.Fprintf(&buf, "    %s --> %s\n",
+				ids[e.depender], ids[e.dependee])
+		}
+	}
+
+	// Style each node according to its package type.
+	classes := map[string][]string{}
+	for _, name := range nodes {
+		t := types[name]
+		if depGraphMermaidStyles[t] != "" {
+			classes[t] = append(classes[t], ids[name])
+		}
+	}
+
+	classNames := make([]string, 0, len(classes))
+	for t, _ := range classes {
+		classNames = append(classNames, t)
+	}
+	sort.Strings(classNames)
+
+	for _, t := range classNames {
+		fmt.Fprintf(&buf, "    classDef %s %s\n", t, depGraphMermaidStyles[t])
+		fmt.Fprintf(&buf, "    class %s %s\n",
+			strings.Join(classes[t], ","), t)
+	}
+
+	return buf.String()
+}
+
+type depGraphJSONPkg struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+}
+
+type depGraphJSONEdge struct {
+	Depender string        `json:"depender"`
+	Dependee string        `json:"dependee"`
+	Syscfg   string        `json:"syscfg,omitempty"`
+	Apis     []depGraphApi `json:"apis,omitempty"`
+}
+
+type depGraphJSON struct {
+	Pkgs  []depGraphJSONPkg  `json:"packages"`
+	Edges []depGraphJSONEdge `json:"edges"`
+}
+
+func depGraphJSONString(graph DepGraph, types DepGraphPkgTypes,
+	reverse bool) (string, error) {
+
+	nodes, edges := depGraphNodesEdges(graph, reverse)
+
+	dj := depGraphJSON{
+		Pkgs:  make([]depGraphJSONPkg, 0, len(nodes)),
+		Edges: make([]depGraphJSONEdge, 0, len(edges)),
+	}
+
+	for _, name := range nodes {
+		dj.Pkgs = append(dj.Pkgs, depGraphJSONPkg{
+			Name: name,
+			Type: types[name],
+		})
+	}
+
+	for _, e := range edges {
+		je := depGraphJSONEdge{
+			Depender: e.depender,
+			Dependee: e.dependee,
+			Syscfg:   depEdgeExpr(e.entry),
+		}
+		if apis := depEdgeApis(e.entry); len(apis) > 0 {
+			je.Apis = apis
+		}
+		dj.Edges = append(dj.Edges, je)
+	}
+
+	b, err := json.MarshalIndent(dj, "", "  ")
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	return string(b) + "\n", nil
+}
+
+// RenderDepGraph produces a dependency graph in the specified format.  If
+// `reverse` is true, the graph is a reverse dependency graph (see
+// `revdepGraph()`).  Graph formats other than text draw every edge from
+// depender to dependee, labelled with the syscfg expressions and APIs that
+// created it.
+func RenderDepGraph(graph DepGraph, types DepGraphPkgTypes, format string,
+	reverse bool) (string, error) {
+
+	switch format {
+	case DEPGRAPH_FORMAT_TEXT:
+		if reverse {
+			return RevdepGraphText(graph) + "\n", nil
+		} else {
+			return DepGraphText(graph) + "\n", nil
+		}
+
+	case DEPGRAPH_FORMAT_DOT:
+		return depGraphDot(graph, types, reverse), nil
+
+	case DEPGRAPH_FORMAT_MERMAID:
+		return depGraphMermaid(graph, types, reverse), nil
+
+	case DEPGRAPH_FORMAT_JSON:
+		return depGraphJSONString(graph, types, reverse)
+
+	default:
+		return "", util.FmtNewtError(
+			"Invalid graph format \"%s\"; must be one of: %s",
+			format, strings.Join(DepGraphFormats, ", "))
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"os"
 	"os/exec"
 
+	"github.com/dachalco/mynewt-newt/newt/event"
 	"github.com/dachalco/mynewt-newt/newt/stage"
 	"github.com/dachalco/mynewt-newt/util"
 	"github.com/kballard/go-shellquote"
@@ -138,8 +139,25 @@ func (t *TargetBuilder) envVarsForCmd(sf stage.StageFunc, userSrcDir string,
 	return env, nil
 }
 
-// execExtCmds executes a set of user scripts.
-func (t *TargetBuilder) execExtCmds(sf stage.StageFunc, userSrcDir string,
+// execExtCmds executes a user script and reports it to the build event
+// stream.
+func (t *TargetBuilder) execExtCmds(stageName string, sf stage.StageFunc,
+	userSrcDir string, userIncDir string, workDir string) error {
+
+	span := event.Start("extcmd", event.Event{
+		Package: sf.Pkg.FullName(),
+		Data: map[string]interface{}{
+			"stage":   stageName,
+			"command": sf.Name,
+		},
+	})
+	err := t.execExtCmdsAux(sf, userSrcDir, userIncDir, workDir)
+	span.Finish(err)
+
+	return err
+}
+
+func (t *TargetBuilder) execExtCmdsAux(sf stage.StageFunc, userSrcDir string,
 	userIncDir string, workDir string) error {
 
 	env, err := t.envVarsForCmd(sf, userSrcDir, userIncDir, workDir)
@@ -196,7 +214,9 @@ func (t *TargetBuilder) execPreBuildCmds(workDir string) error {
 	}()
 
 	for _, sf := range t.res.PreBuildCmdCfg.StageFuncs {
-		if err := t.execExtCmds(sf, tmpSrcDir, tmpIncDir, workDir); err != nil {
+		if err := t.execExtCmds("pre_build", sf, tmpSrcDir, tmpIncDir,
+			workDir); err != nil {
+
 			return err
 		}
 	}
@@ -228,7 +248,9 @@ func (t *TargetBuilder) execPreLinkCmds(workDir string) error {
 	}()
 
 	for _, sf := range t.res.PreLinkCmdCfg.StageFuncs {
-		if err := t.execExtCmds(sf, tmpSrcDir, "", workDir); err != nil {
+		if err := t.execExtCmds("pre_link", sf, tmpSrcDir, "",
+			workDir); err != nil {
+
 			return err
 		}
 	}
@@ -246,7 +268,9 @@ func (t *TargetBuilder) execPreLinkCmds(workDir string) error {
 // an error if any command fails (exits with a nonzero status).
 func (t *TargetBuilder) execPostLinkCmds(workDir string) error {
 	for _, sf := range t.res.PostLinkCmdCfg.StageFuncs {
-		if err := t.execExtCmds(sf, "", "", workDir); err != nil {
+		if err := t.execExtCmds("post_link", sf, "", "",
+			workDir); err != nil {
+
 			return err
 		}
 	}
@@ -0,0 +1,418 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/dachalco/mynewt-newt/newt/event"
+	"github.com/dachalco/mynewt-newt/newt/interfaces"
+	"github.com/dachalco/mynewt-newt/newt/profile"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// A buildJob is a single node in the build's job graph (e.g., compile one
+// source file, archive one package).  A job becomes runnable once all of the
+// jobs it depends on have completed successfully.
+type buildJob struct {
+	Kind string
+	Name string
+	Bpkg *BuildPackage
+	Run  func() error
+
+	// For compile jobs, the source file being compiled.
+	File string
+
+	// Jobs that cannot start until this one completes.
+	dependents []*buildJob
+
+	// Number of prerequisite jobs that have not completed yet.
+	pending int
+
+	// Prerequisite jobs; only used for critical path analysis.
+	prereqs []*buildJob
+
+	// How long the job took to run.
+	dur time.Duration
+}
+
+type buildJobResult struct {
+	job     *buildJob
+	err     error
+	skipped bool
+}
+
+type buildJobFailure struct {
+	Job *buildJob
+	Err error
+}
+
+// jobGraph is a set of build jobs and the dependencies among them.
+type jobGraph struct {
+	jobs []*buildJob
+
+	// If true, a failed job only prevents its own dependents from running;
+	// all other jobs still execute.
+	keepGoing bool
+
+	// Populated with each failed job after run() returns.
+	failures []buildJobFailure
+
+	// Populated with each job that did not run because one of its
+	// prerequisites failed (keep-going mode only).
+	blocked []*buildJob
+}
+
+const (
+	BUILD_JOB_COMPILE = "compile"
+	BUILD_JOB_ARCHIVE = "archive"
+)
+
+func (g *jobGraph) add(kind string, name string, bpkg *BuildPackage,
+	run func() error) *buildJob {
+
+	job := &buildJob{
+		Kind: kind,
+		Name: name,
+		Bpkg: bpkg,
+		Run:  run,
+	}
+	g.jobs = append(g.jobs, job)
+
+	return job
+}
+
+// addDep indicates that `job` cannot start until `prereq` has completed.
+func (g *jobGraph) addDep(job *buildJob, prereq *buildJob) {
+	prereq.dependents = append(prereq.dependents, job)
+	job.prereqs = append(job.prereqs, prereq)
+	job.pending++
+}
+
+// Runs build jobs until the job channel is closed.  If the stop flag is set
+// when a job is dequeued, the job is skipped rather than executed.  Worker IDs
+// start at 1 and identify the worker in the build profile.
+func jobWorker(id int, jobs <-chan *buildJob, stop *int32,
+	results chan<- buildJobResult) {
+
+	for j := range jobs {
+		if atomic.LoadInt32(stop) != 0 {
+			results <- buildJobResult{job: j, skipped: true}
+			continue
+		}
+
+		log.Debugf("Running build job: %s", j.Name)
+		results <- buildJobResult{job: j, err: j.exec(id)}
+	}
+}
+
+// exec runs the job, reporting its start and completion to the build event
+// stream and the build profile.
+func (j *buildJob) exec(workerId int) error {
+	ev := event.Event{
+		Package: jobPkgName(j),
+	}
+	if j.File != "" {
+		ev.File = strings.TrimPrefix(j.File,
+			interfaces.GetProject().Path()+"/")
+	}
+
+	name := j.Name
+	if ev.File != "" {
+		name = filepath.Base(ev.File)
+	}
+	pspan := profile.Begin(j.Kind, name, workerId)
+	pspan.SetArg("package", ev.Package)
+	if ev.File != "" {
+		pspan.SetArg("file", ev.File)
+	}
+
+	span := event.Start(j.Kind, ev)
+	start := time.Now()
+	err := j.Run()
+	j.dur = time.Since(start)
+	span.Finish(err)
+	pspan.End()
+
+	return err
+}
+
+// block marks all transitive dependents of a failed job as blocked.
+func (g *jobGraph) block(job *buildJob, seen map[*buildJob]struct{}) {
+	for _, d := range job.dependents {
+		if _, ok := seen[d]; ok {
+			continue
+		}
+		seen[d] = struct{}{}
+
+		g.blocked = append(g.blocked, d)
+		g.block(d, seen)
+	}
+}
+
+// run executes every job in the graph using the specified number of workers.
+// Each job is dispatched as soon as its prerequisites have completed.  On
+// the first failure, jobs that have not started yet are cancelled; jobs that
+// are already running are allowed to finish.  Every failure is reported.
+//
+// In keep-going mode, a failure only cancels the failed job's dependents.
+func (g *jobGraph) run(numWorkers int) error {
+	if len(g.jobs) == 0 {
+		return nil
+	}
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+
+	ready := make(chan *buildJob, len(g.jobs))
+	results := make(chan buildJobResult, len(g.jobs))
+	var stop int32
+
+	inFlight := 0
+	for _, j := range g.jobs {
+		if j.pending == 0 {
+			ready <- j
+			inFlight++
+		}
+	}
+	if inFlight == 0 {
+		close(ready)
+		return util.NewNewtError("Build job graph contains a cycle")
+	}
+
+	for i := 0; i < numWorkers; i++ {
+		go jobWorker(i+1, ready, &stop, results)
+	}
+
+	errs := []error{}
+	completed := 0
+	blockedSet := map[*buildJob]struct{}{}
+	for inFlight > 0 {
+		r := <-results
+		inFlight--
+
+		if r.skipped {
+			continue
+		}
+		if r.err != nil {
+			errs = append(errs, r.err)
+			g.failures = append(g.failures, buildJobFailure{r.job, r.err})
+			if g.keepGoing {
+				g.block(r.job, blockedSet)
+			} else {
+				atomic.StoreInt32(&stop, 1)
+			}
+			continue
+		}
+
+		completed++
+		if atomic.LoadInt32(&stop) != 0 {
+			continue
+		}
+
+		for _, d := range r.job.dependents {
+			d.pending--
+			if d.pending == 0 {
+				ready <- d
+				inFlight++
+			}
+		}
+	}
+	close(ready)
+
+	if len(errs) > 0 {
+		if g.keepGoing {
+			return util.NewNewtError(g.failureSummary())
+		}
+		return combineJobErrors(errs)
+	}
+
+	if completed != len(g.jobs) {
+		return util.FmtNewtError(
+			"Build job graph contains a cycle; %d of %d jobs completed",
+			completed, len(g.jobs))
+	}
+
+	return nil
+}
+
+// criticalPath calculates the longest chain of dependent jobs in the graph,
+// weighted by the time each job took to run.  This must only be called after
+// the graph has run successfully.
+func (g *jobGraph) criticalPath() []*buildJob {
+	// Total duration of the longest chain ending at each job, and the previous
+	// job in that chain.
+	totals := map[*buildJob]time.Duration{}
+	prev := map[*buildJob]*buildJob{}
+
+	var visit func(j *buildJob) time.Duration
+	visit = func(j *buildJob) time.Duration {
+		if total, ok := totals[j]; ok {
+			return total
+		}
+
+		var best time.Duration
+		for _, p := range j.prereqs {
+			if total := visit(p); prev[j] == nil || total > best {
+				best = total
+				prev[j] = p
+			}
+		}
+
+		totals[j] = best + j.dur
+		return totals[j]
+	}
+
+	var last *buildJob
+	for _, j := range g.jobs {
+		if total := visit(j); last == nil || total > totals[last] {
+			last = j
+		}
+	}
+
+	path := []*buildJob{}
+	for j := last; j != nil; j = prev[j] {
+		path = append([]*buildJob{j}, path...)
+	}
+
+	return path
+}
+
+// recordCriticalPath adds the graph's critical path to the build profile.
+func (g *jobGraph) recordCriticalPath(name string) {
+	cp := profile.CriticalPath{
+		Name: name,
+	}
+	projPath := interfaces.GetProject().Path() + "/"
+	for _, j := range g.criticalPath() {
+		stepName := j.Name
+		if j.File != "" {
+			stepName = j.Kind + " " + strings.TrimPrefix(j.File, projPath)
+		}
+		cp.Steps = append(cp.Steps, profile.PathStep{
+			Name: stepName,
+			Dur:  j.dur,
+		})
+	}
+
+	profile.AddCriticalPath(cp)
+}
+
+// combineJobErrors merges the errors reported by several failed jobs into a
+// single error.
+func combineJobErrors(errs []error) error {
+	if len(errs) == 1 {
+		return errs[0]
+	}
+
+	texts := make([]string, len(errs))
+	for i, err := range errs {
+		texts[i] = strings.TrimSpace(err.Error())
+	}
+
+	return util.NewNewtError(fmt.Sprintf("%d build jobs failed:\n%s",
+		len(errs), strings.Join(texts, "\n\n")))
+}
+
+func jobPkgName(job *buildJob) string {
+	if job.Bpkg == nil {
+		return "<none>"
+	}
+
+	return job.Bpkg.rpkg.Lpkg.FullName()
+}
+
+func indentLines(text string, indent string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = indent + line
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// failureSummary produces a report of every failed job, grouped by package.
+// Compile failures list the source file followed by the compiler's
+// diagnostics.
+func (g *jobGraph) failureSummary() string {
+	pkgFailures := map[string][]buildJobFailure{}
+	numFiles := 0
+	for _, f := range g.failures {
+		name := jobPkgName(f.Job)
+		pkgFailures[name] = append(pkgFailures[name], f)
+		if f.Job.File != "" {
+			numFiles++
+		}
+	}
+
+	pkgNames := make([]string, 0, len(pkgFailures))
+	for name, _ := range pkgFailures {
+		pkgNames = append(pkgNames, name)
+	}
+	sort.Strings(pkgNames)
+
+	projPath := interfaces.GetProject().Path() + "/"
+
+	buffer := &bytes.Buffer{}
+	fmt.Fprintf(buffer,
+		"Build failed; %d source file(s) in %d package(s) failed:\n",
+		numFiles, len(pkgNames))
+
+	for _, name := range pkgNames {
+		fmt.Fprintf(buffer, "\n%s:\n", name)
+
+		failures := pkgFailures[name]
+		sort.Slice(failures, func(i int, j int) bool {
+			return failures[i].Job.Name < failures[j].Job.Name
+		})
+		for _, f := range failures {
+			desc := f.Job.Name
+			if f.Job.File != "" {
+				desc = strings.TrimPrefix(f.Job.File, projPath)
+			}
+			fmt.Fprintf(buffer, "    %s\n", desc)
+			fmt.Fprintf(buffer, "%s\n",
+				indentLines(strings.TrimSpace(f.Err.Error()), "        "))
+		}
+	}
+
+	if len(g.blocked) > 0 {
+		skipped := []string{}
+		for _, job := range g.blocked {
+			skipped = append(skipped, job.Name)
+		}
+		sort.Strings(skipped)
+
+		fmt.Fprintf(buffer, "\nSkipped due to failed prerequisites:\n")
+		for _, name := range skipped {
+			fmt.Fprintf(buffer, "    %s\n", name)
+		}
+	}
+
+	return strings.TrimRight(buffer.String(), "\n")
+}
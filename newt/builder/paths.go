@@ -36,7 +36,20 @@ func ProjectRoot() string {
 	return project.GetProject().Path()
 }
 
+// If non-empty, build outputs are written here instead of <project>/bin.
+var binRootOverride string
+
+// SetBinRoot redirects all build outputs to the specified directory.  An
+// empty string restores the default location.
+func SetBinRoot(dir string) {
+	binRootOverride = dir
+}
+
 func BinRoot() string {
+	if binRootOverride != "" {
+		return binRootOverride
+	}
+
 	return project.GetProject().Path() + "/bin"
 }
 
@@ -56,6 +69,10 @@ func GeneratedIncludeDir(targetName string) string {
 	return GeneratedBaseDir(targetName) + "/include"
 }
 
+func GeneratedExportDir(targetName string) string {
+	return GeneratedBaseDir(targetName) + "/export"
+}
+
 func GeneratedBinDir(targetName string) string {
 	return GeneratedBaseDir(targetName) + "/bin"
 }
@@ -230,6 +247,10 @@ func (b *Builder) AppBinBasePath() string {
 		filepath.Base(b.appPkg.rpkg.Lpkg.FullName())
 }
 
+func (b *Builder) SbomPath() string {
+	return b.AppBinBasePath() + ".sbom.json"
+}
+
 func (b *Builder) CompileCmdsPath() string {
 	// The path depends on whether we are building an app or running a test.
 	var basePath string
@@ -0,0 +1,137 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dachalco/mynewt-newt/newt/project"
+	"github.com/dachalco/mynewt-newt/newt/toolchain"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// reproducibleCompilerInfo calculates the compiler flags that keep
+// build-host-specific paths out of build outputs (e.g., `__FILE__` expansions
+// and debug info).  The project root is mapped to ".", repos located outside
+// the project to "repos/<name>", and the output directory to "bin".
+func reproducibleCompilerInfo() *toolchain.CompilerInfo {
+	ci := toolchain.NewCompilerInfo()
+
+	addMap := func(from string, to string) {
+		ci.Cflags = append(ci.Cflags,
+			"-ffile-prefix-map="+from+"="+to,
+			"-fdebug-prefix-map="+from+"="+to)
+	}
+
+	proj := project.GetProject()
+	projPath := filepath.ToSlash(proj.Path())
+	addMap(projPath, ".")
+
+	names := make([]string, 0, len(proj.Repos()))
+	for name, _ := range proj.Repos() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		r := proj.Repos()[name]
+		if r.IsLocal() {
+			continue
+		}
+
+		// Repos are normally under the project root, but they may be
+		// symlinked to another location.
+		path, err := filepath.EvalSymlinks(r.Path())
+		if err != nil {
+			continue
+		}
+		path = filepath.ToSlash(path)
+		if path != projPath && !strings.HasPrefix(path, projPath+"/") {
+			addMap(path, "repos/"+name)
+		}
+	}
+
+	addMap(filepath.ToSlash(BinRoot()), "bin")
+
+	return ci
+}
+
+// OutputFiles lists the final build artifacts of the target: the elf and
+// binary file for the app, and for the loader if this is a split image.
+func (t *TargetBuilder) OutputFiles() []string {
+	files := []string{}
+
+	if t.LoaderBuilder != nil {
+		files = append(files,
+			t.LoaderBuilder.AppElfPath(),
+			t.LoaderBuilder.AppBinPath())
+	}
+
+	if t.AppBuilder != nil {
+		files = append(files,
+			t.AppBuilder.AppElfPath(),
+			t.AppBuilder.AppBinPath())
+	}
+
+	return files
+}
+
+// CompareOutputs compares two sets of build artifacts, as returned by
+// OutputFiles().  It returns a description of each artifact that differs; an
+// empty slice indicates the builds are identical.
+func CompareOutputs(files1 []string, files2 []string) ([]string, error) {
+	if len(files1) != len(files2) {
+		return nil, util.FmtNewtError(
+			"builds produced different numbers of artifacts (%d vs. %d)",
+			len(files1), len(files2))
+	}
+
+	diffs := []string{}
+	for i, _ := range files1 {
+		b1, err := ioutil.ReadFile(files1[i])
+		if err != nil {
+			return nil, util.ChildNewtError(err)
+		}
+		b2, err := ioutil.ReadFile(files2[i])
+		if err != nil {
+			return nil, util.ChildNewtError(err)
+		}
+
+		if bytes.Equal(b1, b2) {
+			continue
+		}
+
+		off := 0
+		for off < len(b1) && off < len(b2) && b1[off] == b2[off] {
+			off++
+		}
+
+		diffs = append(diffs, fmt.Sprintf(
+			"%s: sizes %d and %d; first difference at offset 0x%x",
+			filepath.Base(files1[i]), len(b1), len(b2), off))
+	}
+
+	return diffs, nil
+}
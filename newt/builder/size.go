@@ -28,7 +28,11 @@ import (
 	"strconv"
 	"strings"
 
+	log "github.com/sirupsen/logrus"
+
+	"github.com/dachalco/mynewt-newt/newt/event"
 	"github.com/dachalco/mynewt-newt/newt/interfaces"
+	"github.com/dachalco/mynewt-newt/newt/syscfg"
 	"github.com/dachalco/mynewt-newt/util"
 )
 
@@ -488,3 +492,112 @@ func (b *Builder) SizeReport(sectionName string, diffFriendly bool) error {
 	}
 	return nil
 }
+
+// parseBerkeleySize parses the output of the `size` utility (berkeley format)
+// into a map of column name to value, e.g., "text" => 12345.
+func parseBerkeleySize(output string) (map[string]interface{}, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return nil, util.FmtNewtError("unexpected size output: %s", output)
+	}
+
+	hdr := strings.Fields(lines[0])
+	vals := strings.Fields(lines[1])
+
+	sizes := map[string]interface{}{}
+	for i, name := range hdr {
+		if i >= len(vals) || name == "hex" || name == "filename" {
+			continue
+		}
+
+		v, err := strconv.ParseUint(vals[i], 10, 64)
+		if err != nil {
+			return nil, util.FmtNewtError("unexpected size output: %s",
+				output)
+		}
+		sizes[name] = v
+	}
+
+	return sizes, nil
+}
+
+// emitSizeEvent reports the section sizes of the linked app to the build
+// event stream.
+func (t *TargetBuilder) emitSizeEvent() {
+	b := t.AppBuilder
+
+	c, err := b.newCompiler(b.appPkg, b.FileBinDir(b.AppElfPath()))
+	if err != nil {
+		log.Debugf("failed to report image size: %s", err.Error())
+		return
+	}
+
+	output, err := c.PrintSize(b.AppElfPath())
+	if err != nil {
+		log.Debugf("failed to report image size: %s", err.Error())
+		return
+	}
+
+	sizes, err := parseBerkeleySize(output)
+	if err != nil {
+		log.Debugf("failed to report image size: %s", err.Error())
+		return
+	}
+
+	event.Emit("size", event.Event{
+		Package: b.appPkgName(),
+		File:    b.AppElfPath(),
+		Data:    sizes,
+	})
+}
+
+// checkLinkRestrictions verifies the syscfg restrictions that refer to the
+// linked app's memory usage (mem_size() and mem_used()) against the sizes in
+// the app's map file.
+func (t *TargetBuilder) checkLinkRestrictions() error {
+	cfg := &t.res.Cfg
+	if !cfg.HasLinkRestrictions() {
+		return nil
+	}
+
+	b := t.AppBuilder
+	if t.bspPkg.Arch == "sim" {
+		util.OneTimeWarning("Ignoring memory restrictions; " +
+			"not supported for sim targets")
+		return nil
+	}
+
+	if !util.NodeExist(b.AppMapPath()) {
+		return util.FmtNewtError("Memory restrictions require a map file; "+
+			"compiler \"%s\" does not produce one (compiler.ld.mapfile)",
+			t.bspPkg.CompilerName)
+	}
+
+	pkgSizes, err := ParseMapFileSizes(b.AppMapPath())
+	if err != nil {
+		return err
+	}
+
+	regions := make([]syscfg.MemRegion, 0, len(globalMemSections))
+	for name, sec := range globalMemSections {
+		used := 0
+		for _, ps := range pkgSizes {
+			used += int(ps.Sizes[name])
+		}
+
+		regions = append(regions, syscfg.MemRegion{
+			Name: name,
+			Size: int(sec.EndOff - sec.Offset),
+			Used: used,
+		})
+	}
+	sort.Slice(regions, func(i int, j int) bool {
+		return regions[i].Name < regions[j].Name
+	})
+
+	if text := cfg.DetectLinkViolations(regions); text != "" {
+		return util.NewNewtError(text)
+	}
+
+	return nil
+}
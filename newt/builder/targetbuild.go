@@ -32,9 +32,12 @@ import (
 
 	"github.com/apache/mynewt-artifact/flash"
 	"github.com/apache/mynewt-artifact/sec"
+	"github.com/dachalco/mynewt-newt/newt/event"
 	"github.com/dachalco/mynewt-newt/newt/flashmap"
 	"github.com/dachalco/mynewt-newt/newt/interfaces"
+	"github.com/dachalco/mynewt-newt/newt/newtutil"
 	"github.com/dachalco/mynewt-newt/newt/pkg"
+	"github.com/dachalco/mynewt-newt/newt/profile"
 	"github.com/dachalco/mynewt-newt/newt/project"
 	"github.com/dachalco/mynewt-newt/newt/resolve"
 	"github.com/dachalco/mynewt-newt/newt/symbol"
@@ -62,6 +65,9 @@ type TargetBuilder struct {
 	injectedSettings map[string]string
 
 	res *resolve.Resolution
+
+	// Non-nil if dependency resolution is being traced.
+	trace *resolve.Trace
 }
 
 func NewTargetTester(target *target.Target,
@@ -113,8 +119,13 @@ func (t *TargetBuilder) NewCompiler(dstDir string, buildProfile string) (
 
 	c, err := toolchain.NewCompiler(
 		t.compilerPkg.BasePath(), dstDir, buildProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	c.SetTargetBinDir(TargetBinDir(t.target.Name()))
 
-	return c, err
+	return c, nil
 }
 
 func (t *TargetBuilder) injectNewtSettings() {
@@ -219,13 +230,25 @@ func (t *TargetBuilder) ensureResolved() error {
 		appSeeds = append(appSeeds, t.testPkg)
 	}
 
-	var err error
-	t.res, err = resolve.ResolveFull(
-		loaderSeeds, appSeeds, t.injectedSettings, t.bspPkg.FlashMap)
+	span := event.Start("resolve", event.Event{})
+
+	err := t.phase("resolve", func() error {
+		var err error
+		t.res, err = resolve.ResolveFull(
+			loaderSeeds, appSeeds, t.injectedSettings, t.bspPkg.FlashMap,
+			t.bspPkg.RamSize, t.trace)
+		return err
+	})
 	if err != nil {
+		span.Finish(err)
 		return err
 	}
 
+	span.FinishData(nil, map[string]interface{}{
+		"num_packages": len(t.res.MasterSet.Rpkgs),
+		"num_settings": len(t.res.Cfg.Settings),
+	})
+
 	// Configure the basic set of environment variables in the current process.
 	env := BasicEnvVars("", t.bspPkg)
 	keys := make([]string, 0, len(env))
@@ -282,6 +305,15 @@ func (t *TargetBuilder) validateAndWriteCfg() error {
 		return err
 	}
 
+	if len(newtutil.NewtSyscfgExport) > 0 {
+		if err := syscfg.EnsureExported(t.res.Cfg,
+			GeneratedExportDir(t.target.FullName()),
+			newtutil.NewtSyscfgExport); err != nil {
+
+			return err
+		}
+	}
+
 	if err := t.res.LCfg.EnsureWritten(incDir); err != nil {
 		return err
 	}
@@ -363,7 +395,7 @@ func (t *TargetBuilder) PrepBuild() error {
 		return util.NewNewtError(flashErrText)
 	}
 
-	if err := t.validateAndWriteCfg(); err != nil {
+	if err := t.phase("syscfg", t.validateAndWriteCfg); err != nil {
 		return err
 	}
 
@@ -536,7 +568,30 @@ func (t *TargetBuilder) autogenKeys() error {
 	return nil
 }
 
+// phase runs one phase of the target build, recording its duration in the
+// build profile.
+func (t *TargetBuilder) phase(name string, fn func() error) error {
+	span := profile.Begin(profile.CAT_PHASE, name, profile.TID_MAIN)
+	span.SetArg("target", t.target.FullName())
+	err := fn()
+	span.End()
+
+	return err
+}
+
+// Build builds the target, reporting the build's start and completion to the
+// build event stream.
 func (t *TargetBuilder) Build() error {
+	event.SetTarget(t.target.FullName())
+
+	span := event.Start("build", event.Event{})
+	err := t.build()
+	span.Finish(err)
+
+	return err
+}
+
+func (t *TargetBuilder) build() error {
 	if err := t.PrepBuild(); err != nil {
 		return err
 	}
@@ -564,11 +619,14 @@ func (t *TargetBuilder) Build() error {
 	}()
 
 	// Execute the set of pre-build user scripts.
-	if err := t.execPreBuildCmds(workDir); err != nil {
+	err = t.phase("pre_build_cmds", func() error {
+		return t.execPreBuildCmds(workDir)
+	})
+	if err != nil {
 		return err
 	}
 
-	if err := t.AppBuilder.Build(); err != nil {
+	if err := t.phase("compile", t.AppBuilder.Build); err != nil {
 		return err
 	}
 
@@ -576,24 +634,41 @@ func (t *TargetBuilder) Build() error {
 	if t.LoaderBuilder == nil {
 		linkerScripts = t.bspPkg.LinkerScripts
 	} else {
-		if err := t.buildLoader(); err != nil {
+		if err := t.phase("loader", t.buildLoader); err != nil {
 			return err
 		}
 		linkerScripts = t.bspPkg.Part2LinkerScripts
 	}
 
 	// Execute the set of pre-link user scripts.
-	if err := t.execPreLinkCmds(workDir); err != nil {
+	err = t.phase("pre_link_cmds", func() error {
+		return t.execPreLinkCmds(workDir)
+	})
+	if err != nil {
 		return err
 	}
 
 	/* Link the app. */
-	if err := t.AppBuilder.Link(linkerScripts, t.extraADirs()); err != nil {
+	err = t.phase("link", func() error {
+		return t.AppBuilder.Link(linkerScripts, t.extraADirs())
+	})
+	if err != nil {
+		return err
+	}
+
+	if event.Enabled() {
+		t.emitSizeEvent()
+	}
+
+	if err := t.checkLinkRestrictions(); err != nil {
 		return err
 	}
 
 	// Execute the set of post-build user scripts.
-	if err := t.execPostLinkCmds(workDir); err != nil {
+	err = t.phase("post_link_cmds", func() error {
+		return t.execPostLinkCmds(workDir)
+	})
+	if err != nil {
 		return err
 	}
 
@@ -739,6 +814,14 @@ func (t *TargetBuilder) InjectSetting(key string, value string) {
 	t.injectedSettings[key] = value
 }
 
+// TraceResolve enables tracing of the target's dependency resolution.  It
+// must be called before the target is resolved.  The returned trace is
+// populated when resolution runs.
+func (t *TargetBuilder) TraceResolve() *resolve.Trace {
+	t.trace = resolve.NewTrace()
+	return t.trace
+}
+
 // Calculates the size of a single boot trailer.  This is the amount of flash
 // that must be reserved at the end of each image slot.
 func (t *TargetBuilder) bootTrailerSize() int {
@@ -818,3 +901,13 @@ func (t *TargetBuilder) CreateRevdepGraph() (DepGraph, error) {
 
 	return revdepGraph(t.res.MasterSet)
 }
+
+// DepGraphPkgTypes returns the type of each package in the target's
+// dependency graph.
+func (t *TargetBuilder) DepGraphPkgTypes() (DepGraphPkgTypes, error) {
+	if err := t.ensureResolved(); err != nil {
+		return nil, err
+	}
+
+	return depGraphPkgTypes(t.res.MasterSet), nil
+}
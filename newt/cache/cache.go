@@ -0,0 +1,484 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package cache implements a content-addressed store of compiled object
+// files.  Objects are keyed on the hash of the preprocessed translation unit
+// and the compiler command line used to build it, so the same object can be
+// shared among targets, clean builds, and separate project checkouts.
+//
+// The cache is configured in $HOME/.newt/newtrc.yml:
+//
+//     build_cache:
+//         dir: /path/to/cache
+//         max_size: 5G
+//
+// The cache is disabled if no directory is configured.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+
+	"github.com/dachalco/mynewt-newt/newt/settings"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+const STATS_FILENAME = "stats.json"
+const OBJ_EXT = ".o"
+
+// Persistent statistics, accumulated across newt invocations.
+type Stats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	Stores int64 `json:"stores"`
+}
+
+// Describes the current contents of the cache directory.
+type Usage struct {
+	NumEntries int
+	TotalSize  int64
+}
+
+type entry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// Statistics for the current newt invocation.
+var curStats Stats
+
+var dir *string
+
+// newtrcVal reads a setting from the "build_cache" section of newtrc.yml.
+func newtrcVal(name string) string {
+	return cast.ToString(settings.NewtrcVal("build_cache", name))
+}
+
+// Dir returns the configured cache directory, or "" if the cache is disabled.
+func Dir() string {
+	if dir != nil {
+		return *dir
+	}
+
+	s := expandHome(strings.TrimSpace(newtrcVal("dir")))
+	dir = &s
+
+	return s
+}
+
+// SetDir overrides the cache directory read from newtrc.yml.  Specify "" to
+// disable the cache.
+func SetDir(d string) {
+	dir = &d
+}
+
+// Enabled indicates whether a cache directory has been configured.
+func Enabled() bool {
+	return Dir() != ""
+}
+
+// MaxSize returns the configured maximum cache size in bytes, or 0 if no
+// limit has been configured.
+func MaxSize() (int64, error) {
+	s := newtrcVal("max_size")
+	if s == "" {
+		return 0, nil
+	}
+
+	return ParseSize(s)
+}
+
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	usr, err := user.Current()
+	if err != nil {
+		return path
+	}
+
+	return usr.HomeDir + strings.TrimPrefix(path, "~")
+}
+
+// ParseSize parses a size string with an optional K, M, or G suffix (powers
+// of 1024).
+func ParseSize(s string) (int64, error) {
+	lower := strings.ToLower(strings.TrimSpace(s))
+	lower = strings.TrimSuffix(lower, "b")
+
+	var multiplier int64 = 1
+	switch {
+	case strings.HasSuffix(lower, "k"):
+		multiplier = 1024
+	case strings.HasSuffix(lower, "m"):
+		multiplier = 1024 * 1024
+	case strings.HasSuffix(lower, "g"):
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier != 1 {
+		lower = lower[:len(lower)-1]
+	}
+
+	num, err := util.AtoiNoOct(lower)
+	if err != nil || num < 0 {
+		return 0, util.FmtNewtError("invalid size: \"%s\"", s)
+	}
+
+	return int64(num) * multiplier, nil
+}
+
+// Key calculates the cache key for a translation unit.
+//
+// @param preprocessed          The preprocessor output for the source file.
+// @param cmd                   The compiler command line, excluding the
+//                                  output filename.
+func Key(preprocessed []byte, cmd []string) string {
+	h := sha256.New()
+	h.Write([]byte(strings.Join(cmd, "\n")))
+	h.Write([]byte{0})
+	h.Write(preprocessed)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func entryPath(key string) string {
+	return filepath.Join(Dir(), key[:2], key+OBJ_EXT)
+}
+
+// Fetch copies the object file with the specified key to dstPath.  It returns
+// false if the cache does not contain the key.
+func Fetch(key string, dstPath string) bool {
+	src := entryPath(key)
+	if util.NodeNotExist(src) {
+		atomic.AddInt64(&curStats.Misses, 1)
+		return false
+	}
+
+	if err := util.CopyFile(src, dstPath); err != nil {
+		log.Debugf("failed to copy cached object %s: %s", src, err.Error())
+		atomic.AddInt64(&curStats.Misses, 1)
+		return false
+	}
+
+	// Refresh the entry's timestamp so that pruning discards the least
+	// recently used entries first.
+	now := time.Now()
+	os.Chtimes(src, now, now)
+
+	atomic.AddInt64(&curStats.Hits, 1)
+	return true
+}
+
+// Store adds the specified object file to the cache.  The file is written to
+// a temporary path first so that concurrent newt processes never see a
+// partially written entry.
+func Store(key string, objPath string) error {
+	dst := entryPath(key)
+	if util.NodeExist(dst) {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), key+".tmp")
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	tmpName := tmp.Name()
+	tmp.Close()
+
+	if err := util.CopyFile(objPath, tmpName); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	if err := os.Rename(tmpName, dst); err != nil {
+		os.Remove(tmpName)
+		return util.ChildNewtError(err)
+	}
+
+	atomic.AddInt64(&curStats.Stores, 1)
+	return nil
+}
+
+// CurStats returns the statistics for the current newt invocation.
+func CurStats() Stats {
+	return Stats{
+		Hits:   atomic.LoadInt64(&curStats.Hits),
+		Misses: atomic.LoadInt64(&curStats.Misses),
+		Stores: atomic.LoadInt64(&curStats.Stores),
+	}
+}
+
+func statsPath() string {
+	return filepath.Join(Dir(), STATS_FILENAME)
+}
+
+// ReadStats reads the accumulated statistics from the cache directory.
+func ReadStats() (Stats, error) {
+	stats := Stats{}
+
+	b, err := ioutil.ReadFile(statsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return stats, nil
+		}
+		return stats, util.ChildNewtError(err)
+	}
+
+	if err := json.Unmarshal(b, &stats); err != nil {
+		return stats, util.FmtNewtError(
+			"failed to parse cache statistics file \"%s\": %s",
+			statsPath(), err.Error())
+	}
+
+	return stats, nil
+}
+
+func writeStats(stats Stats) error {
+	b, err := json.MarshalIndent(stats, "", "    ")
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	if err := os.MkdirAll(Dir(), 0755); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	if err := ioutil.WriteFile(statsPath(), b, 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// FlushStats adds the current invocation's statistics to the persistent
+// totals in the cache directory.
+func FlushStats() error {
+	cur := CurStats()
+	if cur.Hits == 0 && cur.Misses == 0 && cur.Stores == 0 {
+		return nil
+	}
+
+	stats, err := ReadStats()
+	if err != nil {
+		return err
+	}
+
+	stats.Hits += cur.Hits
+	stats.Misses += cur.Misses
+	stats.Stores += cur.Stores
+
+	return writeStats(stats)
+}
+
+// isHex indicates whether a string consists solely of lowercase hex digits.
+func isHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return s != ""
+}
+
+// isEntryDirName indicates whether a directory name is one the cache creates
+// to hold entries (the first two hex digits of their keys).
+func isEntryDirName(name string) bool {
+	return len(name) == 2 && isHex(name)
+}
+
+// isEntryFileName indicates whether a file name is one the cache creates: an
+// entry ("<key>.o") or a partially written entry ("<key>.tmp<suffix>").
+func isEntryFileName(name string) bool {
+	if len(name) < sha256.Size*2 || !isHex(name[:sha256.Size*2]) {
+		return false
+	}
+
+	rest := name[sha256.Size*2:]
+	return rest == OBJ_EXT || strings.HasPrefix(rest, ".tmp")
+}
+
+// entryDirs lists the cache's entry directories.  It fails if the cache
+// directory contains anything the cache did not create; this guards against
+// deleting user files if the cache is pointed at an unrelated directory.
+func entryDirs() ([]string, error) {
+	infos, err := ioutil.ReadDir(Dir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, util.ChildNewtError(err)
+	}
+
+	var dirs []string
+	for _, info := range infos {
+		switch {
+		case info.IsDir() && isEntryDirName(info.Name()):
+			dirs = append(dirs, filepath.Join(Dir(), info.Name()))
+
+		case !info.IsDir() && info.Name() == STATS_FILENAME:
+
+		default:
+			return nil, util.FmtNewtError(
+				"\"%s\" does not look like a newt build cache (unexpected "+
+					"entry \"%s\"); check build_cache.dir in newtrc.yml",
+				Dir(), info.Name())
+		}
+	}
+
+	return dirs, nil
+}
+
+func readEntries() ([]entry, error) {
+	entries := []entry{}
+
+	dirs, err := entryDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range dirs {
+		infos, err := ioutil.ReadDir(d)
+		if err != nil {
+			return nil, util.ChildNewtError(err)
+		}
+
+		for _, info := range infos {
+			if info.IsDir() || !isEntryFileName(info.Name()) ||
+				filepath.Ext(info.Name()) != OBJ_EXT {
+
+				continue
+			}
+
+			entries = append(entries, entry{
+				path:    filepath.Join(d, info.Name()),
+				size:    info.Size(),
+				modTime: info.ModTime(),
+			})
+		}
+	}
+
+	return entries, nil
+}
+
+// ReadUsage calculates the number of entries in the cache and their combined
+// size.
+func ReadUsage() (Usage, error) {
+	entries, err := readEntries()
+	if err != nil {
+		return Usage{}, err
+	}
+
+	usage := Usage{NumEntries: len(entries)}
+	for _, e := range entries {
+		usage.TotalSize += e.size
+	}
+
+	return usage, nil
+}
+
+// Clean deletes every entry in the cache and resets the statistics.  Only
+// files the cache created are removed; the cache directory itself is kept.
+func Clean() error {
+	dirs, err := entryDirs()
+	if err != nil {
+		return err
+	}
+
+	for _, d := range dirs {
+		infos, err := ioutil.ReadDir(d)
+		if err != nil {
+			return util.ChildNewtError(err)
+		}
+
+		for _, info := range infos {
+			if !info.IsDir() && isEntryFileName(info.Name()) {
+				err := os.Remove(filepath.Join(d, info.Name()))
+				if err != nil && !os.IsNotExist(err) {
+					return util.ChildNewtError(err)
+				}
+			}
+		}
+
+		// Only succeeds if the directory is now empty.
+		os.Remove(d)
+	}
+
+	err = os.Remove(statsPath())
+	if err != nil && !os.IsNotExist(err) {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// Prune deletes the least recently used entries until the total size of the
+// cache is no greater than maxSize.
+//
+// @return                      The number of entries removed.
+func Prune(maxSize int64) (int, error) {
+	entries, err := readEntries()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, e := range entries {
+		total += e.size
+	}
+
+	// Oldest entries first.
+	sort.Slice(entries, func(i int, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+
+	removed := 0
+	for _, e := range entries {
+		if total <= maxSize {
+			break
+		}
+
+		if err := os.Remove(e.path); err != nil {
+			return removed, util.ChildNewtError(err)
+		}
+
+		total -= e.size
+		removed++
+	}
+
+	return removed, nil
+}
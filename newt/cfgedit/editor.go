@@ -0,0 +1,308 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package cfgedit implements an interactive editor for a target's syscfg
+// overrides.  Edits are validated against the setting restrictions as they are
+// made and saved to the target's syscfg.yml file.
+package cfgedit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dachalco/mynewt-newt/newt/builder"
+	"github.com/dachalco/mynewt-newt/newt/parse"
+	"github.com/dachalco/mynewt-newt/newt/pkg"
+	"github.com/dachalco/mynewt-newt/newt/syscfg"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+type Editor struct {
+	// The package whose syscfg.yml receives the edits (the target or unit
+	// test package).
+	lpkg *pkg.LocalPackage
+
+	cfg syscfg.Cfg
+
+	// The package's current overrides (`syscfg.vals`).
+	vals map[string]string
+
+	dirty bool
+}
+
+// New creates an editor for the specified target.  The target's
+// configuration is resolved once; edits are applied to the resolved
+// configuration.
+func New(b *builder.TargetBuilder) (*Editor, error) {
+	res, err := b.Resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	lpkg := b.GetTestPkg()
+	if lpkg == nil {
+		lpkg = b.GetTarget().Package()
+	}
+
+	vals, err := lpkg.SyscfgY.GetValStringMapString("syscfg.vals", nil)
+	util.OneTimeWarningError(err)
+	if vals == nil {
+		vals = map[string]string{}
+	}
+
+	return &Editor{
+		lpkg: lpkg,
+		cfg:  res.Cfg,
+		vals: vals,
+	}, nil
+}
+
+// Path returns the path of the file that edits are saved to.
+func (e *Editor) Path() string {
+	return e.lpkg.SyscfgYamlPath()
+}
+
+func (e *Editor) Dirty() bool {
+	return e.dirty
+}
+
+// Packages lists the packages that define settings, sorted by name.
+func (e *Editor) Packages() []string {
+	names := []string{}
+	for name, _ := range syscfg.EntriesByPkg(e.cfg) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func sortEntries(entries []syscfg.CfgEntry) {
+	sort.Slice(entries, func(i int, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+}
+
+// Entries lists the settings defined by the specified package.
+func (e *Editor) Entries(pkgName string) []syscfg.CfgEntry {
+	entries := syscfg.EntriesByPkg(e.cfg)[pkgName]
+	sortEntries(entries)
+
+	return entries
+}
+
+// Search lists the settings whose name or description contains the specified
+// text (case insensitive).
+func (e *Editor) Search(text string) []syscfg.CfgEntry {
+	text = strings.ToLower(text)
+
+	entries := []syscfg.CfgEntry{}
+	for _, entry := range e.cfg.Settings {
+		if strings.Contains(strings.ToLower(entry.Name), text) ||
+			strings.Contains(strings.ToLower(entry.Description), text) {
+
+			entries = append(entries, entry)
+		}
+	}
+	sortEntries(entries)
+
+	return entries
+}
+
+func (e *Editor) Entry(name string) (syscfg.CfgEntry, bool) {
+	entry, ok := e.cfg.Settings[name]
+	return entry, ok
+}
+
+// Overridden indicates whether the edited package overrides the specified
+// setting.
+func (e *Editor) Overridden(name string) bool {
+	_, ok := e.vals[name]
+	return ok
+}
+
+// dependents returns the specified setting followed by the settings whose
+// values come from it, directly or indirectly: copies made with
+// `MYNEWT_VAL()` and derived settings.
+func (e *Editor) dependents(name string) []string {
+	found := map[string]struct{}{name: struct{}{}}
+
+	uses := func(entry syscfg.CfgEntry) bool {
+		if _, ok := found[entry.ValueRefName]; ok {
+			return true
+		}
+		if entry.DerivedExpr == "" {
+			return false
+		}
+
+		tokens, err := parse.Lex(entry.DerivedExpr)
+		if err != nil {
+			return false
+		}
+		for _, n := range parse.IdentNames(tokens) {
+			if _, ok := found[n]; ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	var names []string
+	for changed := true; changed; {
+		changed = false
+		for n, entry := range e.cfg.Settings {
+			if _, ok := found[n]; !ok && uses(entry) {
+				found[n] = struct{}{}
+				names = append(names, n)
+				changed = true
+			}
+		}
+	}
+	sort.Strings(names)
+
+	return append([]string{name}, names...)
+}
+
+// Violations lists the problems with a setting's current value: a value that
+// doesn't conform to the setting's type, and unmet restrictions that involve
+// the setting.  Settings that copy or are derived from the setting are
+// checked as well.
+func (e *Editor) Violations(name string) []string {
+	if _, ok := e.cfg.Settings[name]; !ok {
+		return nil
+	}
+
+	violations := []string{}
+	seen := map[string]struct{}{}
+	add := func(v string) {
+		if _, ok := seen[v]; !ok {
+			seen[v] = struct{}{}
+			violations = append(violations, v)
+		}
+	}
+
+	settings := e.cfg.SettingValues()
+	for _, n := range e.dependents(name) {
+		entry := e.cfg.Settings[n]
+		if _, err := entry.CValue(settings); err != nil {
+			add(err.Error())
+		}
+
+		for _, or := range e.cfg.RestrictionsInvolving(n) {
+			if e.cfg.RestrictionMet(or.Restriction) {
+				continue
+			}
+
+			owner := "Package " + or.Pkg
+			if or.Setting != "" {
+				owner = "Setting " + or.Setting
+			}
+			add(fmt.Sprintf("%s %s", owner, or.Restriction.Text()))
+		}
+	}
+
+	return violations
+}
+
+// removeOwnPoint removes the edited package's override from a setting's
+// history.
+func (e *Editor) removeOwnPoint(entry *syscfg.CfgEntry) {
+	history := []syscfg.CfgPoint{}
+	for i, p := range entry.History {
+		if i == 0 || p.Source != e.lpkg {
+			history = append(history, p)
+		}
+	}
+	entry.History = history
+}
+
+// Set overrides a setting in the edited package.  The returned slice lists the
+// setting's violations with its new value.
+func (e *Editor) Set(name string, value string) ([]string, error) {
+	entry, ok := e.cfg.Settings[name]
+	if !ok {
+		return nil, util.FmtNewtError("setting \"%s\" is not defined", name)
+	}
+	if entry.DerivedExpr != "" {
+		return nil, util.FmtNewtError(
+			"setting \"%s\" is derived from `%s`; it cannot be overridden",
+			name, entry.DerivedExpr)
+	}
+	if entry.History[0].IsInjected() {
+		return nil, util.FmtNewtError(
+			"setting \"%s\" is injected by newt; it cannot be overridden",
+			name)
+	}
+
+	e.removeOwnPoint(&entry)
+	entry.History = append(entry.History, syscfg.CfgPoint{
+		Value:  value,
+		Source: e.lpkg,
+	})
+	entry.Value = value
+	entry.ValueRefName = ""
+	e.cfg.Settings[name] = entry
+	e.cfg.ReresolveValues()
+
+	e.vals[name] = value
+	e.dirty = true
+
+	return e.Violations(name), nil
+}
+
+// Reset removes the edited package's override of a setting.  The setting
+// reverts to the value assigned by the other packages.
+func (e *Editor) Reset(name string) ([]string, error) {
+	entry, ok := e.cfg.Settings[name]
+	if !ok {
+		return nil, util.FmtNewtError("setting \"%s\" is not defined", name)
+	}
+	if _, ok := e.vals[name]; !ok {
+		return nil, util.FmtNewtError(
+			"setting \"%s\" is not overridden by %s", name,
+			e.lpkg.FullName())
+	}
+
+	e.removeOwnPoint(&entry)
+	entry.Value = entry.History[len(entry.History)-1].Value
+	entry.ValueRefName = ""
+	e.cfg.Settings[name] = entry
+	e.cfg.ReresolveValues()
+
+	delete(e.vals, name)
+	e.dirty = true
+
+	return e.Violations(name), nil
+}
+
+// Save writes the edited overrides to the package's syscfg.yml file.
+func (e *Editor) Save() error {
+	itfMap := util.StringMapStringToItfMapItf(e.vals)
+	if err := e.lpkg.SyscfgY.Replace("syscfg.vals", itfMap); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	if err := e.lpkg.SaveSyscfg(); err != nil {
+		return err
+	}
+
+	e.dirty = false
+	return nil
+}
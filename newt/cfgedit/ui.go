@@ -0,0 +1,310 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cfgedit
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dachalco/mynewt-newt/newt/syscfg"
+)
+
+const helpText = `Commands:
+    <number>    Open the numbered package or edit the numbered setting
+    /<text>     Search setting names and descriptions
+    p           List packages
+    l           Redisplay the current list
+    s           Save changes
+    q           Quit
+    ?           Show this help
+`
+
+const descWidth = 72
+
+type ui struct {
+	e       *Editor
+	scanner *bufio.Scanner
+	out     io.Writer
+
+	// The settings in the current list; nil if packages are listed.
+	entries []syscfg.CfgEntry
+	title   string
+}
+
+func (u *ui) printf(format string, args ...interface{}) {
+	fmt.Fprintf(u.out, format, args...)
+}
+
+// prompt displays a prompt and reads a line of input.  False is returned at
+// the end of input.
+func (u *ui) prompt(format string, args ...interface{}) (string, bool) {
+	u.printf(format, args...)
+	if !u.scanner.Scan() {
+		u.printf("\n")
+		return "", false
+	}
+
+	return strings.TrimSpace(u.scanner.Text()), true
+}
+
+func (u *ui) confirm(format string, args ...interface{}) bool {
+	rsp, _ := u.prompt(format+" (y/N): ", args...)
+	return strings.ToLower(rsp) == "y"
+}
+
+func truncate(s string, width int) string {
+	if len(s) <= width {
+		return s
+	}
+	return s[:width-3] + "..."
+}
+
+// origin describes where a setting's value came from.
+func (u *ui) origin(entry syscfg.CfgEntry) string {
+	if entry.DerivedExpr != "" {
+		return "derived from " + entry.DerivedExpr
+	}
+
+	p := entry.History[len(entry.History)-1]
+	if len(entry.History) == 1 {
+		return "default"
+	}
+	return "set by " + p.Name()
+}
+
+func (u *ui) listPackages() {
+	u.entries = nil
+	u.title = ""
+
+	u.printf("\nPackages:\n")
+	for i, name := range u.e.Packages() {
+		u.printf("  %3d. %s (%d settings)\n", i+1, name,
+			len(u.e.Entries(name)))
+	}
+}
+
+func (u *ui) listEntries() {
+	u.printf("\n%s:\n", u.title)
+	if len(u.entries) == 0 {
+		u.printf("    (no settings)\n")
+	}
+
+	for i, entry := range u.entries {
+		mark := " "
+		if u.e.Overridden(entry.Name) {
+			mark = "*"
+		}
+
+		u.printf("  %3d.%s%s = %s (%s)\n", i+1, mark, entry.Name,
+			entry.Value, u.origin(entry))
+		if entry.Description != "" {
+			u.printf("        %s\n", truncate(entry.Description, descWidth))
+		}
+	}
+	u.printf("(* = set in %s)\n", u.e.Path())
+}
+
+func (u *ui) showEntry(entry syscfg.CfgEntry) {
+	u.printf("\n%s\n", entry.Name)
+	if entry.Description != "" {
+		u.printf("    %s\n", entry.Description)
+	}
+	u.printf("    Value: %s (%s)\n", entry.Value, u.origin(entry))
+	u.printf("    Defined by: %s (default: %s)\n", entry.History[0].Name(),
+		entry.History[0].Value)
+
+	if entry.ValueType != syscfg.CFG_VALUE_TYPE_NONE {
+		s := entry.ValueType.String()
+		if entry.ValueMin != nil {
+			s += fmt.Sprintf(", min %d", *entry.ValueMin)
+		}
+		if entry.ValueMax != nil {
+			s += fmt.Sprintf(", max %d", *entry.ValueMax)
+		}
+		if len(entry.ValueFlags) > 0 {
+			s += ", flags " + strings.Join(entry.ValueFlags, "|")
+		}
+		u.printf("    Type: %s\n", s)
+	}
+	if len(entry.ValidChoices) > 0 {
+		u.printf("    Choices: %s\n", strings.Join(entry.ValidChoices, ", "))
+	}
+	for _, r := range entry.Restrictions {
+		if r.Code != syscfg.CFG_RESTRICTION_CODE_CHOICE {
+			u.printf("    Restriction: %s\n", r.Text())
+		}
+	}
+}
+
+func (u *ui) printViolations(violations []string) {
+	for _, v := range violations {
+		u.printf("!!! %s\n", v)
+	}
+}
+
+// edit prompts for a new value for a setting.
+func (u *ui) edit(entry syscfg.CfgEntry) {
+	u.showEntry(entry)
+	if entry.DerivedExpr != "" {
+		u.printf("This setting is derived; it cannot be edited.\n")
+		return
+	}
+
+	rsp, ok := u.prompt("New value (empty to cancel, '-' to remove " +
+		"override): ")
+	if !ok || rsp == "" {
+		return
+	}
+
+	oldVal, wasSet := u.e.vals[entry.Name]
+	wasDirty := u.e.dirty
+
+	var violations []string
+	var err error
+	if rsp == "-" {
+		violations, err = u.e.Reset(entry.Name)
+	} else {
+		violations, err = u.e.Set(entry.Name, rsp)
+	}
+	if err != nil {
+		u.printf("Error: %s\n", err.Error())
+		return
+	}
+
+	if len(violations) > 0 {
+		u.printViolations(violations)
+		if !u.confirm("Keep this value anyway?") {
+			if wasSet {
+				u.e.Set(entry.Name, oldVal)
+			} else {
+				u.e.Reset(entry.Name)
+			}
+			u.e.dirty = wasDirty
+			u.printf("Change discarded.\n")
+			return
+		}
+	}
+
+	cur, _ := u.e.Entry(entry.Name)
+	u.printf("%s = %s\n", cur.Name, cur.Value)
+}
+
+func (u *ui) save() {
+	if err := u.e.Save(); err != nil {
+		u.printf("Error: %s\n", err.Error())
+		return
+	}
+	u.printf("Saved %s\n", u.e.Path())
+}
+
+// selectItem handles a numeric command.
+func (u *ui) selectItem(n int) {
+	if u.entries == nil {
+		pkgs := u.e.Packages()
+		if n < 1 || n > len(pkgs) {
+			u.printf("Invalid package number: %d\n", n)
+			return
+		}
+
+		u.title = "Settings defined by " + pkgs[n-1]
+		u.entries = u.e.Entries(pkgs[n-1])
+		u.listEntries()
+		return
+	}
+
+	if n < 1 || n > len(u.entries) {
+		u.printf("Invalid setting number: %d\n", n)
+		return
+	}
+
+	u.edit(u.entries[n-1])
+
+	// Refresh the list to reflect the edit.
+	for i, entry := range u.entries {
+		u.entries[i], _ = u.e.Entry(entry.Name)
+	}
+}
+
+// Run runs the interactive editor.  Commands are read from `in`; output is
+// written to `out`.
+func (e *Editor) Run(in io.Reader, out io.Writer) {
+	u := &ui{
+		e:       e,
+		scanner: bufio.NewScanner(in),
+		out:     out,
+	}
+
+	u.printf("Editing syscfg overrides in %s\n", e.Path())
+	u.printf("%s", helpText)
+	u.listPackages()
+
+	for {
+		cmd, ok := u.prompt("\n> ")
+		if !ok {
+			if e.Dirty() {
+				u.printf("Unsaved changes discarded.\n")
+			}
+			return
+		}
+
+		switch {
+		case cmd == "":
+
+		case cmd == "?" || cmd == "h":
+			u.printf("%s", helpText)
+
+		case cmd == "p":
+			u.listPackages()
+
+		case cmd == "l":
+			if u.entries == nil {
+				u.listPackages()
+			} else {
+				u.listEntries()
+			}
+
+		case cmd == "s":
+			u.save()
+
+		case cmd == "q":
+			if e.Dirty() && u.confirm("Save changes to %s?", e.Path()) {
+				u.save()
+			}
+			return
+
+		case strings.HasPrefix(cmd, "/"):
+			text := strings.TrimSpace(cmd[1:])
+			u.title = fmt.Sprintf("Settings matching \"%s\"", text)
+			u.entries = e.Search(text)
+			u.listEntries()
+
+		default:
+			n, err := strconv.Atoi(cmd)
+			if err != nil {
+				u.printf("Unknown command: %s (enter ? for help)\n", cmd)
+				continue
+			}
+			u.selectItem(n)
+		}
+	}
+}
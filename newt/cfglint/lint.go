@@ -0,0 +1,471 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package cfglint finds questionable syscfg settings in a target: settings
+// that nothing uses, overrides that have no effect, and uses of deprecated
+// settings.
+package cfglint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dachalco/mynewt-newt/newt/builder"
+	"github.com/dachalco/mynewt-newt/newt/interfaces"
+	"github.com/dachalco/mynewt-newt/newt/parse"
+	"github.com/dachalco/mynewt-newt/newt/pkg"
+	"github.com/dachalco/mynewt-newt/newt/project"
+	"github.com/dachalco/mynewt-newt/newt/syscfg"
+	"github.com/dachalco/mynewt-newt/newt/ycfg"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// Finding kinds.
+const (
+	KIND_UNUSED     = "unused"
+	KIND_NOOP       = "no-op-override"
+	KIND_SHADOWED   = "shadowed-override"
+	KIND_ORPHAN     = "orphan-override"
+	KIND_DEPRECATED = "deprecated-use"
+)
+
+// Order in which the kinds are reported.
+var kindOrder = []string{
+	KIND_UNUSED,
+	KIND_NOOP,
+	KIND_SHADOWED,
+	KIND_ORPHAN,
+	KIND_DEPRECATED,
+}
+
+var kindTitles = map[string]string{
+	KIND_UNUSED:     "Unused settings",
+	KIND_NOOP:       "No-op overrides",
+	KIND_SHADOWED:   "Shadowed overrides",
+	KIND_ORPHAN:     "Overrides of settings not in the build",
+	KIND_DEPRECATED: "Deprecated settings used in source code",
+}
+
+// Source file extensions that are scanned for setting references.
+var srcExts = map[string]struct{}{
+	".c":   struct{}{},
+	".h":   struct{}{},
+	".cc":  struct{}{},
+	".cpp": struct{}{},
+	".cxx": struct{}{},
+	".hpp": struct{}{},
+	".s":   struct{}{},
+	".S":   struct{}{},
+	".ld":  struct{}{},
+}
+
+// Matches `MYNEWT_VAL(X)`, `MYNEWT_VAL_CHOICE(X, ...)`, and `MYNEWT_VAL_X`.
+var srcRefRe = regexp.MustCompile(
+	`MYNEWT_VAL(?:_CHOICE)?\(\s*(\w+)\s*[,)]|\bMYNEWT_VAL_(\w+)`)
+
+// A Finding is a single lint warning.
+type Finding struct {
+	Kind    string `json:"kind"`
+	Setting string `json:"setting"`
+
+	// The package that defines or overrides the setting, as appropriate.
+	Pkg string `json:"package"`
+
+	Text string `json:"text"`
+}
+
+type Report struct {
+	Target   string    `json:"target"`
+	Findings []Finding `json:"findings"`
+}
+
+// linter accumulates setting references while scanning a target.
+type linter struct {
+	cfg syscfg.Cfg
+
+	// [setting-name] => files that reference the setting.
+	srcRefs map[string][]string
+
+	// Settings referenced by YAML expressions, value references, derived
+	// settings, or restrictions.
+	yamlRefs map[string]struct{}
+
+	report *Report
+}
+
+func (l *linter) add(kind string, setting string, lpkg *pkg.LocalPackage,
+	format string, args ...interface{}) {
+
+	pkgName := "newt"
+	if lpkg != nil {
+		pkgName = lpkg.FullName()
+	}
+
+	l.report.Findings = append(l.report.Findings, Finding{
+		Kind:    kind,
+		Setting: setting,
+		Pkg:     pkgName,
+		Text:    fmt.Sprintf(format, args...),
+	})
+}
+
+func relPath(path string) string {
+	rel, err := filepath.Rel(interfaces.GetProject().Path(), path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+// scanSources records the setting references in a package's source files.
+// Subdirectories containing other packages are skipped.
+func (l *linter) scanSources(lpkg *pkg.LocalPackage) error {
+	base := lpkg.BasePath()
+
+	return filepath.Walk(base, func(path string, info os.FileInfo,
+		err error) error {
+
+		if err != nil {
+			return nil
+		}
+
+		if info.IsDir() {
+			if path == base {
+				return nil
+			}
+			name := info.Name()
+			if strings.HasPrefix(name, ".") || name == "bin" ||
+				util.NodeExist(filepath.Join(path, pkg.PACKAGE_FILE_NAME)) {
+
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if _, ok := srcExts[filepath.Ext(path)]; !ok {
+			return nil
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return util.ChildNewtError(err)
+		}
+
+		seen := map[string]struct{}{}
+		for _, m := range srcRefRe.FindAllSubmatch(b, -1) {
+			name := string(m[1])
+			if name == "" {
+				name = string(m[2])
+			}
+			if _, ok := seen[name]; !ok {
+				seen[name] = struct{}{}
+				l.srcRefs[name] = append(l.srcRefs[name], relPath(path))
+			}
+		}
+
+		return nil
+	})
+}
+
+func (l *linter) addExprRefs(expr string) {
+	tokens, err := parse.Lex(expr)
+	if err != nil {
+		return
+	}
+
+	for _, n := range parse.IdentNames(tokens) {
+		l.yamlRefs[n] = struct{}{}
+	}
+}
+
+// scanYaml records the settings referenced by a YAML file's conditional
+// keys and by `MYNEWT_VAL()` references in its values.
+func (l *linter) scanYaml(yc *ycfg.YCfg) {
+	for _, node := range yc.ConditionalKeys() {
+		l.addExprRefs(node.Name)
+	}
+
+	for _, v := range yc.AllSettingsAsStrings() {
+		for _, m := range srcRefRe.FindAllStringSubmatch(v, -1) {
+			if m[1] != "" {
+				l.yamlRefs[m[1]] = struct{}{}
+			}
+		}
+	}
+}
+
+// scanCfg records the settings referenced by other settings: value
+// references, derived expressions, and restrictions.
+func (l *linter) scanCfg() {
+	addRestrictionRefs := func(self string, rs []syscfg.CfgRestriction) {
+		for _, r := range rs {
+			for _, n := range r.SettingNames() {
+				if n != self {
+					l.yamlRefs[n] = struct{}{}
+				}
+			}
+		}
+	}
+
+	for name, entry := range l.cfg.Settings {
+		if entry.ValueRefName != "" {
+			l.yamlRefs[entry.ValueRefName] = struct{}{}
+		}
+		if entry.DerivedExpr != "" {
+			l.addExprRefs(entry.DerivedExpr)
+		}
+		addRestrictionRefs(name, entry.Restrictions)
+	}
+
+	for _, rs := range l.cfg.PackageRestrictions {
+		addRestrictionRefs("", rs)
+	}
+}
+
+func (l *linter) checkUnused(name string, entry syscfg.CfgEntry) {
+	// Injected settings and settings that newt itself consumes (e.g., task
+	// priorities) are exempt.
+	if entry.PackageDef == nil ||
+		entry.SettingType != syscfg.CFG_SETTING_TYPE_RAW {
+
+		return
+	}
+
+	if len(l.srcRefs[name]) > 0 {
+		return
+	}
+	if _, ok := l.yamlRefs[name]; ok {
+		return
+	}
+
+	l.add(KIND_UNUSED, name, entry.PackageDef,
+		"%s is not referenced by any source file or YAML expression",
+		name)
+}
+
+// isTopLevel indicates whether a package is a target or app (or unittest),
+// i.e., a package whose overrides are expected to take effect.
+func isTopLevel(lpkg *pkg.LocalPackage) bool {
+	switch syscfg.PkgPriority(lpkg) {
+	case pkg.PACKAGE_TYPE_TARGET, pkg.PACKAGE_TYPE_APP,
+		pkg.PACKAGE_TYPE_UNITTEST:
+
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *linter) checkOverrides(name string, entry syscfg.CfgEntry) {
+	if len(entry.History) < 2 || entry.DerivedExpr != "" {
+		return
+	}
+
+	last := entry.History[len(entry.History)-1]
+
+	for i := 1; i < len(entry.History); i++ {
+		p := entry.History[i]
+		prev := entry.History[i-1]
+		if p.Source == nil {
+			continue
+		}
+
+		if strings.TrimSpace(p.Value) == strings.TrimSpace(prev.Value) {
+			if i == 1 {
+				l.add(KIND_NOOP, name, p.Source,
+					"%s overrides %s with its default value (%s)",
+					p.Name(), name, p.Value)
+			} else {
+				l.add(KIND_NOOP, name, p.Source,
+					"%s overrides %s with the value already set by %s (%s)",
+					p.Name(), name, prev.Name(), p.Value)
+			}
+			continue
+		}
+
+		// Overriding a lower-priority package's value is normal layering.
+		// Only a target or app override that doesn't take effect is
+		// suspicious.
+		if i < len(entry.History)-1 && isTopLevel(p.Source) &&
+			strings.TrimSpace(last.Value) != strings.TrimSpace(p.Value) {
+
+			l.add(KIND_SHADOWED, name, p.Source,
+				"%s sets %s to %s, but %s overrides it with %s",
+				p.Name(), name, p.Value, last.Name(), last.Value)
+		}
+	}
+}
+
+// definers maps each setting defined anywhere in the project to the packages
+// that define it.
+func definers() map[string][]*pkg.LocalPackage {
+	m := map[string][]*pkg.LocalPackage{}
+
+	for _, pi := range project.GetProject().PackagesOfType(-1) {
+		lpkg := pi.(*pkg.LocalPackage)
+		defs, err := lpkg.SyscfgY.GetValStringMap("syscfg.defs", nil)
+		if err != nil {
+			continue
+		}
+		for name, _ := range defs {
+			m[name] = append(m[name], lpkg)
+		}
+	}
+
+	return m
+}
+
+func (l *linter) checkOrphans() {
+	if len(l.cfg.Orphans) == 0 {
+		return
+	}
+
+	defs := definers()
+	for name, points := range l.cfg.Orphans {
+		where := "no package in the project defines it"
+		if lpkgs := defs[name]; len(lpkgs) > 0 {
+			names := make([]string, len(lpkgs))
+			for i, lpkg := range lpkgs {
+				names[i] = lpkg.FullName()
+			}
+			sort.Strings(names)
+			where = "defined by " + strings.Join(names, ", ") +
+				", which is not part of the build"
+		}
+
+		for _, p := range points {
+			l.add(KIND_ORPHAN, name, p.Source, "%s overrides %s; %s",
+				p.Name(), name, where)
+		}
+	}
+}
+
+func (l *linter) checkDeprecated(name string, entry syscfg.CfgEntry) {
+	if entry.State == syscfg.CFG_SETTING_STATE_GOOD {
+		return
+	}
+
+	files := l.srcRefs[name]
+	if len(files) == 0 {
+		return
+	}
+
+	sort.Strings(files)
+	l.add(KIND_DEPRECATED, name, entry.PackageDef,
+		"deprecated setting %s is used in %s", name,
+		strings.Join(files, ", "))
+}
+
+// Lint checks the system configuration of the specified target.
+func Lint(t *builder.TargetBuilder) (*Report, error) {
+	res, err := t.Resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &linter{
+		cfg:      res.Cfg,
+		srcRefs:  map[string][]string{},
+		yamlRefs: map[string]struct{}{},
+		report: &Report{
+			Target:   t.GetTarget().FullName(),
+			Findings: []Finding{},
+		},
+	}
+
+	for _, rpkg := range res.MasterSet.Rpkgs {
+		lpkg := rpkg.Lpkg
+		if err := l.scanSources(lpkg); err != nil {
+			return nil, err
+		}
+		l.scanYaml(&lpkg.PkgY)
+		l.scanYaml(&lpkg.SyscfgY)
+	}
+	l.scanCfg()
+
+	for name, entry := range l.cfg.Settings {
+		l.checkUnused(name, entry)
+		l.checkOverrides(name, entry)
+		l.checkDeprecated(name, entry)
+	}
+	l.checkOrphans()
+
+	rank := map[string]int{}
+	for i, k := range kindOrder {
+		rank[k] = i
+	}
+	sort.SliceStable(l.report.Findings, func(i int, j int) bool {
+		a := l.report.Findings[i]
+		b := l.report.Findings[j]
+		if a.Kind != b.Kind {
+			return rank[a.Kind] < rank[b.Kind]
+		}
+		if a.Setting != b.Setting {
+			return a.Setting < b.Setting
+		}
+		return a.Pkg < b.Pkg
+	})
+
+	return l.report, nil
+}
+
+func (r *Report) JSON() ([]byte, error) {
+	b, err := json.MarshalIndent(r, "", "    ")
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return b, nil
+}
+
+// Text produces a human-readable report, grouped by kind.
+func (r *Report) Text() string {
+	var b strings.Builder
+
+	if len(r.Findings) == 0 {
+		fmt.Fprintf(&b, "No syscfg problems found in %s.\n", r.Target)
+		return b.String()
+	}
+
+	for _, kind := range kindOrder {
+		first := true
+		for _, f := range r.Findings {
+			if f.Kind != kind {
+				continue
+			}
+			if first {
+				if b.Len() > 0 {
+					fmt.Fprintf(&b, "\n")
+				}
+				fmt.Fprintf(&b, "%s:\n", kindTitles[kind])
+				first = false
+			}
+			fmt.Fprintf(&b, "    * %s\n", f.Text)
+		}
+	}
+
+	fmt.Fprintf(&b, "\n%d finding(s) in %s.\n", len(r.Findings), r.Target)
+	return b.String()
+}
@@ -21,15 +21,20 @@ package cli
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/dachalco/mynewt-newt/newt/builder"
+	"github.com/dachalco/mynewt-newt/newt/event"
 	"github.com/dachalco/mynewt-newt/newt/imgprod"
 	"github.com/dachalco/mynewt-newt/newt/manifest"
+	"github.com/dachalco/mynewt-newt/newt/newtutil"
 	"github.com/dachalco/mynewt-newt/newt/pkg"
+	"github.com/dachalco/mynewt-newt/newt/profile"
 	"github.com/dachalco/mynewt-newt/newt/project"
+	"github.com/dachalco/mynewt-newt/newt/syscfg"
 	"github.com/dachalco/mynewt-newt/newt/target"
 	"github.com/dachalco/mynewt-newt/util"
 	"github.com/spf13/cobra"
@@ -106,6 +111,111 @@ var noGDB_flag bool
 var diffFriendly_flag bool
 var imgFileOverride string
 var elfFileOverride string
+var eventsFormat string
+var eventsOut string
+
+var profileFile string
+var verifyReproducible bool
+
+// verifyTargetReproducible builds the specified target a second time in a
+// scratch output directory and compares the resulting artifacts with those of
+// the first build.
+func verifyTargetReproducible(t *target.Target, b *builder.TargetBuilder) {
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Verifying target %s is reproducible\n", t.FullName())
+
+	// Remember the first build's artifacts before the output directory
+	// changes.
+	files1 := b.OutputFiles()
+
+	tmpDir, err := ioutil.TempDir("", "newt-verify")
+	if err != nil {
+		NewtUsage(nil, util.ChildNewtError(err))
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := ResetGlobalState(); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	t2 := ResolveTarget(t.FullName())
+	if t2 == nil {
+		NewtUsage(nil, util.NewNewtError("Failed to resolve target: "+
+			t.Name()))
+	}
+
+	builder.SetBinRoot(tmpDir)
+	defer builder.SetBinRoot("")
+
+	b2, err := builder.NewTargetBuilder(t2)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+	if err := b2.Build(); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	diffs, err := builder.CompareOutputs(files1, b2.OutputFiles())
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+	if len(diffs) > 0 {
+		NewtUsage(nil, util.FmtNewtError(
+			"Target %s is not reproducible:\n    %s", t.FullName(),
+			strings.Join(diffs, "\n    ")))
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Target %s is reproducible; %d artifacts identical\n",
+		t.FullName(), len(files1))
+}
+
+// Maximum number of packages and files listed in the profile summary.
+const profileSummaryLimit = 10
+
+// writeProfile writes the build profile, if one was requested, and prints a
+// summary of the slowest parts of the build.
+func writeProfile() {
+	if profileFile == "" {
+		return
+	}
+
+	if err := profile.Write(profileFile); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "\n%s",
+		profile.Summary(profileSummaryLimit))
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"\nBuild profile written to %s\n", profileFile)
+}
+
+// addEventFlags adds the build event stream options to a command.
+func addEventFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&eventsFormat, "events", "",
+		"Emit machine-readable build events in the specified format (json)")
+	cmd.Flags().StringVar(&eventsOut, "events-out", "-",
+		"File to write build events to (\"-\" for stdout; other output "+
+			"then goes to stderr)")
+}
+
+// openEventStream starts the build event stream if the user requested one.
+func openEventStream() {
+	if eventsFormat == "" {
+		return
+	}
+
+	if err := event.Open(eventsFormat, eventsOut); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	// If events are written to stdout, the stream must contain nothing but
+	// events.  Send status messages and the output of child processes to
+	// stderr.
+	if eventsOut == "" || eventsOut == "-" {
+		util.SetStdout(os.Stderr)
+	}
+}
 
 func buildRunCmd(cmd *cobra.Command, args []string, printShellCmds bool, executeShell bool) {
 	if len(args) < 1 {
@@ -117,6 +227,19 @@ func buildRunCmd(cmd *cobra.Command, args []string, printShellCmds bool, execute
 
 	TryGetProject()
 
+	openEventStream()
+	defer event.Close()
+
+	if profileFile != "" {
+		profile.Enable()
+	}
+
+	if verifyReproducible {
+		newtutil.NewtReproducible = true
+	}
+
+	defer useRemoteExecutor()()
+
 	// Verify and resolve each specified package.
 	targets, all, err := ResolveTargetsOrAll(args...)
 	if err != nil {
@@ -134,6 +257,7 @@ func buildRunCmd(cmd *cobra.Command, args []string, printShellCmds bool, execute
 		}
 	}
 
+	failedTargets := []string{}
 	for i, _ := range targets {
 		// Reset the global state for the next build.
 		// XXX: It is not good that this is necessary.  This is certainly going
@@ -161,7 +285,14 @@ func buildRunCmd(cmd *cobra.Command, args []string, printShellCmds bool, execute
 		}
 
 		if err := b.Build(); err != nil {
-			NewtUsage(nil, err)
+			if !newtutil.NewtKeepGoing {
+				NewtUsage(nil, err)
+			}
+
+			// Report the failure and move on to the next target.
+			util.ErrorMessage(util.VERBOSITY_QUIET, "%s\n", err.Error())
+			failedTargets = append(failedTargets, t.FullName())
+			continue
 		}
 
 		// Produce bare "imageless" manifest.
@@ -175,6 +306,18 @@ func buildRunCmd(cmd *cobra.Command, args []string, printShellCmds bool, execute
 
 		util.StatusMessage(util.VERBOSITY_DEFAULT,
 			"Target successfully built: %s\n", t.Name())
+
+		if verifyReproducible {
+			verifyTargetReproducible(t, b)
+		}
+	}
+
+	reportCacheStats()
+	writeProfile()
+
+	if len(failedTargets) > 0 {
+		NewtUsage(nil, util.FmtNewtError("Failed to build target(s): %s",
+			strings.Join(failedTargets, " ")))
 	}
 }
 
@@ -237,6 +380,8 @@ func testRunCmd(cmd *cobra.Command, args []string, exclude string, executeShell
 
 	proj := TryGetProject()
 
+	defer useRemoteExecutor()()
+
 	// Verify and resolve each specified package.
 	testAll := false
 	packs := []*pkg.LocalPackage{}
@@ -323,6 +468,8 @@ func testRunCmd(cmd *cobra.Command, args []string, exclude string, executeShell
 		}
 	}
 
+	reportCacheStats()
+
 	passStr := fmt.Sprintf("Passed tests: [%s]", PackageNameList(passedPkgs))
 	failStr := fmt.Sprintf("Failed tests: [%s]", PackageNameList(failedPkgs))
 
@@ -443,6 +590,26 @@ func AddBuildCommands(cmd *cobra.Command) {
 	buildCmd.Flags().BoolVar(&executeShell, "executeShell", false,
 		"Execute build command using /bin/sh (Linux and MacOS only)")
 
+	buildCmd.Flags().BoolVarP(&newtutil.NewtKeepGoing, "keep-going", "k",
+		false, "Compile every file even if some fail; report all errors")
+	addEventFlags(buildCmd)
+	addRemoteFlag(buildCmd)
+	buildCmd.Flags().BoolVar(&newtutil.NewtReproducible, "reproducible",
+		false, "Remove host-specific paths and timestamps from build "+
+			"outputs")
+	buildCmd.Flags().BoolVar(&verifyReproducible, "verify-reproducible",
+		false, "Build each target a second time in a separate output "+
+			"directory and verify that the results are identical; implies "+
+			"--reproducible")
+	buildCmd.Flags().StringVar(&profileFile, "profile", "",
+		"Write a Chrome trace-event timing profile of the build to the "+
+			"specified file")
+	buildCmd.Flags().StringSliceVar(&newtutil.NewtSyscfgExport,
+		"syscfg-export", nil,
+		"Also write the resolved syscfg in the specified comma-separated "+
+			"formats to the target's generated/export directory ("+
+			strings.Join(syscfg.ExportFormats, ", ")+")")
+
 	cmd.AddCommand(buildCmd)
 	AddTabCompleteFn(buildCmd, func() []string {
 		return append(targetList(), "all")
@@ -470,6 +637,9 @@ func AddBuildCommands(cmd *cobra.Command) {
 	testCmd.Flags().StringVarP(&exclude, "exclude", "e", "", "Comma separated list of packages to exclude")
 	testCmd.Flags().BoolVar(&executeShell, "executeShell", false,
 		"Execute build command using /bin/sh (Linux and MacOS only)")
+	testCmd.Flags().BoolVarP(&newtutil.NewtKeepGoing, "keep-going", "k",
+		false, "Compile every file even if some fail; report all errors")
+	addRemoteFlag(testCmd)
 	cmd.AddCommand(testCmd)
 	AddTabCompleteFn(testCmd, func() []string {
 		return append(testablePkgList(), "all", "allexcept")
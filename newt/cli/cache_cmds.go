@@ -0,0 +1,203 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/dachalco/mynewt-newt/newt/cache"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+func cacheSizeString(size int64) string {
+	switch {
+	case size >= 1024*1024*1024:
+		return fmt.Sprintf("%.1fG", float64(size)/(1024*1024*1024))
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1fM", float64(size)/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%.1fK", float64(size)/1024)
+	default:
+		return fmt.Sprintf("%d", size)
+	}
+}
+
+func cacheHitRate(hits int64, misses int64) string {
+	if hits+misses == 0 {
+		return "n/a"
+	}
+
+	return fmt.Sprintf("%.1f%%", float64(hits)*100/float64(hits+misses))
+}
+
+// reportCacheStats prints the compile cache statistics for the current newt
+// invocation and adds them to the persistent totals.
+func reportCacheStats() {
+	if !cache.Enabled() {
+		return
+	}
+
+	stats := cache.CurStats()
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Compile cache: %d hits, %d misses (hit rate: %s)\n",
+		stats.Hits, stats.Misses, cacheHitRate(stats.Hits, stats.Misses))
+
+	if err := cache.FlushStats(); err != nil {
+		log.Warnf("Failed to update compile cache statistics: %s",
+			err.Error())
+	}
+}
+
+func ensureCacheEnabled() {
+	if !cache.Enabled() {
+		NewtUsage(nil, util.NewNewtError(
+			"Compile cache not configured; set \"build_cache.dir\" in "+
+				"$HOME/.newt/newtrc.yml"))
+	}
+}
+
+func cacheStatsRunCmd(cmd *cobra.Command, args []string) {
+	ensureCacheEnabled()
+
+	usage, err := cache.ReadUsage()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	stats, err := cache.ReadStats()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	maxSize, err := cache.MaxSize()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	maxSizeStr := "unlimited"
+	if maxSize > 0 {
+		maxSizeStr = cacheSizeString(maxSize)
+	}
+
+	util.StatusMessage(util.VERBOSITY_QUIET,
+		"Cache directory: %s\n", cache.Dir())
+	util.StatusMessage(util.VERBOSITY_QUIET,
+		"Entries:         %d\n", usage.NumEntries)
+	util.StatusMessage(util.VERBOSITY_QUIET,
+		"Size:            %s (max: %s)\n",
+		cacheSizeString(usage.TotalSize), maxSizeStr)
+	util.StatusMessage(util.VERBOSITY_QUIET,
+		"Hits:            %d\n", stats.Hits)
+	util.StatusMessage(util.VERBOSITY_QUIET,
+		"Misses:          %d\n", stats.Misses)
+	util.StatusMessage(util.VERBOSITY_QUIET,
+		"Hit rate:        %s\n", cacheHitRate(stats.Hits, stats.Misses))
+}
+
+func cacheCleanRunCmd(cmd *cobra.Command, args []string) {
+	ensureCacheEnabled()
+
+	if err := cache.Clean(); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Compile cache cleaned: %s\n", cache.Dir())
+}
+
+func cachePruneRunCmd(cmd *cobra.Command, args []string, maxSizeStr string) {
+	ensureCacheEnabled()
+
+	var maxSize int64
+	var err error
+	if maxSizeStr != "" {
+		maxSize, err = cache.ParseSize(maxSizeStr)
+	} else {
+		maxSize, err = cache.MaxSize()
+		if err == nil && maxSize == 0 {
+			err = util.NewNewtError("No maximum size specified; use " +
+				"--max-size or set \"build_cache.max_size\" in " +
+				"$HOME/.newt/newtrc.yml")
+		}
+	}
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	removed, err := cache.Prune(maxSize)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Removed %d entries from compile cache\n", removed)
+}
+
+func AddCacheCommands(cmd *cobra.Command) {
+	cacheHelpText := FormatHelp(`Manage the compile cache.  The cache
+		directory is configured with the "build_cache.dir" setting in
+		$HOME/.newt/newtrc.yml.`)
+
+	cacheCmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the compile cache",
+		Long:  cacheHelpText,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+		},
+	}
+
+	cmd.AddCommand(cacheCmd)
+
+	statsCmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Display compile cache usage and hit statistics",
+		Run:   cacheStatsRunCmd,
+	}
+
+	cacheCmd.AddCommand(statsCmd)
+
+	cleanCmd := &cobra.Command{
+		Use:   "clean",
+		Short: "Delete all entries from the compile cache",
+		Run:   cacheCleanRunCmd,
+	}
+
+	cacheCmd.AddCommand(cleanCmd)
+
+	var maxSize string
+	pruneCmd := &cobra.Command{
+		Use:   "prune [--max-size <size>]",
+		Short: "Delete least recently used compile cache entries",
+		Example: "  newt cache prune --max-size 2G\n" +
+			"  newt cache prune --max-size 500M",
+		Run: func(cmd *cobra.Command, args []string) {
+			cachePruneRunCmd(cmd, args, maxSize)
+		},
+	}
+	pruneCmd.Flags().StringVar(&maxSize, "max-size", "",
+		"Maximum cache size (e.g., 500M, 2G); defaults to "+
+			"\"build_cache.max_size\" from newtrc.yml")
+
+	cacheCmd.AddCommand(pruneCmd)
+}
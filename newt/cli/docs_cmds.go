@@ -20,9 +20,12 @@
 package cli
 
 import (
+	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/dachalco/mynewt-newt/newt/docs"
+	"github.com/dachalco/mynewt-newt/util"
 	"github.com/spf13/cobra"
 )
 
@@ -32,6 +35,35 @@ func docsBuildRunCmd(cmd *cobra.Command, args []string) {
 	db.Build(wd + "/_build")
 }
 
+func docsSettingsRunCmd(cmd *cobra.Command, args []string, format string) {
+	if len(args) > 1 {
+		NewtUsage(cmd, nil)
+	}
+
+	proj := TryGetProject()
+
+	pds, err := docs.CollectPkgDocs(proj)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	out, err := docs.RenderSettings(pds, format)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	if len(args) == 0 {
+		os.Stdout.Write(out)
+		return
+	}
+
+	if err := ioutil.WriteFile(args[0], out, 0644); err != nil {
+		NewtUsage(nil, util.ChildNewtError(err))
+	}
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Wrote documentation for %d packages to %s\n", len(pds), args[0])
+}
+
 func AddDocsCommands(cmd *cobra.Command) {
 	docsCmdHelpText := ""
 	docsCmdHelpEx := ""
@@ -57,4 +89,28 @@ func AddDocsCommands(cmd *cobra.Command) {
 	}
 
 	docsCmd.AddCommand(buildCmd)
+
+	var settingsFormat string
+	settingsHelpText := "Generate a reference of every package in every " +
+		"installed repo: its description, the syscfg settings it defines " +
+		"(with defaults, types, ranges, choices, restrictions and " +
+		"deprecation status), the APIs it provides and requires, and its " +
+		"init and shutdown functions.  The reference is written to " +
+		"<outfile>, or to stdout if no file is specified."
+
+	settingsCmd := &cobra.Command{
+		Use:   "settings [<outfile>]",
+		Short: "Generate a package and syscfg setting reference",
+		Long:  settingsHelpText,
+		Example: "  newt docs settings --format html settings.html\n" +
+			"  newt docs settings --format rst > settings.rst",
+		Run: func(cmd *cobra.Command, args []string) {
+			docsSettingsRunCmd(cmd, args, settingsFormat)
+		},
+	}
+	settingsCmd.Flags().StringVar(&settingsFormat, "format",
+		docs.SETTINGS_FORMAT_MARKDOWN,
+		"Output format ("+strings.Join(docs.SettingsFormats, ", ")+")")
+
+	docsCmd.AddCommand(settingsCmd)
 }
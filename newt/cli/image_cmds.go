@@ -22,14 +22,17 @@ package cli
 import (
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
 
 	"github.com/apache/mynewt-artifact/image"
 	"github.com/apache/mynewt-artifact/sec"
 	"github.com/dachalco/mynewt-newt/newt/builder"
+	"github.com/dachalco/mynewt-newt/newt/event"
 	"github.com/dachalco/mynewt-newt/newt/imgprod"
 	"github.com/dachalco/mynewt-newt/newt/newtutil"
+	"github.com/dachalco/mynewt-newt/newt/sbom"
 	"github.com/dachalco/mynewt-newt/util"
 )
 
@@ -41,6 +44,7 @@ var encKeyIndex int
 var hdrPad int
 var imagePad int
 var sections string
+var imageSbomFormat string
 
 // @return                      keys, key ID, error
 func parseKeyArgs(args []string) ([]sec.PrivSignKey, uint8, error) {
@@ -90,8 +94,17 @@ func createImageRunCmd(cmd *cobra.Command, args []string) {
 		useV2 = true
 	}
 
+	if imageSbomFormat != "" {
+		if err := checkSbomFormat(imageSbomFormat); err != nil {
+			NewtUsage(cmd, err)
+		}
+	}
+
 	TryGetProject()
 
+	openEventStream()
+	defer event.Close()
+
 	targetName := args[0]
 	t := ResolveTarget(targetName)
 	if t == nil {
@@ -137,10 +150,10 @@ func createImageRunCmd(cmd *cobra.Command, args []string) {
 
 	if useV1 {
 		err = imgprod.ProduceAllV1(b, ver, keys, encKeyFilename, encKeyIndex,
-			hdrPad, imagePad, sections, useLegacyTLV)
+			hdrPad, imagePad, sections, useLegacyTLV, imageSbomFormat)
 	} else {
 		err = imgprod.ProduceAll(b, ver, keys, encKeyFilename, encKeyIndex,
-			hdrPad, imagePad, sections, useLegacyTLV)
+			hdrPad, imagePad, sections, useLegacyTLV, imageSbomFormat)
 	}
 	if err != nil {
 		NewtUsage(nil, err)
@@ -209,6 +222,13 @@ func AddImageCommands(cmd *cobra.Command) {
 	createImageCmd.PersistentFlags().BoolVarP(&useLegacyTLV,
 		"legacy-tlvs", "L", false, "Use legacy TLV values for NONCE and SECRET_ID")
 
+	createImageCmd.PersistentFlags().StringVar(&imageSbomFormat,
+		"sbom", "", "Also generate an SBOM in the specified format ("+
+			strings.Join(sbom.Formats, ", ")+") and reference it from "+
+			"the manifest")
+
+	addEventFlags(createImageCmd)
+
 	cmd.AddCommand(createImageCmd)
 	AddTabCompleteFn(createImageCmd, targetList)
 
@@ -26,6 +26,7 @@ import (
 
 	"github.com/apache/mynewt-artifact/image"
 	"github.com/apache/mynewt-artifact/sec"
+	"github.com/dachalco/mynewt-newt/newt/event"
 	"github.com/dachalco/mynewt-newt/newt/imgprod"
 	"github.com/dachalco/mynewt-newt/newt/newtutil"
 	"github.com/dachalco/mynewt-newt/newt/parse"
@@ -46,6 +47,9 @@ func runRunCmd(cmd *cobra.Command, args []string) {
 
 	TryGetProject()
 
+	openEventStream()
+	defer event.Close()
+
 	b, err := TargetBuilderForTargetOrUnittest(args[0])
 	if err != nil {
 		NewtUsage(cmd, err)
@@ -106,10 +110,10 @@ func runRunCmd(cmd *cobra.Command, args []string) {
 
 			if useV1 {
 				err = imgprod.ProduceAllV1(b, ver, keys, encKeyFilename, encKeyIndex,
-					hdrPad, imagePad, sections, useLegacyTLV)
+					hdrPad, imagePad, sections, useLegacyTLV, "")
 			} else {
 				err = imgprod.ProduceAll(b, ver, keys, encKeyFilename, encKeyIndex,
-					hdrPad, imagePad, sections, useLegacyTLV)
+					hdrPad, imagePad, sections, useLegacyTLV, "")
 			}
 			if err != nil {
 				NewtUsage(nil, err)
@@ -171,6 +175,8 @@ func AddRunCommands(cmd *cobra.Command) {
 	runCmd.PersistentFlags().StringVarP(&sections,
 		"sections", "S", "", "Section names for TLVs, comma delimited")
 
+	addEventFlags(runCmd)
+
 	cmd.AddCommand(runCmd)
 	AddTabCompleteFn(runCmd, func() []string {
 		return append(targetList(), unittestList()...)
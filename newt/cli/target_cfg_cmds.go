@@ -26,6 +26,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"sort"
 	"strings"
 
@@ -33,7 +34,10 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/dachalco/mynewt-newt/newt/builder"
+	"github.com/dachalco/mynewt-newt/newt/cfgedit"
+	"github.com/dachalco/mynewt-newt/newt/cfglint"
 	"github.com/dachalco/mynewt-newt/newt/dump"
+	"github.com/dachalco/mynewt-newt/newt/explain"
 	"github.com/dachalco/mynewt-newt/newt/logcfg"
 	"github.com/dachalco/mynewt-newt/newt/newtutil"
 	"github.com/dachalco/mynewt-newt/newt/pkg"
@@ -73,6 +77,11 @@ func printSetting(entry syscfg.CfgEntry) {
 			"    * Copied from: %s\n",
 			entry.ValueRefName)
 	}
+	if len(entry.DerivedExpr) > 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"    * Derived from: %s\n",
+			entry.DerivedExpr)
+	}
 }
 
 func printBriefSetting(entry syscfg.CfgEntry) {
@@ -90,6 +99,10 @@ func printBriefSetting(entry syscfg.CfgEntry) {
 		s := fmt.Sprintf("copied from %s", entry.ValueRefName)
 		extras = append(extras, s)
 	}
+	if len(entry.DerivedExpr) > 0 {
+		s := fmt.Sprintf("derived from %s", entry.DerivedExpr)
+		extras = append(extras, s)
+	}
 
 	if len(extras) > 0 {
 		util.StatusMessage(util.VERBOSITY_DEFAULT, " (%s)",
@@ -201,7 +214,16 @@ func yamlPkgCfg(w io.Writer, pkgName string, cfg syscfg.Cfg,
 
 	fmt.Fprintf(w, "    ### %s\n", pkgName)
 	for _, name := range settingNames {
-		fmt.Fprintf(w, "    %s: '%s'\n", name, cfg.Settings[name].Value)
+		entry := cfg.Settings[name]
+
+		// Derived settings cannot be overridden.
+		if entry.DerivedExpr != "" {
+			fmt.Fprintf(w, "    # %s: derived from `%s`\n", name,
+				entry.DerivedExpr)
+			continue
+		}
+
+		fmt.Fprintf(w, "    %s: '%s'\n", name, entry.Value)
 	}
 }
 
@@ -669,6 +691,110 @@ func targetSysdownBriefCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+func targetConfigWhyCmd(cmd *cobra.Command, args []string, jsonOut bool) {
+	if len(args) != 2 {
+		NewtUsage(cmd,
+			util.NewNewtError("Must specify a target and a setting name"))
+	}
+
+	TryGetProject()
+
+	b, err := TargetBuilderForTargetOrUnittest(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	ex, err := explain.Explain(b, args[1])
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if jsonOut {
+		j, err := ex.JSON()
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s\n", string(j))
+	} else {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s", ex.Text())
+	}
+}
+
+func targetConfigExportCmd(cmd *cobra.Command, args []string,
+	format string) {
+
+	if len(args) != 1 {
+		NewtUsage(cmd,
+			util.NewNewtError("Must specify exactly one target or unittest"))
+	}
+
+	TryGetProject()
+
+	b, err := TargetBuilderForTargetOrUnittest(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	res := targetBuilderConfigResolve(b)
+
+	out, err := res.Cfg.Export(format)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	os.Stdout.Write(out)
+}
+
+func targetConfigLintCmd(cmd *cobra.Command, args []string, jsonOut bool) {
+	if len(args) != 1 {
+		NewtUsage(cmd,
+			util.NewNewtError("Must specify exactly one target or unittest"))
+	}
+
+	TryGetProject()
+
+	b, err := TargetBuilderForTargetOrUnittest(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	report, err := cfglint.Lint(b)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if jsonOut {
+		j, err := report.JSON()
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s\n", string(j))
+	} else {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s", report.Text())
+	}
+}
+
+func targetConfigEditCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd,
+			util.NewNewtError("Must specify exactly one target or unittest"))
+	}
+
+	TryGetProject()
+
+	b, err := TargetBuilderForTargetOrUnittest(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	e, err := cfgedit.New(b)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	e.Run(os.Stdin, os.Stdout)
+}
+
 func targetConfigInitCmd(cmd *cobra.Command, args []string) {
 	if len(args) < 1 {
 		NewtUsage(cmd,
@@ -763,6 +889,39 @@ func targetDumpCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+func targetDiffCmd(cmd *cobra.Command, args []string, jsonOut bool) {
+	if len(args) != 2 {
+		NewtUsage(cmd,
+			util.NewNewtError("Must specify exactly two targets to compare"))
+	}
+
+	TryGetProject()
+
+	rpts := make([]dump.Report, len(args))
+	for i, arg := range args {
+		b, err := TargetBuilderForTargetOrUnittest(arg)
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+
+		rpts[i], err = dump.NewReport(b)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+	}
+
+	d := dump.NewDiff(rpts[0], rpts[1])
+	if jsonOut {
+		s, err := d.JSON()
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s", s)
+	} else {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s", d.Text())
+	}
+}
+
 func targetCfgCmdAll() []*cobra.Command {
 	cmds := []*cobra.Command{}
 
@@ -815,6 +974,87 @@ func targetCfgCmdAll() []*cobra.Command {
 		return append(targetList(), unittestList()...)
 	})
 
+	configEditCmd := &cobra.Command{
+		Use:   "edit <target>",
+		Short: "Interactively edit a target's system configuration",
+		Long: "Interactively edit a target's system configuration.  " +
+			"Settings are listed by defining package and can be searched.  " +
+			"Edits are checked against the setting restrictions as they " +
+			"are made and are saved to the target's syscfg.yml file.",
+		Run: targetConfigEditCmd,
+	}
+
+	configCmd.AddCommand(configEditCmd)
+	AddTabCompleteFn(configEditCmd, func() []string {
+		return append(targetList(), unittestList()...)
+	})
+
+	var exportFormat string
+	configExportCmd := &cobra.Command{
+		Use:   "export <target>",
+		Short: "Export a target's resolved system configuration",
+		Long: "Export a target's resolved system configuration for use by " +
+			"host-side tools.  Every setting is emitted with its value, " +
+			"type, and defining package.  The same files can be produced " +
+			"during a build with \"newt build --syscfg-export\".",
+		Example: "  newt target config export my_target --format json\n" +
+			"  newt target config export my_target --format python > syscfg.py",
+		Run: func(cmd *cobra.Command, args []string) {
+			targetConfigExportCmd(cmd, args, exportFormat)
+		},
+	}
+	configExportCmd.Flags().StringVar(&exportFormat, "format",
+		syscfg.EXPORT_FORMAT_JSON,
+		"Output format ("+strings.Join(syscfg.ExportFormats, ", ")+")")
+
+	configCmd.AddCommand(configExportCmd)
+	AddTabCompleteFn(configExportCmd, func() []string {
+		return append(targetList(), unittestList()...)
+	})
+
+	var lintJson bool
+	configLintCmd := &cobra.Command{
+		Use:   "lint <target>",
+		Short: "Find unused and ineffective syscfg settings",
+		Long: "Find questionable system configuration in a target: " +
+			"settings that no source file or YAML expression references, " +
+			"overrides that don't change a setting's value, overrides " +
+			"by the target or app that are themselves overridden, " +
+			"overrides of settings defined by packages that aren't in " +
+			"the build, and " +
+			"deprecated settings that are still used in source code.",
+		Run: func(cmd *cobra.Command, args []string) {
+			targetConfigLintCmd(cmd, args, lintJson)
+		},
+	}
+	configLintCmd.Flags().BoolVar(&lintJson, "json", false,
+		"Produce JSON output")
+
+	configCmd.AddCommand(configLintCmd)
+	AddTabCompleteFn(configLintCmd, func() []string {
+		return append(targetList(), unittestList()...)
+	})
+
+	var whyJson bool
+	configWhyCmd := &cobra.Command{
+		Use:   "why <target> <setting>",
+		Short: "Explain how a setting acquired its value",
+		Long: "Explain how a setting acquired its value: the packages " +
+			"that define and override it, why each of those packages is " +
+			"part of the build, and the conditional expressions and " +
+			"restrictions that involve the setting.",
+		Run: func(cmd *cobra.Command, args []string) {
+			targetConfigWhyCmd(cmd, args, whyJson)
+		},
+	}
+	configWhyCmd.Flags().BoolVar(&whyJson, "json", false,
+		"Produce JSON output")
+
+	configCmd.AddCommand(configWhyCmd)
+	AddTabCompleteFn(configWhyCmd, func() []string {
+		return append(targetList(), unittestList()...)
+	})
+
 	configInitCmd := &cobra.Command{
 		Use:   "init",
 		Short: "Populate a target's system configuration file",
@@ -953,5 +1193,29 @@ func targetCfgCmdAll() []*cobra.Command {
 		return append(targetList(), unittestList()...)
 	})
 
+	diffHelpText := "Compare the resolved configuration of two targets.  " +
+		"Reports packages that are only present in one target, settings " +
+		"with different values (along with the packages that set them), " +
+		"sysinit and sysdown functions that were added, removed, or " +
+		"reordered, API providers that differ, and flash area differences."
+
+	var diffJson bool
+	diffCmd := &cobra.Command{
+		Use:     "diff <target-a> <target-b>",
+		Short:   "Compare two targets' resolved configuration",
+		Long:    diffHelpText,
+		Example: "  newt target diff my_target1 my_target2 --json",
+		Run: func(cmd *cobra.Command, args []string) {
+			targetDiffCmd(cmd, args, diffJson)
+		},
+	}
+	diffCmd.Flags().BoolVar(&diffJson, "json", false,
+		"Print the differences in JSON")
+
+	cmds = append(cmds, diffCmd)
+	AddTabCompleteFn(diffCmd, func() []string {
+		return append(targetList(), unittestList()...)
+	})
+
 	return cmds
 }
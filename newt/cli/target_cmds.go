@@ -30,9 +30,11 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/dachalco/mynewt-newt/newt/builder"
+	"github.com/dachalco/mynewt-newt/newt/license"
 	"github.com/dachalco/mynewt-newt/newt/newtutil"
 	"github.com/dachalco/mynewt-newt/newt/pkg"
 	"github.com/dachalco/mynewt-newt/newt/resolve"
+	"github.com/dachalco/mynewt-newt/newt/sbom"
 	"github.com/dachalco/mynewt-newt/newt/syscfg"
 	"github.com/dachalco/mynewt-newt/newt/target"
 	"github.com/dachalco/mynewt-newt/util"
@@ -40,6 +42,13 @@ import (
 
 var amendDelete bool = false
 var showAll bool = false
+var sbomFormat string
+var sbomOutput string
+var traceFormat string
+var traceOutput string
+var depGraphFormat string
+var depGraphCollapse string
+var depGraphDepth int
 
 // target variables that can have values amended with the amend command.
 var amendVars = []string{"aflags", "cflags", "cxxflags", "lflags", "syscfg"}
@@ -173,6 +182,32 @@ func amendBuildFlags(kv []string, t *target.Target) error {
 	return nil
 }
 
+// targetApiRulesString resolves the specified target and describes the
+// supplier chosen for each API, along with the rule that chose it.
+func targetApiRulesString(t *target.Target) string {
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		util.OneTimeWarningError(err)
+		return ""
+	}
+
+	res, err := b.Resolve()
+	if err != nil {
+		util.OneTimeWarningError(err)
+		return ""
+	}
+
+	rules := map[string]string{}
+	for api, rpkg := range res.ApiMap {
+		if rpkg != nil {
+			rules[api] = fmt.Sprintf("%s (%s)",
+				rpkg.Lpkg.FullName(), res.ApiRules[api])
+		}
+	}
+
+	return syscfg.KeyValueToStr(rules)
+}
+
 func targetShowCmd(cmd *cobra.Command, args []string) {
 	TryGetProject()
 	targetNames := []string{}
@@ -233,6 +268,12 @@ func targetShowCmd(cmd *cobra.Command, args []string) {
 		kvPairs["lflags"] = pkgVarSliceString(target.Package(), "pkg.lflags")
 		kvPairs["aflags"] = pkgVarSliceString(target.Package(), "pkg.aflags")
 
+		sels, err := target.Package().PkgY.GetValStringMapString(
+			"pkg.api_select", nil)
+		util.OneTimeWarningError(err)
+		kvPairs["api_select"] = syscfg.KeyValueToStr(sels)
+		kvPairs["api_rules"] = targetApiRulesString(target)
+
 		keys := []string{}
 		for k, _ := range kvPairs {
 			keys = append(keys, k)
@@ -595,6 +636,11 @@ func targetDepCmd(cmd *cobra.Command, args []string) {
 		NewtUsage(nil, err)
 	}
 
+	types, err := b.DepGraphPkgTypes()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
 	// If user specified any package names, only include specified packages.
 	if len(args) > 1 {
 		rpkgs, err := ResolveRpkgs(res, args[1:])
@@ -611,9 +657,18 @@ func targetDepCmd(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	dg, types, err = builder.CollapseDepGraph(dg, types, depGraphCollapse,
+		depGraphDepth)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
 	if len(dg) > 0 {
-		util.StatusMessage(util.VERBOSITY_DEFAULT,
-			builder.DepGraphText(dg)+"\n")
+		str, err := builder.RenderDepGraph(dg, types, depGraphFormat, false)
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s", str)
 	}
 }
 
@@ -639,6 +694,11 @@ func targetRevdepCmd(cmd *cobra.Command, args []string) {
 		NewtUsage(nil, err)
 	}
 
+	types, err := b.DepGraphPkgTypes()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
 	// If user specified any package names, only include specified packages.
 	if len(args) > 1 {
 		rpkgs, err := ResolveRpkgs(res, args[1:])
@@ -655,10 +715,213 @@ func targetRevdepCmd(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	dg, types, err = builder.CollapseDepGraph(dg, types, depGraphCollapse,
+		depGraphDepth)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
 	if len(dg) > 0 {
+		str, err := builder.RenderDepGraph(dg, types, depGraphFormat, true)
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s", str)
+	}
+}
+
+// checkTraceFormat ensures the specified string is a supported resolve trace
+// format.
+func checkTraceFormat(format string) error {
+	for _, f := range resolve.TraceFormats {
+		if f == format {
+			return nil
+		}
+	}
+
+	return util.FmtNewtError("Invalid trace format \"%s\"; must be one of: %s",
+		format, strings.Join(resolve.TraceFormats, ", "))
+}
+
+func targetResolveTraceCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd,
+			util.NewNewtError("Must specify target or unittest name"))
+	}
+
+	if err := checkTraceFormat(traceFormat); err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	TryGetProject()
+
+	b, err := TargetBuilderForTargetOrUnittest(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	// Emit the trace even if resolution fails; it shows how far the resolver
+	// got.
+	trace := b.TraceResolve()
+	_, resErr := b.Resolve()
+
+	str, err := trace.Render(traceFormat)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if traceOutput == "" {
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s", str)
+	} else {
+		if err := ioutil.WriteFile(traceOutput, []byte(str), 0644); err != nil {
+			NewtUsage(nil, util.ChildNewtError(err))
+		}
+	}
+
+	if resErr != nil {
+		NewtUsage(nil, resErr)
+	}
+}
+
+// checkSbomFormat ensures the specified string is a supported SBOM format.
+func checkSbomFormat(format string) error {
+	for _, f := range sbom.Formats {
+		if f == format {
+			return nil
+		}
+	}
+
+	return util.FmtNewtError("Invalid SBOM format \"%s\"; must be one of: %s",
+		format, strings.Join(sbom.Formats, ", "))
+}
+
+func targetSbomCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	if err := checkSbomFormat(sbomFormat); err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	TryGetProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	s, err := sbom.Collect(b)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if sbomOutput == "" {
+		err = s.WriteStdout(sbomFormat)
+	} else {
+		err = s.Write(sbomFormat, sbomOutput)
+	}
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+}
+
+func licenseFindingString(f license.Finding) string {
+	s := f.License + " (" + f.Source
+	if f.Path != "" {
+		s += ": " + util.TryRelPath(f.Path)
+	}
+	return s + ")"
+}
+
+func targetLicenseCheckCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	TryGetProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	allow := license.AllowList(t)
+	if len(allow) == 0 {
+		NewtUsage(nil, util.FmtNewtError("No license allow-list for target "+
+			"\"%s\"; specify \"project.license_allow\" in project.yml or "+
+			"\"target.license_allow\" in target.yml", t.FullName()))
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	rpt, err := license.Check(b, allow)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if rpt.Sim {
 		util.StatusMessage(util.VERBOSITY_DEFAULT,
-			builder.RevdepGraphText(dg)+"\n")
+			"Target %s is a simulator target; no packages ship\n",
+			rpt.Target)
+		return
+	}
+
+	skipped := make([]string, 0, len(rpt.Skipped))
+	for name, _ := range rpt.Skipped {
+		skipped = append(skipped, name)
+	}
+	sort.Strings(skipped)
+	for _, name := range skipped {
+		util.StatusMessage(util.VERBOSITY_VERBOSE, "Skipping %s: %s\n",
+			name, rpt.Skipped[name])
 	}
+
+	for _, pr := range rpt.Checked {
+		strs := make([]string, len(pr.Findings))
+		for i, f := range pr.Findings {
+			strs[i] = licenseFindingString(f)
+		}
+		util.StatusMessage(util.VERBOSITY_VERBOSE, "%s: %s\n",
+			pr.Name, strings.Join(strs, ", "))
+	}
+
+	for _, v := range rpt.Violations {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"License not allowed: %s: %s\n    pulled in by: %s\n",
+			v.Pkg, licenseFindingString(v.Finding),
+			strings.Join(v.Chain, " --> "))
+	}
+
+	if len(rpt.Violations) > 0 {
+		NewtUsage(nil, util.FmtNewtError(
+			"Target %s links %d disallowed license(s); allowed: %s",
+			rpt.Target, len(rpt.Violations), strings.Join(allow, ", ")))
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"License check passed: %s (%d packages checked, %d skipped)\n",
+		rpt.Target, len(rpt.Checked), len(rpt.Skipped))
+}
+
+func addDepGraphFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&depGraphFormat, "format",
+		builder.DEPGRAPH_FORMAT_TEXT,
+		"Graph format ("+strings.Join(builder.DepGraphFormats, ", ")+")")
+	cmd.Flags().StringVar(&depGraphCollapse, "collapse",
+		builder.DEPGRAPH_COLLAPSE_NONE,
+		"Merge packages into one node per group ("+
+			strings.Join(builder.DepGraphCollapses, ", ")+")")
+	cmd.Flags().IntVar(&depGraphDepth, "collapse-depth", 2,
+		"Number of directories kept when collapsing by directory")
 }
 
 func AddTargetCommands(cmd *cobra.Command) {
@@ -806,20 +1069,33 @@ func AddTargetCommands(cmd *cobra.Command) {
 	AddTabCompleteFn(copyCmd, targetList)
 
 	depHelpText := "View a target's dependency graph."
+	depHelpText += "\n\nThe graph can be rendered as text, Graphviz (dot), " +
+		"Mermaid, or JSON.  Graph formats label each edge with the syscfg " +
+		"expression and the APIs that created it, and style each node by " +
+		"package type.  Large graphs can be collapsed into one node per " +
+		"repo, or per directory prefix of the depth given by " +
+		"--collapse-depth."
+	depHelpEx := "  newt target dep my_target1 --format dot | " +
+		"dot -Tsvg -o deps.svg\n"
+	depHelpEx += "  newt target dep my_target1 --format mermaid " +
+		"--collapse dir --collapse-depth 2"
 
 	depCmd := &cobra.Command{
-		Use:   "dep <target> [pkg-1] [pkg-2] [...]",
-		Short: "View target's dependency graph",
-		Long:  depHelpText,
-		Run:   targetDepCmd,
+		Use:     "dep <target> [pkg-1] [pkg-2] [...]",
+		Short:   "View target's dependency graph",
+		Long:    depHelpText,
+		Example: depHelpEx,
+		Run:     targetDepCmd,
 	}
+	addDepGraphFlags(depCmd)
 
 	targetCmd.AddCommand(depCmd)
 	AddTabCompleteFn(depCmd, func() []string {
 		return append(targetList(), unittestList()...)
 	})
 
-	revdepHelpText := "View a target's reverse-dependency graph."
+	revdepHelpText := "View a target's reverse-dependency graph.  See " +
+		"\"newt target dep\" for the available formats and collapse modes."
 
 	revdepCmd := &cobra.Command{
 		Use:   "revdep <target> [pkg-1] [pkg-2] [...]",
@@ -827,12 +1103,96 @@ func AddTargetCommands(cmd *cobra.Command) {
 		Long:  revdepHelpText,
 		Run:   targetRevdepCmd,
 	}
+	addDepGraphFlags(revdepCmd)
 
 	targetCmd.AddCommand(revdepCmd)
 	AddTabCompleteFn(revdepCmd, func() []string {
 		return append(targetList(), unittestList()...)
 	})
 
+	resolveTraceHelpText := "Trace how newt resolves a target's " +
+		"dependencies.  Resolution repeatedly loads package dependencies, " +
+		"reloads syscfg, and prunes orphan and imposter packages until " +
+		"nothing changes.  The trace lists each iteration: which package " +
+		"was added by which dependency and expression, which settings " +
+		"changed on a syscfg reload (and which new dependencies they " +
+		"enabled), and which packages were pruned and why.  Only the " +
+		"project-wide resolution is traced; the separate loader and app " +
+		"resolutions of split images are not."
+	resolveTraceHelpEx := "  newt target resolve-trace my_target1\n"
+	resolveTraceHelpEx += "  newt target resolve-trace my_target1 " +
+		"--format dot --output resolve.dot"
+
+	resolveTraceCmd := &cobra.Command{
+		Use:     "resolve-trace <target>",
+		Short:   "Trace a target's dependency resolution",
+		Long:    resolveTraceHelpText,
+		Example: resolveTraceHelpEx,
+		Run:     targetResolveTraceCmd,
+	}
+	resolveTraceCmd.Flags().StringVar(&traceFormat, "format",
+		resolve.TRACE_FORMAT_TEXT,
+		"Trace format ("+strings.Join(resolve.TraceFormats, ", ")+")")
+	resolveTraceCmd.Flags().StringVar(&traceOutput, "output", "",
+		"Write the trace to the specified file instead of stdout")
+
+	targetCmd.AddCommand(resolveTraceCmd)
+	AddTabCompleteFn(resolveTraceCmd, func() []string {
+		return append(targetList(), unittestList()...)
+	})
+
+	sbomHelpText := "Generate a software bill of materials (SBOM) for a " +
+		"target.  The SBOM lists every package in the target along with " +
+		"its repo, version, commit, and license.  A package's license is " +
+		"read from the \"pkg.license\" field in its pkg.yml file, or from " +
+		"its repo's LICENSE file if the field is absent.  If the target's " +
+		"images have been created, their hashes are included."
+	sbomHelpEx := "  newt target sbom my_target1\n"
+	sbomHelpEx += "  newt target sbom my_target1 --format cyclonedx-json " +
+		"--output my_target1.cdx.json"
+
+	sbomCmd := &cobra.Command{
+		Use:     "sbom <target-name>",
+		Short:   "Generate a software bill of materials for a target",
+		Long:    sbomHelpText,
+		Example: sbomHelpEx,
+		Run:     targetSbomCmd,
+	}
+	sbomCmd.Flags().StringVar(&sbomFormat, "format", sbom.FORMAT_SPDX_JSON,
+		"SBOM format ("+strings.Join(sbom.Formats, ", ")+")")
+	sbomCmd.Flags().StringVar(&sbomOutput, "output", "",
+		"Write the SBOM to the specified file instead of stdout")
+
+	targetCmd.AddCommand(sbomCmd)
+	AddTabCompleteFn(sbomCmd, targetList)
+
+	licenseCheckHelpText := "Verify that every package linked into a " +
+		"target's images has a license in the allow-list.  The allow-list " +
+		"is read from the \"target.license_allow\" setting in the " +
+		"target's target.yml file, or from the \"project.license_allow\" " +
+		"setting in project.yml if the target does not specify one.\n\n"
+	licenseCheckHelpText += "A package's licenses are its \"pkg.license\" " +
+		"field (or its repo's LICENSE file) plus any " +
+		"\"SPDX-License-Identifier\" headers in its source files.  Unit " +
+		"test and toolchain packages, packages only required by them, and " +
+		"all packages in simulator targets are not checked because they " +
+		"don't ship.  Each violation is reported along with the dependency " +
+		"chain that pulled the package in.  Add \"NOASSERTION\" to the " +
+		"allow-list to permit packages whose license cannot be determined."
+	licenseCheckHelpEx := "  newt target license-check my_target1\n"
+	licenseCheckHelpEx += "  newt target license-check -v my_target1"
+
+	licenseCheckCmd := &cobra.Command{
+		Use:     "license-check <target-name>",
+		Short:   "Check the licenses of a target's packages",
+		Long:    licenseCheckHelpText,
+		Example: licenseCheckHelpEx,
+		Run:     targetLicenseCheckCmd,
+	}
+
+	targetCmd.AddCommand(licenseCheckCmd)
+	AddTabCompleteFn(licenseCheckCmd, targetList)
+
 	for _, cmd := range targetCfgCmdAll() {
 		targetCmd.AddCommand(cmd)
 	}
@@ -0,0 +1,127 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/cobra"
+
+	"github.com/dachalco/mynewt-newt/newt/newtutil"
+	"github.com/dachalco/mynewt-newt/newt/remote"
+	"github.com/dachalco/mynewt-newt/newt/settings"
+	"github.com/dachalco/mynewt-newt/newt/toolchain"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+var remoteWorkers string
+
+// addRemoteFlag adds the remote compilation option to a command.
+func addRemoteFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&remoteWorkers, "remote", "",
+		"Compile on the specified comma-separated list of workers "+
+			"(<host>:<port>) started with \"newt worker\"")
+}
+
+// useRemoteExecutor configures remote compilation if the user requested it.
+// The returned function disconnects from the workers.
+func useRemoteExecutor() func() {
+	if remoteWorkers == "" {
+		return func() {}
+	}
+
+	addrs := []string{}
+	for _, addr := range strings.Split(remoteWorkers, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		NewtUsage(nil, util.NewNewtError("No remote workers specified"))
+	}
+
+	token := remote.Token()
+	if token == "" {
+		NewtUsage(nil, util.FmtNewtError(
+			"No remote token configured; set %s or \"remote.token\" in "+
+				"newtrc.yml", remote.TOKEN_ENV_VAR))
+	}
+
+	e := remote.NewExecutor(addrs, token)
+	toolchain.SetExecutor(e)
+
+	return func() {
+		toolchain.SetExecutor(toolchain.LocalExecutor{})
+		e.Close()
+	}
+}
+
+func workerRunCmd(cmd *cobra.Command, args []string, listenAddr string,
+	compilers []string) {
+
+	compilers = append(compilers,
+		cast.ToStringSlice(settings.NewtrcVal("remote", "compilers"))...)
+
+	err := remote.Serve(listenAddr, newtutil.NewtNumJobs, compilers,
+		remote.Token())
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+}
+
+func AddWorkerCommands(cmd *cobra.Command) {
+	workerHelpText := FormatHelp(`Run a remote compilation worker.  The
+		worker accepts preprocessed translation units from newt clients
+		invoked with "--remote <host>:<port>", compiles them with the local
+		toolchain, and returns the resulting object files.  The toolchain
+		must be installed at the same path as on the clients.`)
+	workerHelpText += "\n\n" + FormatHelp(`Clients must present a shared
+		token, read from the NEWT_REMOTE_TOKEN environment variable or the
+		"remote.token" setting in newtrc.yml on both ends.  The worker only
+		runs compilers listed with --compiler or in the "remote.compilers"
+		setting, drops preprocessor options, and only accepts -f, -m, -W, -O,
+		-g, and -std options whose values cannot name files.  The token,
+		sources, and objects are sent in plain text, so the worker must only
+		be reachable from a trusted network; otherwise, tunnel the
+		connections through SSH or a TLS proxy.  The number of concurrent
+		compilations is limited by the -j option.`)
+
+	var listenAddr string
+	var compilers []string
+	workerCmd := &cobra.Command{
+		Use:   "worker",
+		Short: "Run a remote compilation worker",
+		Long:  workerHelpText,
+		Example: "  newt worker --compiler arm-none-eabi-gcc\n" +
+			"  newt worker --compiler arm-none-eabi-gcc -j 16",
+		Run: func(cmd *cobra.Command, args []string) {
+			workerRunCmd(cmd, args, listenAddr, compilers)
+		},
+	}
+	workerCmd.Flags().StringVar(&listenAddr, "listen", remote.DEFAULT_ADDR,
+		"Address to listen for compile requests on")
+	workerCmd.Flags().StringArrayVar(&compilers, "compiler", nil,
+		"Compiler that clients may run, as named in their compiler.yml "+
+			"(may be repeated)")
+
+	cmd.AddCommand(workerCmd)
+}
@@ -0,0 +1,196 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/dachalco/mynewt-newt/newt/ycfg"
+	"github.com/dachalco/mynewt-newt/util"
+	"github.com/dachalco/mynewt-newt/yaml"
+)
+
+const overwriteSuffix = ".OVERWRITE"
+
+// importedSettings reads the settings that a configuration file pulls in via
+// `$import` directives, excluding the file's own settings.
+func importedSettings(path string) map[string]interface{} {
+	entries, err := readLineage(path)
+	if err != nil {
+		log.Debugf("Failed to read imports of %s: %s", path, err.Error())
+		return nil
+	}
+
+	yc := ycfg.NewYCfg(path)
+	for _, e := range entries[:len(entries)-1] {
+		for k, v := range e.Settings {
+			if err := yc.MergeFromFile(k, v, e.FileInfo); err != nil {
+				return nil
+			}
+		}
+	}
+
+	return yc.AllSettings()
+}
+
+// ownSettings determines which of a YCfg's settings belong in the specified
+// document rather than in the files it imports.  Imported values are omitted
+// unless the document already contains them or overrides them.  The returned
+// map is keyed by the document's own spelling of each key (e.g.,
+// "pkg.cflags.OVERWRITE").
+func ownSettings(doc *yaml.Document, settings map[string]interface{},
+	imported map[string]interface{}) map[string]interface{} {
+
+	own := map[string]interface{}{}
+
+	for k, v := range settings {
+		if strings.HasPrefix(k, "$") {
+			continue
+		}
+
+		if doc.Get(k+overwriteSuffix) != nil {
+			own[k+overwriteSuffix] = v
+			continue
+		}
+
+		iv, ok := imported[k]
+		if !ok {
+			own[k] = v
+			continue
+		}
+
+		node := doc.Get(k)
+		inFile := node != nil
+
+		if ss, ok := v.([]string); ok {
+			itfs := make([]interface{}, len(ss))
+			for i, s := range ss {
+				itfs[i] = s
+			}
+			v = itfs
+		}
+
+		switch vt := v.(type) {
+		case map[interface{}]interface{}:
+			im, _ := iv.(map[interface{}]interface{})
+
+			var fm map[interface{}]interface{}
+			if inFile {
+				fm, _ = node.Decode().(map[interface{}]interface{})
+			}
+
+			m := map[interface{}]interface{}{}
+			for mk, mv := range vt {
+				imv, imported := im[mk]
+				_, local := fm[mk]
+				if local || !imported || !yaml.ValuesEqual(imv, mv) {
+					m[mk] = mv
+				}
+			}
+			if len(m) > 0 || inFile {
+				own[k] = m
+			}
+
+		case []interface{}:
+			// Imported sequences are prepended to the file's own.
+			is, _ := iv.([]interface{})
+			if len(vt) >= len(is) &&
+				yaml.ValuesEqual(vt[:len(is)], is) {
+
+				rest := vt[len(is):]
+				if len(rest) > 0 || inFile {
+					own[k] = rest
+				}
+			} else {
+				own[k] = v
+			}
+
+		default:
+			if inFile || !yaml.ValuesEqual(iv, v) {
+				own[k] = v
+			}
+		}
+	}
+
+	return own
+}
+
+// SaveFile writes a set of settings (as produced by YCfg.AllSettings()) to a
+// YAML file.  If the file already exists, it is edited in place: only
+// entries whose values differ are rewritten, so comments, key order,
+// `$import` directives and untouched entries are preserved.  Settings that
+// come from imported files are not copied into the file.
+//
+// If keys is nil, the file's entries are synchronized with the settings:
+// entries absent from the settings are removed.  Otherwise, only the listed
+// top-level keys are written or removed.
+func SaveFile(path string, settings map[string]interface{},
+	keys []string) error {
+
+	src, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return util.ChildNewtError(err)
+	}
+
+	doc, err := yaml.ParseDocument(src)
+	if err != nil {
+		// The file can't be edited in place; regenerate it.
+		log.Debugf("Rewriting %s: %s", path, err.Error())
+		doc, _ = yaml.ParseDocument(nil)
+	}
+
+	var imported map[string]interface{}
+	if doc.Get(KEYWORD_IMPORT) != nil {
+		imported = importedSettings(path)
+	}
+	own := ownSettings(doc, settings, imported)
+
+	if keys == nil {
+		err = doc.Sync(own)
+	} else {
+		for _, k := range keys {
+			if doc.Get(k+overwriteSuffix) != nil {
+				k += overwriteSuffix
+			}
+			if v, ok := own[k]; ok {
+				err = doc.Set([]string{k}, v)
+			} else {
+				err = doc.Delete(k)
+			}
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return util.FmtNewtError("Failure editing \"%s\": %s", path,
+			err.Error())
+	}
+
+	if err := ioutil.WriteFile(path, doc.Bytes(), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,623 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package docs
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"github.com/dachalco/mynewt-newt/newt/flashmap"
+	"github.com/dachalco/mynewt-newt/newt/newtutil"
+	"github.com/dachalco/mynewt-newt/newt/pkg"
+	"github.com/dachalco/mynewt-newt/newt/project"
+	"github.com/dachalco/mynewt-newt/newt/syscfg"
+	"github.com/dachalco/mynewt-newt/newt/ycfg"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+const (
+	SETTINGS_FORMAT_MARKDOWN = "markdown"
+	SETTINGS_FORMAT_HTML     = "html"
+	SETTINGS_FORMAT_RST      = "rst"
+)
+
+var SettingsFormats = []string{
+	SETTINGS_FORMAT_MARKDOWN,
+	SETTINGS_FORMAT_HTML,
+	SETTINGS_FORMAT_RST,
+}
+
+// CondValue is a value that only applies when a syscfg expression is true.
+// An empty condition indicates an unconditional value.
+type CondValue struct {
+	Value string
+	Cond  string
+}
+
+// StageFunc is an init or shutdown function and its stage.
+type StageFunc struct {
+	Name  string
+	Stage string
+	Cond  string
+}
+
+// SettingDoc documents a single syscfg setting definition.
+type SettingDoc struct {
+	Name         string
+	Description  string
+	Default      string
+	Derived      string
+	Type         string
+	Range        string
+	Choices      []string
+	Restrictions []string
+	State        string
+}
+
+// PkgDoc documents a single package.
+type PkgDoc struct {
+	Name         string
+	Repo         string
+	Type         string
+	Description  string
+	Keywords     []string
+	Apis         []CondValue
+	ReqApis      []CondValue
+	InitFuncs    []StageFunc
+	DownFuncs    []StageFunc
+	Settings     []SettingDoc
+	Restrictions []string
+
+	// Why the package's syscfg could not be read; empty on success.
+	SyscfgError string
+}
+
+func condText(yc ycfg.YCfgEntry) string {
+	if yc.Expr == nil {
+		return ""
+	}
+	return yc.Expr.String()
+}
+
+// Reads every variant of a string list (e.g., "pkg.apis"), including those
+// that are conditional on syscfg settings.
+func readCondStrings(yc ycfg.YCfg, key string) []CondValue {
+	entries, err := yc.GetAll(key)
+	util.OneTimeWarningError(err)
+
+	var cvs []CondValue
+	for _, e := range entries {
+		for _, v := range cast.ToStringSlice(e.Value) {
+			cvs = append(cvs, CondValue{
+				Value: v,
+				Cond:  condText(e),
+			})
+		}
+	}
+
+	return cvs
+}
+
+// Reads every variant of a function-to-stage map (e.g., "pkg.init").
+func readStageFuncs(yc ycfg.YCfg, key string) []StageFunc {
+	entries, err := yc.GetAll(key)
+	util.OneTimeWarningError(err)
+
+	var sfs []StageFunc
+	for _, e := range entries {
+		m := cast.ToStringMapString(e.Value)
+
+		names := make([]string, 0, len(m))
+		for name, _ := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			sfs = append(sfs, StageFunc{
+				Name:  name,
+				Stage: m[name],
+				Cond:  condText(e),
+			})
+		}
+	}
+
+	return sfs
+}
+
+func settingDoc(entry syscfg.CfgEntry) SettingDoc {
+	sd := SettingDoc{
+		Name:        entry.Name,
+		Description: entry.Description,
+		Default:     entry.Value,
+		Derived:     entry.DerivedExpr,
+		Type:        entry.ValueType.String(),
+		Choices:     entry.ValidChoices,
+	}
+
+	// Report the value from the definition rather than any override by the
+	// defining package itself.
+	if len(entry.History) > 0 {
+		sd.Default = entry.History[0].Value
+	}
+
+	switch entry.SettingType {
+	case syscfg.CFG_SETTING_TYPE_TASK_PRIO, syscfg.CFG_SETTING_TYPE_FLASH_OWNER:
+		if sd.Type != "" {
+			sd.Type += ", "
+		}
+		sd.Type += entry.SettingType.String()
+	}
+
+	switch {
+	case entry.ValueMin != nil && entry.ValueMax != nil:
+		sd.Range = fmt.Sprintf("%d..%d", *entry.ValueMin, *entry.ValueMax)
+	case entry.ValueMin != nil:
+		sd.Range = fmt.Sprintf(">= %d", *entry.ValueMin)
+	case entry.ValueMax != nil:
+		sd.Range = fmt.Sprintf("<= %d", *entry.ValueMax)
+	}
+
+	for _, r := range entry.Restrictions {
+		if r.Code != syscfg.CFG_RESTRICTION_CODE_CHOICE {
+			sd.Restrictions = append(sd.Restrictions, r.Text())
+		}
+	}
+
+	if entry.State != syscfg.CFG_SETTING_STATE_GOOD {
+		sd.State = entry.State.String()
+	}
+
+	return sd
+}
+
+func pkgDoc(lpkg *pkg.LocalPackage) (PkgDoc, error) {
+	pd := PkgDoc{
+		Name: lpkg.FullName(),
+		Repo: lpkg.Repo().Name(),
+		Type: pkg.PackageTypeNames[lpkg.Type()],
+	}
+
+	if desc := lpkg.Desc(); desc != nil {
+		pd.Description = desc.Description
+		pd.Keywords = desc.Keywords
+	}
+
+	pd.Apis = readCondStrings(lpkg.PkgY, "pkg.apis")
+	pd.ReqApis = readCondStrings(lpkg.PkgY, "pkg.req_apis")
+	pd.InitFuncs = readStageFuncs(lpkg.PkgY, "pkg.init")
+	pd.DownFuncs = readStageFuncs(lpkg.PkgY, "pkg.down")
+
+	// Read the package's syscfg in isolation.  Conditional definitions are
+	// evaluated with every setting undefined.
+	cfg, err := syscfg.Read([]*pkg.LocalPackage{lpkg}, nil, nil,
+		map[string]string{}, flashmap.FlashMap{})
+	if err != nil {
+		return pd, err
+	}
+
+	for _, entry := range cfg.Settings {
+		if entry.PackageDef == lpkg {
+			pd.Settings = append(pd.Settings, settingDoc(entry))
+		}
+	}
+	sort.Slice(pd.Settings, func(i int, j int) bool {
+		return pd.Settings[i].Name < pd.Settings[j].Name
+	})
+
+	for _, r := range cfg.PackageRestrictions[lpkg.Name()] {
+		pd.Restrictions = append(pd.Restrictions, r.Text())
+	}
+
+	return pd, nil
+}
+
+// CollectPkgDocs documents every package in every installed repo.  Targets
+// are omitted; they configure a build rather than provide functionality.
+func CollectPkgDocs(proj *project.Project) ([]PkgDoc, error) {
+	var lpkgs []*pkg.LocalPackage
+	for _, p := range proj.PackagesOfType(-1) {
+		lpkg := p.(*pkg.LocalPackage)
+		if lpkg.Type() != pkg.PACKAGE_TYPE_TARGET {
+			lpkgs = append(lpkgs, lpkg)
+		}
+	}
+	lpkgs = pkg.SortLclPkgs(lpkgs)
+
+	pds := make([]PkgDoc, 0, len(lpkgs))
+	for _, lpkg := range lpkgs {
+		pd, err := pkgDoc(lpkg)
+		if err != nil {
+			// Don't let one bad syscfg.yml prevent documenting the other
+			// packages.
+			util.OneTimeWarning("failed to read syscfg for %s: %s",
+				lpkg.FullName(), strings.TrimSpace(err.Error()))
+			pd.SyscfgError = strings.TrimSpace(err.Error())
+		}
+		pds = append(pds, pd)
+	}
+
+	return pds, nil
+}
+
+// docWriter emits the elements of a reference document in a particular
+// markup language.
+type docWriter interface {
+	begin(title string)
+	heading(level int, text string, anchor string)
+	para(text string)
+	links(texts []string, anchors []string)
+	list(items []string)
+	table(hdr []string, rows [][]string)
+	end()
+}
+
+func anchorName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(r >= '0' && r <= '9') {
+
+			return r
+		}
+		return '-'
+	}, strings.TrimPrefix(name, "@"))
+}
+
+func condValueText(cv CondValue) string {
+	if cv.Cond == "" {
+		return cv.Value
+	}
+	return fmt.Sprintf("%s (if %s)", cv.Value, cv.Cond)
+}
+
+func writeStageFuncs(dw docWriter, title string, sfs []StageFunc) {
+	if len(sfs) == 0 {
+		return
+	}
+
+	rows := make([][]string, len(sfs))
+	for i, sf := range sfs {
+		rows[i] = []string{sf.Name, sf.Stage, sf.Cond}
+	}
+
+	dw.heading(3, title, "")
+	dw.table([]string{"Function", "Stage", "Condition"}, rows)
+}
+
+func writePkgDoc(dw docWriter, pd PkgDoc) {
+	dw.heading(2, pd.Name, anchorName(pd.Name))
+
+	dw.para("Type: " + pd.Type)
+	if pd.Description != "" {
+		dw.para(pd.Description)
+	}
+	if len(pd.Keywords) > 0 {
+		dw.para("Keywords: " + strings.Join(pd.Keywords, ", "))
+	}
+
+	if len(pd.Apis) > 0 || len(pd.ReqApis) > 0 {
+		dw.heading(3, "APIs", "")
+
+		var items []string
+		for _, cv := range pd.Apis {
+			items = append(items, "Provides: "+condValueText(cv))
+		}
+		for _, cv := range pd.ReqApis {
+			items = append(items, "Requires: "+condValueText(cv))
+		}
+		dw.list(items)
+	}
+
+	writeStageFuncs(dw, "Init functions", pd.InitFuncs)
+	writeStageFuncs(dw, "Shutdown functions", pd.DownFuncs)
+
+	if pd.SyscfgError != "" {
+		dw.heading(3, "Settings", "")
+		dw.para("The package's syscfg could not be read: " + pd.SyscfgError)
+	}
+
+	if len(pd.Settings) > 0 {
+		rows := make([][]string, len(pd.Settings))
+		for i, sd := range pd.Settings {
+			dflt := sd.Default
+			if sd.Derived != "" {
+				dflt = "derived: " + sd.Derived
+			}
+
+			rows[i] = []string{
+				sd.Name,
+				dflt,
+				sd.Type,
+				sd.Range,
+				strings.Join(sd.Choices, ", "),
+				strings.Join(sd.Restrictions, "; "),
+				sd.State,
+				sd.Description,
+			}
+		}
+
+		dw.heading(3, "Settings", "")
+		dw.table([]string{
+			"Setting", "Default", "Type", "Range", "Choices",
+			"Restrictions", "Status", "Description",
+		}, rows)
+	}
+
+	if len(pd.Restrictions) > 0 {
+		dw.heading(3, "Restrictions", "")
+		dw.list(pd.Restrictions)
+	}
+}
+
+// RenderSettings produces a reference document describing the specified
+// packages in the specified format (one of SettingsFormats).
+func RenderSettings(pds []PkgDoc, format string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	var dw docWriter
+	switch format {
+	case SETTINGS_FORMAT_MARKDOWN:
+		dw = &mdWriter{w: buf}
+	case SETTINGS_FORMAT_HTML:
+		dw = &htmlWriter{w: buf}
+	case SETTINGS_FORMAT_RST:
+		dw = &rstWriter{w: buf}
+	default:
+		return nil, util.FmtNewtError(
+			"invalid docs format \"%s\"; must be one of: %s",
+			format, strings.Join(SettingsFormats, ", "))
+	}
+
+	dw.begin("Package and setting reference")
+	dw.para("Generated by Apache newt version " + newtutil.NewtVersionStr)
+
+	names := make([]string, len(pds))
+	anchors := make([]string, len(pds))
+	for i, pd := range pds {
+		names[i] = pd.Name
+		anchors[i] = anchorName(pd.Name)
+	}
+	dw.heading(2, "Packages", "")
+	dw.links(names, anchors)
+
+	for _, pd := range pds {
+		writePkgDoc(dw, pd)
+	}
+
+	dw.end()
+
+	return buf.Bytes(), nil
+}
+
+// Markdown.
+
+type mdWriter struct {
+	w io.Writer
+}
+
+func mdEscape(s string) string {
+	r := strings.NewReplacer(
+		`\`, `\\`, "|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`",
+		"<", "&lt;", ">", "&gt;", "\n", " ")
+	return r.Replace(s)
+}
+
+func (md *mdWriter) begin(title string) {
+	fmt.Fprintf(md.w, "# %s\n\n", mdEscape(title))
+}
+
+func (md *mdWriter) heading(level int, text string, anchor string) {
+	if anchor != "" {
+		fmt.Fprintf(md.w, "<a name=\"%s\"></a>\n", anchor)
+	}
+	fmt.Fprintf(md.w, "%s %s\n\n", strings.Repeat("#", level), mdEscape(text))
+}
+
+func (md *mdWriter) para(text string) {
+	fmt.Fprintf(md.w, "%s\n\n", mdEscape(text))
+}
+
+func (md *mdWriter) links(texts []string, anchors []string) {
+	for i, text := range texts {
+		fmt.Fprintf(md.w, "* [%s](#%s)\n", mdEscape(text), anchors[i])
+	}
+	fmt.Fprintf(md.w, "\n")
+}
+
+func (md *mdWriter) list(items []string) {
+	for _, item := range items {
+		fmt.Fprintf(md.w, "* %s\n", mdEscape(item))
+	}
+	fmt.Fprintf(md.w, "\n")
+}
+
+func (md *mdWriter) table(hdr []string, rows [][]string) {
+	fmt.Fprintf(md.w, "|")
+	for _, h := range hdr {
+		fmt.Fprintf(md.w, " %s |", mdEscape(h))
+	}
+	fmt.Fprintf(md.w, "\n|")
+	for _, _ = range hdr {
+		fmt.Fprintf(md.w, " --- |")
+	}
+	fmt.Fprintf(md.w, "\n")
+
+	for _, row := range rows {
+		fmt.Fprintf(md.w, "|")
+		for _, cell := range row {
+			fmt.Fprintf(md.w, " %s |", mdEscape(cell))
+		}
+		fmt.Fprintf(md.w, "\n")
+	}
+	fmt.Fprintf(md.w, "\n")
+}
+
+func (md *mdWriter) end() {
+}
+
+// HTML.
+
+type htmlWriter struct {
+	w io.Writer
+}
+
+func (hw *htmlWriter) begin(title string) {
+	fmt.Fprintf(hw.w, "<!DOCTYPE html>\n<html>\n<head>\n"+
+		"<meta charset=\"utf-8\">\n<title>%s</title>\n"+
+		"<style>\n"+
+		"table { border-collapse: collapse; }\n"+
+		"th, td { border: 1px solid #ccc; padding: 4px; "+
+		"vertical-align: top; text-align: left; }\n"+
+		"</style>\n</head>\n<body>\n<h1>%s</h1>\n",
+		html.EscapeString(title), html.EscapeString(title))
+}
+
+func (hw *htmlWriter) heading(level int, text string, anchor string) {
+	id := ""
+	if anchor != "" {
+		id = fmt.Sprintf(" id=\"%s\"", anchor)
+	}
+	fmt.Fprintf(hw.w, "<h%d%s>%s</h%d>\n",
+		level, id, html.EscapeString(text), level)
+}
+
+func (hw *htmlWriter) para(text string) {
+	fmt.Fprintf(hw.w, "<p>%s</p>\n", html.EscapeString(text))
+}
+
+func (hw *htmlWriter) links(texts []string, anchors []string) {
+	fmt.Fprintf(hw.w, "<ul>\n")
+	for i, text := range texts {
+		fmt.Fprintf(hw.w, "<li><a href=\"#%s\">%s</a></li>\n",
+			anchors[i], html.EscapeString(text))
+	}
+	fmt.Fprintf(hw.w, "</ul>\n")
+}
+
+func (hw *htmlWriter) list(items []string) {
+	fmt.Fprintf(hw.w, "<ul>\n")
+	for _, item := range items {
+		fmt.Fprintf(hw.w, "<li>%s</li>\n", html.EscapeString(item))
+	}
+	fmt.Fprintf(hw.w, "</ul>\n")
+}
+
+func (hw *htmlWriter) table(hdr []string, rows [][]string) {
+	fmt.Fprintf(hw.w, "<table>\n<tr>")
+	for _, h := range hdr {
+		fmt.Fprintf(hw.w, "<th>%s</th>", html.EscapeString(h))
+	}
+	fmt.Fprintf(hw.w, "</tr>\n")
+
+	for _, row := range rows {
+		fmt.Fprintf(hw.w, "<tr>")
+		for _, cell := range row {
+			fmt.Fprintf(hw.w, "<td>%s</td>", html.EscapeString(cell))
+		}
+		fmt.Fprintf(hw.w, "</tr>\n")
+	}
+	fmt.Fprintf(hw.w, "</table>\n")
+}
+
+func (hw *htmlWriter) end() {
+	fmt.Fprintf(hw.w, "</body>\n</html>\n")
+}
+
+// reStructuredText.
+
+type rstWriter struct {
+	w io.Writer
+}
+
+var rstUnderlines = []string{"", "=", "-", "~"}
+
+func rstEscape(s string) string {
+	r := strings.NewReplacer(
+		`\`, `\\`, "*", `\*`, "`", "\\`", "|", `\|`, "_", `\_`, "\n", " ")
+	return r.Replace(s)
+}
+
+func (rw *rstWriter) begin(title string) {
+	text := rstEscape(title)
+	line := strings.Repeat("#", len(text))
+	fmt.Fprintf(rw.w, "%s\n%s\n%s\n\n", line, text, line)
+}
+
+func (rw *rstWriter) heading(level int, text string, anchor string) {
+	if anchor != "" {
+		fmt.Fprintf(rw.w, ".. _%s:\n\n", anchor)
+	}
+	text = rstEscape(text)
+	fmt.Fprintf(rw.w, "%s\n%s\n\n",
+		text, strings.Repeat(rstUnderlines[level], len(text)))
+}
+
+func (rw *rstWriter) para(text string) {
+	fmt.Fprintf(rw.w, "%s\n\n", rstEscape(text))
+}
+
+func (rw *rstWriter) links(texts []string, anchors []string) {
+	for i, text := range texts {
+		fmt.Fprintf(rw.w, "* :ref:`%s <%s>`\n",
+			strings.NewReplacer("`", "", "<", "", ">", "").Replace(text),
+			anchors[i])
+	}
+	fmt.Fprintf(rw.w, "\n")
+}
+
+func (rw *rstWriter) list(items []string) {
+	for _, item := range items {
+		fmt.Fprintf(rw.w, "* %s\n", rstEscape(item))
+	}
+	fmt.Fprintf(rw.w, "\n")
+}
+
+func (rw *rstWriter) table(hdr []string, rows [][]string) {
+	fmt.Fprintf(rw.w, ".. list-table::\n   :header-rows: 1\n\n")
+
+	writeRow := func(cells []string) {
+		for i, cell := range cells {
+			prefix := "     "
+			if i == 0 {
+				prefix = "   * "
+			}
+			if cell == "" {
+				fmt.Fprintf(rw.w, "%s-\n", prefix)
+			} else {
+				fmt.Fprintf(rw.w, "%s- %s\n", prefix, rstEscape(cell))
+			}
+		}
+	}
+
+	writeRow(hdr)
+	for _, row := range rows {
+		writeRow(row)
+	}
+	fmt.Fprintf(rw.w, "\n")
+}
+
+func (rw *rstWriter) end() {
+}
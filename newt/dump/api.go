@@ -55,3 +55,14 @@ func newApiConflicts(res *resolve.Resolution) map[string][]string {
 
 	return m
 }
+
+func newApiRules(res *resolve.Resolution) map[string]string {
+	m := make(map[string]string, len(res.ApiRules))
+	for api, rule := range res.ApiRules {
+		if res.ApiMap[api] != nil {
+			m[api] = rule
+		}
+	}
+
+	return m
+}
@@ -0,0 +1,456 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apache/mynewt-artifact/flash"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// A SettingValue is the final value of a syscfg setting in one target, along
+// with the packages that contributed to it.
+type SettingValue struct {
+	Value   string        `json:"value"`
+	History []SyscfgPoint `json:"history"`
+}
+
+// A SettingDiff describes a setting that differs between two targets.  A nil
+// side indicates the setting is not defined in that target.
+type SettingDiff struct {
+	Name string        `json:"name"`
+	A    *SettingValue `json:"a"`
+	B    *SettingValue `json:"b"`
+}
+
+// An InitPos is the location of a sysinit or sysdown function in one target.
+// Index is the function's position relative to the functions present in both
+// targets.
+type InitPos struct {
+	Stage int `json:"stage"`
+	Index int `json:"index"`
+}
+
+// An InitDiff describes a sysinit or sysdown function that was added,
+// removed, moved to a different stage, or reordered.
+type InitDiff struct {
+	Name    string   `json:"name"`
+	PkgName string   `json:"package"`
+	A       *InitPos `json:"a"`
+	B       *InitPos `json:"b"`
+}
+
+type FlashAreaDiff struct {
+	Name string           `json:"name"`
+	A    *flash.FlashArea `json:"a"`
+	B    *flash.FlashArea `json:"b"`
+}
+
+type ApiDiff struct {
+	Name string `json:"name"`
+	A    string `json:"a"`
+	B    string `json:"b"`
+}
+
+// A Diff is a semantic comparison of two targets' reports.  "A" refers to
+// the first target and "B" to the second.  Packages are "added" if they are
+// only present in B and "removed" if they are only present in A.
+type Diff struct {
+	TargetA     string          `json:"target_a"`
+	TargetB     string          `json:"target_b"`
+	PkgsAdded   []string        `json:"packages_added"`
+	PkgsRemoved []string        `json:"packages_removed"`
+	Settings    []SettingDiff   `json:"settings"`
+	Sysinit     []InitDiff      `json:"sysinit"`
+	Sysdown     []InitDiff      `json:"sysdown"`
+	Apis        []ApiDiff       `json:"apis"`
+	FlashAreas  []FlashAreaDiff `json:"flash_areas"`
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k, _ := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func diffPkgs(a DepGraph, b DepGraph) ([]string, []string) {
+	added := map[string]struct{}{}
+	removed := map[string]struct{}{}
+
+	for name, _ := range a {
+		if _, ok := b[name]; !ok {
+			removed[name] = struct{}{}
+		}
+	}
+	for name, _ := range b {
+		if _, ok := a[name]; !ok {
+			added[name] = struct{}{}
+		}
+	}
+
+	return sortedKeys(added), sortedKeys(removed)
+}
+
+func settingValue(entry SyscfgEntry, ok bool) *SettingValue {
+	if !ok {
+		return nil
+	}
+
+	sv := &SettingValue{
+		History: entry.History,
+	}
+	if len(entry.History) > 0 {
+		sv.Value = entry.History[len(entry.History)-1].Value
+	}
+
+	return sv
+}
+
+func diffSettings(a Syscfg, b Syscfg) []SettingDiff {
+	names := map[string]struct{}{}
+	for name, _ := range a.Settings {
+		names[name] = struct{}{}
+	}
+	for name, _ := range b.Settings {
+		names[name] = struct{}{}
+	}
+
+	diffs := []SettingDiff{}
+	for _, name := range sortedKeys(names) {
+		ea, oka := a.Settings[name]
+		eb, okb := b.Settings[name]
+
+		sd := SettingDiff{
+			Name: name,
+			A:    settingValue(ea, oka),
+			B:    settingValue(eb, okb),
+		}
+
+		if sd.A != nil && sd.B != nil && sd.A.Value == sd.B.Value {
+			continue
+		}
+		diffs = append(diffs, sd)
+	}
+
+	return diffs
+}
+
+// initFunc is the common representation of sysinit and sysdown functions.
+type initFunc struct {
+	name    string
+	pkgName string
+	stage   int
+}
+
+// initPositions maps each function name to its stage and to its index among
+// the functions that are present in the other target.
+func initPositions(funcs []initFunc,
+	other map[string]struct{}) map[string]InitPos {
+
+	m := make(map[string]InitPos, len(funcs))
+
+	idx := 0
+	for _, f := range funcs {
+		pos := InitPos{Stage: f.stage, Index: -1}
+		if _, ok := other[f.name]; ok {
+			pos.Index = idx
+			idx++
+		}
+		m[f.name] = pos
+	}
+
+	return m
+}
+
+func diffInit(a []initFunc, b []initFunc) []InitDiff {
+	namesA := map[string]struct{}{}
+	for _, f := range a {
+		namesA[f.name] = struct{}{}
+	}
+	namesB := map[string]struct{}{}
+	for _, f := range b {
+		namesB[f.name] = struct{}{}
+	}
+
+	posA := initPositions(a, namesB)
+	posB := initPositions(b, namesA)
+
+	diffs := []InitDiff{}
+	add := func(f initFunc) {
+		pa, oka := posA[f.name]
+		pb, okb := posB[f.name]
+		if oka && okb && pa == pb {
+			return
+		}
+
+		d := InitDiff{
+			Name:    f.name,
+			PkgName: f.pkgName,
+		}
+		if oka {
+			d.A = &pa
+		}
+		if okb {
+			d.B = &pb
+		}
+		diffs = append(diffs, d)
+	}
+
+	// Report functions in B's order, followed by functions that were removed.
+	for _, f := range b {
+		add(f)
+	}
+	for _, f := range a {
+		if _, ok := namesB[f.name]; !ok {
+			add(f)
+		}
+	}
+
+	return diffs
+}
+
+func sysinitFuncs(si Sysinit) []initFunc {
+	funcs := make([]initFunc, len(si.Funcs))
+	for i, f := range si.Funcs {
+		funcs[i] = initFunc{f.Name, f.PkgName, f.Stage}
+	}
+	return funcs
+}
+
+func sysdownFuncs(sd Sysdown) []initFunc {
+	funcs := make([]initFunc, len(sd.Funcs))
+	for i, f := range sd.Funcs {
+		funcs[i] = initFunc{f.Name, f.PkgName, f.Stage}
+	}
+	return funcs
+}
+
+func diffApis(a map[string]string, b map[string]string) []ApiDiff {
+	names := map[string]struct{}{}
+	for name, _ := range a {
+		names[name] = struct{}{}
+	}
+	for name, _ := range b {
+		names[name] = struct{}{}
+	}
+
+	diffs := []ApiDiff{}
+	for _, name := range sortedKeys(names) {
+		if a[name] != b[name] {
+			diffs = append(diffs, ApiDiff{
+				Name: name,
+				A:    a[name],
+				B:    b[name],
+			})
+		}
+	}
+
+	return diffs
+}
+
+func diffFlash(a FlashMap, b FlashMap) []FlashAreaDiff {
+	names := map[string]struct{}{}
+	for name, _ := range a.Areas {
+		names[name] = struct{}{}
+	}
+	for name, _ := range b.Areas {
+		names[name] = struct{}{}
+	}
+
+	diffs := []FlashAreaDiff{}
+	for _, name := range sortedKeys(names) {
+		fa, oka := a.Areas[name]
+		fb, okb := b.Areas[name]
+		if oka && okb && fa == fb {
+			continue
+		}
+
+		d := FlashAreaDiff{Name: name}
+		if oka {
+			d.A = &fa
+		}
+		if okb {
+			d.B = &fb
+		}
+		diffs = append(diffs, d)
+	}
+
+	return diffs
+}
+
+// NewDiff compares two target reports.
+func NewDiff(a Report, b Report) Diff {
+	d := Diff{
+		TargetA: a.TargetName,
+		TargetB: b.TargetName,
+	}
+
+	d.PkgsAdded, d.PkgsRemoved = diffPkgs(a.DepGraph, b.DepGraph)
+	d.Settings = diffSettings(a.Syscfg, b.Syscfg)
+	d.Sysinit = diffInit(sysinitFuncs(a.Sysinit), sysinitFuncs(b.Sysinit))
+	d.Sysdown = diffInit(sysdownFuncs(a.Sysdown), sysdownFuncs(b.Sysdown))
+	d.Apis = diffApis(a.ApiMap, b.ApiMap)
+	d.FlashAreas = diffFlash(a.FlashMap, b.FlashMap)
+
+	return d
+}
+
+// Empty indicates whether the two targets are equivalent.
+func (d *Diff) Empty() bool {
+	return len(d.PkgsAdded) == 0 && len(d.PkgsRemoved) == 0 &&
+		len(d.Settings) == 0 && len(d.Sysinit) == 0 &&
+		len(d.Sysdown) == 0 && len(d.Apis) == 0 && len(d.FlashAreas) == 0
+}
+
+func (d *Diff) JSON() (string, error) {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetIndent("", "    ")
+	enc.SetEscapeHTML(false)
+
+	if err := enc.Encode(d); err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	return buf.String(), nil
+}
+
+func historyString(history []SyscfgPoint) string {
+	strs := make([]string, len(history))
+	for i, p := range history {
+		strs[i] = p.Pkg + "=" + p.Value
+	}
+	return strings.Join(strs, ", ")
+}
+
+func flashAreaString(fa flash.FlashArea) string {
+	return fmt.Sprintf("id=%d device=%d offset=0x%08x size=%d",
+		fa.Id, fa.Device, fa.Offset, fa.Size)
+}
+
+func writeInitDiffs(buffer *bytes.Buffer, title string, diffs []InitDiff) {
+	if len(diffs) == 0 {
+		return
+	}
+
+	fmt.Fprintf(buffer, "\n%s (- A only, + B only, ~ changed):\n", title)
+	for _, d := range diffs {
+		switch {
+		case d.B == nil:
+			fmt.Fprintf(buffer, "    - %s (stage %d, %s)\n",
+				d.Name, d.A.Stage, d.PkgName)
+		case d.A == nil:
+			fmt.Fprintf(buffer, "    + %s (stage %d, %s)\n",
+				d.Name, d.B.Stage, d.PkgName)
+		case d.A.Stage != d.B.Stage:
+			fmt.Fprintf(buffer, "    ~ %s: stage %d --> %d (%s)\n",
+				d.Name, d.A.Stage, d.B.Stage, d.PkgName)
+		default:
+			fmt.Fprintf(buffer, "    ~ %s: position %d --> %d (%s)\n",
+				d.Name, d.A.Index, d.B.Index, d.PkgName)
+		}
+	}
+}
+
+// Text produces a human-readable description of the diff.
+func (d *Diff) Text() string {
+	buffer := bytes.NewBufferString("")
+
+	fmt.Fprintf(buffer, "Comparing A=%s and B=%s\n", d.TargetA, d.TargetB)
+	if d.Empty() {
+		fmt.Fprintf(buffer, "No differences\n")
+		return buffer.String()
+	}
+
+	if len(d.PkgsAdded) > 0 || len(d.PkgsRemoved) > 0 {
+		fmt.Fprintf(buffer, "\nPackages (- A only, + B only):\n")
+		for _, name := range d.PkgsRemoved {
+			fmt.Fprintf(buffer, "    - %s\n", name)
+		}
+		for _, name := range d.PkgsAdded {
+			fmt.Fprintf(buffer, "    + %s\n", name)
+		}
+	}
+
+	if len(d.Settings) > 0 {
+		fmt.Fprintf(buffer, "\nSettings (- A, + B):\n")
+		for _, s := range d.Settings {
+			fmt.Fprintf(buffer, "    %s:\n", s.Name)
+			if s.A == nil {
+				fmt.Fprintf(buffer, "        - (undefined)\n")
+			} else {
+				fmt.Fprintf(buffer, "        - %s [%s]\n",
+					s.A.Value, historyString(s.A.History))
+			}
+			if s.B == nil {
+				fmt.Fprintf(buffer, "        + (undefined)\n")
+			} else {
+				fmt.Fprintf(buffer, "        + %s [%s]\n",
+					s.B.Value, historyString(s.B.History))
+			}
+		}
+	}
+
+	writeInitDiffs(buffer, "Sysinit", d.Sysinit)
+	writeInitDiffs(buffer, "Sysdown", d.Sysdown)
+
+	if len(d.Apis) > 0 {
+		fmt.Fprintf(buffer, "\nAPIs (A --> B):\n")
+		for _, a := range d.Apis {
+			pa := a.A
+			if pa == "" {
+				pa = "(none)"
+			}
+			pb := a.B
+			if pb == "" {
+				pb = "(none)"
+			}
+			fmt.Fprintf(buffer, "    %s: %s --> %s\n", a.Name, pa, pb)
+		}
+	}
+
+	if len(d.FlashAreas) > 0 {
+		fmt.Fprintf(buffer, "\nFlash areas (- A, + B):\n")
+		for _, fd := range d.FlashAreas {
+			fmt.Fprintf(buffer, "    %s:\n", fd.Name)
+			if fd.A == nil {
+				fmt.Fprintf(buffer, "        - (undefined)\n")
+			} else {
+				fmt.Fprintf(buffer, "        - %s\n", flashAreaString(*fd.A))
+			}
+			if fd.B == nil {
+				fmt.Fprintf(buffer, "        + (undefined)\n")
+			} else {
+				fmt.Fprintf(buffer, "        + %s\n", flashAreaString(*fd.B))
+			}
+		}
+	}
+
+	return buffer.String()
+}
@@ -41,6 +41,7 @@ type Report struct {
 	ApiMap          map[string]string   `json:"api_map"`
 	UnsatisfiedApis map[string][]string `json:"unsatisfied_apis"`
 	ApiConflicts    map[string][]string `json:"api_conflicts"`
+	ApiRules        map[string]string   `json:"api_rules"`
 	FlashMap        FlashMap            `json:"flash_map"`
 }
 
@@ -104,6 +105,7 @@ func NewReport(tb *builder.TargetBuilder) (Report, error) {
 	report.ApiMap = newApiMap(res)
 	report.UnsatisfiedApis = newUnsatisfiedApis(res)
 	report.ApiConflicts = newApiConflicts(res)
+	report.ApiRules = newApiRules(res)
 
 	report.FlashMap = newFlashMap(tb.BspPkg().FlashMap)
 
@@ -37,8 +37,10 @@ type SyscfgRestriction struct {
 
 type SyscfgEntry struct {
 	Type         syscfg.CfgSettingType  `json:"type"`
+	ValueType    syscfg.CfgValueType    `json:"value_type,omitempty"`
 	History      []SyscfgPoint          `json:"history"`
 	RefName      string                 `json:"ref_name,omitempty"`
+	Derived      string                 `json:"derived,omitempty"`
 	Restrictions []SyscfgRestriction    `json:"restrictions,omitempty"`
 	State        syscfg.CfgSettingState `json:"state"`
 }
@@ -49,6 +51,11 @@ type SyscfgPriority struct {
 	Overrider string `json:"overrider"`
 }
 
+type SyscfgTypeViolation struct {
+	Point SyscfgPoint `json:"point"`
+	Text  string      `json:"text"`
+}
+
 type SyscfgFlashConflict struct {
 	Settings []string                    `json:"settings"`
 	Code     syscfg.CfgFlashConflictCode `json:"code"`
@@ -67,6 +74,9 @@ type Syscfg struct {
 	Deprecated      []string                       `json:"deprecated"`
 	Defunct         []string                       `json:"defunct"`
 	UnresolvedRefs  []string                       `json:"unresolved_refs"`
+	TypeViolations  map[string]SyscfgTypeViolation `json:"type_violations"`
+	DerivedErrors   map[string]string              `json:"derived_errors"`
+	DerivedOverride map[string][]SyscfgPoint       `json:"derived_overrides"`
 }
 
 func convPoint(p syscfg.CfgPoint) SyscfgPoint {
@@ -179,8 +189,10 @@ func newSyscfg(cfg syscfg.Cfg) Syscfg {
 
 		settings[name] = SyscfgEntry{
 			Type:         ce.SettingType,
+			ValueType:    ce.ValueType,
 			History:      history,
 			RefName:      ce.ValueRefName,
+			Derived:      ce.DerivedExpr,
 			Restrictions: restrictions,
 			State:        ce.State,
 		}
@@ -193,6 +205,15 @@ func newSyscfg(cfg syscfg.Cfg) Syscfg {
 		}
 	}
 
+	typeViolations := make(map[string]SyscfgTypeViolation,
+		len(cfg.TypeViolations))
+	for sname, v := range cfg.TypeViolations {
+		typeViolations[sname] = SyscfgTypeViolation{
+			Point: convPoint(v.Point),
+			Text:  v.Text,
+		}
+	}
+
 	return Syscfg{
 		Settings:        settings,
 		PkgRestrictions: convStringMapRestrictionSlice(cfg.PackageRestrictions),
@@ -206,5 +227,8 @@ func newSyscfg(cfg syscfg.Cfg) Syscfg {
 		Deprecated:      convStringMapToSlice(cfg.Deprecated),
 		Defunct:         convStringMapToSlice(cfg.Defunct),
 		UnresolvedRefs:  convStringMapToSlice(cfg.UnresolvedValueRefs),
+		TypeViolations:  typeViolations,
+		DerivedErrors:   cfg.DerivedErrors,
+		DerivedOverride: convStringMapPointSlice(cfg.DerivedOverrides),
 	}
 }
@@ -0,0 +1,209 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package event emits a machine-readable stream of build events.  Each event
+// is written as a single line of JSON (newline-delimited JSON), so consumers
+// can process the stream incrementally while the build is running.
+package event
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+const FORMAT_JSON = "json"
+
+const (
+	STATUS_OK     = "ok"
+	STATUS_FAILED = "failed"
+)
+
+type Event struct {
+	Time       string                 `json:"time"`
+	Type       string                 `json:"type"`
+	Target     string                 `json:"target,omitempty"`
+	Package    string                 `json:"package,omitempty"`
+	File       string                 `json:"file,omitempty"`
+	DurationMs *float64               `json:"duration_ms,omitempty"`
+	Status     string                 `json:"status,omitempty"`
+	ExitCode   *int                   `json:"exit_code,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+// A Span represents an operation with a start and an end (e.g., a compile
+// job).  A "<type>_started" event is emitted when the span is created, and a
+// "<type>_finished" event is emitted when it is finished.
+type Span struct {
+	typ   string
+	ev    Event
+	start time.Time
+}
+
+var mtx sync.Mutex
+var writer io.Writer
+var closer io.Closer
+var curTarget string
+
+// Open starts an event stream in the specified format.  A path of "-"
+// indicates stdout.
+func Open(format string, path string) error {
+	if format != FORMAT_JSON {
+		return util.FmtNewtError(
+			"unsupported event format \"%s\"; must be \"%s\"",
+			format, FORMAT_JSON)
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if path == "" || path == "-" {
+		writer = os.Stdout
+		closer = nil
+		return nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return util.FmtNewtError("failed to create event file \"%s\": %s",
+			path, err.Error())
+	}
+
+	writer = f
+	closer = f
+	return nil
+}
+
+// Close terminates the event stream.
+func Close() {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if closer != nil {
+		closer.Close()
+	}
+	writer = nil
+	closer = nil
+}
+
+// Enabled indicates whether an event stream is open.
+func Enabled() bool {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	return writer != nil
+}
+
+// SetTarget sets the target name that gets attached to subsequent events.
+func SetTarget(name string) {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	curTarget = name
+}
+
+// Emit writes a single event to the stream.  It has no effect if no stream is
+// open.
+func Emit(typ string, ev Event) {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if writer == nil {
+		return
+	}
+
+	ev.Type = typ
+	ev.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	if ev.Target == "" {
+		ev.Target = curTarget
+	}
+
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	b = append(b, '\n')
+	writer.Write(b)
+}
+
+// Start emits a "<typ>_started" event and returns a span that can later be
+// finished.
+func Start(typ string, ev Event) *Span {
+	Emit(typ+"_started", ev)
+
+	return &Span{
+		typ:   typ,
+		ev:    ev,
+		start: time.Now(),
+	}
+}
+
+// Finish emits a "<typ>_finished" event carrying the span's duration and the
+// result of the operation.
+func (s *Span) Finish(err error) {
+	s.FinishData(err, nil)
+}
+
+// FinishData is like Finish, but attaches additional data to the event.
+func (s *Span) FinishData(err error, data map[string]interface{}) {
+	ev := s.ev
+
+	ms := float64(time.Since(s.start).Nanoseconds()) / 1e6
+	ev.DurationMs = &ms
+
+	if err == nil {
+		ev.Status = STATUS_OK
+	} else {
+		ev.Status = STATUS_FAILED
+		ev.Error = err.Error()
+		ev.ExitCode = exitCode(err)
+	}
+
+	if data != nil {
+		if ev.Data == nil {
+			ev.Data = map[string]interface{}{}
+		}
+		for k, v := range data {
+			ev.Data[k] = v
+		}
+	}
+
+	Emit(s.typ+"_finished", ev)
+}
+
+// exitCode extracts a child process's exit status from an error, if it has
+// one.
+func exitCode(err error) *int {
+	if ne, ok := err.(*util.NewtError); ok && ne.Parent != nil {
+		err = ne.Parent
+	}
+
+	if ee, ok := err.(*exec.ExitError); ok {
+		code := ee.ExitCode()
+		return &code
+	}
+
+	return nil
+}
@@ -0,0 +1,421 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package explain describes how a syscfg setting acquired its value: which
+// packages defined and overrode it, why those packages are part of the build,
+// and which expressions and restrictions involve the setting.
+package explain
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dachalco/mynewt-newt/newt/builder"
+	"github.com/dachalco/mynewt-newt/newt/parse"
+	"github.com/dachalco/mynewt-newt/newt/pkg"
+	"github.com/dachalco/mynewt-newt/newt/syscfg"
+	"github.com/dachalco/mynewt-newt/newt/ycfg"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// A Link is one step in the chain of dependencies that pulls a package into
+// the build.
+type Link struct {
+	Pkg string `json:"package"`
+
+	// The condition enabling the dependency on the next package in the
+	// chain; empty if the dependency is unconditional.
+	Condition string `json:"condition,omitempty"`
+}
+
+// A Point is a single definition or override of the setting.
+type Point struct {
+	Pkg      string `json:"package"`
+	Value    string `json:"value"`
+	Priority string `json:"priority"`
+
+	// The dependency chain from a seed package (e.g., the app) to the
+	// package, seed first.
+	IncludedBy []Link `json:"included_by,omitempty"`
+}
+
+// An Expr is a conditional expression in a package's YAML files that
+// references the setting.
+type Expr struct {
+	Pkg    string `json:"package"`
+	File   string `json:"file"`
+	Key    string `json:"key"`
+	Expr   string `json:"expr"`
+	Result bool   `json:"result"`
+}
+
+// A Restriction is a syscfg restriction that involves the setting.
+type Restriction struct {
+	// The package that imposes the restriction.
+	Pkg string `json:"package"`
+
+	// The setting that the restriction is attached to; empty for
+	// package-level restrictions.
+	Setting string `json:"setting,omitempty"`
+
+	Text string `json:"text"`
+	Met  bool   `json:"met"`
+}
+
+type Explanation struct {
+	Target      string `json:"target"`
+	Setting     string `json:"setting"`
+	Defined     bool   `json:"defined"`
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+	ValueType   string `json:"value_type,omitempty"`
+	CopiedFrom  string `json:"copied_from,omitempty"`
+	DerivedFrom string `json:"derived_from,omitempty"`
+
+	// Definition and overrides, oldest first.  The last point supplies the
+	// setting's value.
+	History []Point `json:"history"`
+
+	// Overrides that had no effect: overrides of an undefined setting or of
+	// a derived setting.
+	Ignored []Point `json:"ignored,omitempty"`
+
+	Exprs        []Expr        `json:"exprs"`
+	Restrictions []Restriction `json:"restrictions"`
+}
+
+// includedBy finds a shortest dependency chain from a seed package to the
+// specified package.
+func includedBy(rdg builder.DepGraph, name string) []Link {
+	type prevEntry struct {
+		name string
+		cond string
+	}
+
+	prev := map[string]prevEntry{name: {}}
+	queue := []string{name}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		if len(rdg[cur]) == 0 {
+			// Reached a package that nothing depends on: a seed.  Walk back
+			// to the original package.
+			links := []Link{}
+			for n := cur; n != ""; n = prev[n].name {
+				links = append(links, Link{Pkg: n, Condition: prev[n].cond})
+			}
+			return links
+		}
+
+		for _, e := range rdg[cur] {
+			if _, ok := prev[e.PkgName]; !ok {
+				cond := ""
+				if expr := e.DepExprs.Disjunction(); expr != nil {
+					cond = expr.String()
+				}
+				prev[e.PkgName] = prevEntry{name: cur, cond: cond}
+				queue = append(queue, e.PkgName)
+			}
+		}
+	}
+
+	return nil
+}
+
+func priorityName(lpkg *pkg.LocalPackage) string {
+	if lpkg == nil {
+		return "injected"
+	}
+
+	return pkg.PackageTypeNames[syscfg.PkgPriority(lpkg)]
+}
+
+func newPoint(p syscfg.CfgPoint, rdg builder.DepGraph) Point {
+	pt := Point{
+		Pkg:      p.Name(),
+		Value:    p.Value,
+		Priority: priorityName(p.Source),
+	}
+
+	if p.Source != nil {
+		pt.IncludedBy = includedBy(rdg, p.Source.FullName())
+	}
+
+	return pt
+}
+
+// referencesSetting indicates whether an expression mentions the specified
+// setting.
+func referencesSetting(expr string, name string) bool {
+	tokens, err := parse.Lex(expr)
+	if err != nil {
+		return false
+	}
+
+	for _, n := range parse.IdentNames(tokens) {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findExprs finds the conditional keys in a YAML file that reference the
+// specified setting.
+func findExprs(lpkg *pkg.LocalPackage, yc *ycfg.YCfg, file string,
+	name string, settings map[string]string) []Expr {
+
+	exprs := []Expr{}
+
+	for _, node := range yc.ConditionalKeys() {
+		if !referencesSetting(node.Name, name) {
+			continue
+		}
+
+		expr, err := parse.LexAndParse(node.Name)
+		if err != nil || expr == nil {
+			continue
+		}
+		result, _ := parse.Eval(expr, settings)
+
+		exprs = append(exprs, Expr{
+			Pkg:    lpkg.FullName(),
+			File:   file,
+			Key:    node.Parent.FullName(),
+			Expr:   expr.String(),
+			Result: result,
+		})
+	}
+
+	return exprs
+}
+
+// Explain describes the history of the specified setting in a target.
+func Explain(t *builder.TargetBuilder, name string) (*Explanation, error) {
+	res, err := t.Resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	rdg, err := t.CreateRevdepGraph()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := res.Cfg
+	ex := &Explanation{
+		Target:  t.GetTarget().FullName(),
+		Setting: name,
+		History: []Point{},
+	}
+
+	entry, ok := cfg.Settings[name]
+	orphans := cfg.Orphans[name]
+	if !ok && len(orphans) == 0 {
+		return nil, util.FmtNewtError(
+			"setting \"%s\" is not defined or overridden in target %s",
+			name, ex.Target)
+	}
+
+	if ok {
+		ex.Defined = true
+		ex.Value = entry.Value
+		ex.Description = entry.Description
+		ex.CopiedFrom = entry.ValueRefName
+		ex.DerivedFrom = entry.DerivedExpr
+		if entry.ValueType != syscfg.CFG_VALUE_TYPE_NONE {
+			ex.ValueType = entry.ValueType.String()
+		}
+
+		for _, p := range entry.History {
+			ex.History = append(ex.History, newPoint(p, rdg))
+		}
+	}
+
+	for _, p := range orphans {
+		ex.Ignored = append(ex.Ignored, newPoint(p, rdg))
+	}
+	for _, p := range cfg.DerivedOverrides[name] {
+		ex.Ignored = append(ex.Ignored, newPoint(p, rdg))
+	}
+
+	ex.Exprs = []Expr{}
+	for _, rpkg := range res.MasterSet.Rpkgs {
+		lpkg := rpkg.Lpkg
+		settings := cfg.AllSettingsForLpkg(lpkg)
+
+		ex.Exprs = append(ex.Exprs,
+			findExprs(lpkg, &lpkg.PkgY, pkg.PACKAGE_FILE_NAME, name,
+				settings)...)
+		ex.Exprs = append(ex.Exprs,
+			findExprs(lpkg, &lpkg.SyscfgY, pkg.SYSCFG_YAML_FILENAME, name,
+				settings)...)
+	}
+	sort.SliceStable(ex.Exprs, func(i int, j int) bool {
+		a := ex.Exprs[i]
+		b := ex.Exprs[j]
+		if a.Pkg != b.Pkg {
+			return a.Pkg < b.Pkg
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		return a.Expr < b.Expr
+	})
+
+	ex.Restrictions = []Restriction{}
+	for _, or := range cfg.RestrictionsInvolving(name) {
+		ex.Restrictions = append(ex.Restrictions, Restriction{
+			Pkg:     or.Pkg,
+			Setting: or.Restriction.BaseSetting,
+			Text:    or.Restriction.Text(),
+			Met:     cfg.RestrictionMet(or.Restriction),
+		})
+	}
+
+	return ex, nil
+}
+
+func (ex *Explanation) JSON() ([]byte, error) {
+	b, err := json.MarshalIndent(ex, "", "    ")
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return b, nil
+}
+
+func chainText(links []Link) string {
+	if len(links) <= 1 {
+		return "seed package"
+	}
+
+	s := "included via "
+	for i, l := range links {
+		if i > 0 {
+			s += " -> "
+		}
+		s += l.Pkg
+		if l.Condition != "" {
+			s += fmt.Sprintf(" [if %s]", l.Condition)
+		}
+	}
+
+	return s
+}
+
+func pointText(p Point) string {
+	if p.Priority == "injected" {
+		return "newt (injected)"
+	}
+
+	how := chainText(p.IncludedBy)
+	if p.Priority == pkg.PackageTypeNames[pkg.PACKAGE_TYPE_TARGET] {
+		how = "the target"
+	}
+
+	return fmt.Sprintf("%s (%s priority; %s)", p.Pkg, p.Priority, how)
+}
+
+// Text produces a human-readable description of the setting's history.
+func (ex *Explanation) Text() string {
+	var b strings.Builder
+
+	if !ex.Defined {
+		fmt.Fprintf(&b, "%s is not defined by any package in %s.\n",
+			ex.Setting, ex.Target)
+	} else {
+		fmt.Fprintf(&b, "%s = %s\n", ex.Setting, ex.Value)
+		if ex.Description != "" {
+			fmt.Fprintf(&b, "    %s\n", ex.Description)
+		}
+		if ex.ValueType != "" {
+			fmt.Fprintf(&b, "    Value type: %s\n", ex.ValueType)
+		}
+
+		fmt.Fprintf(&b, "\nHistory (oldest first):\n")
+		for i, p := range ex.History {
+			verb := "Overridden"
+			if i == 0 {
+				verb = "Defined"
+			}
+			fmt.Fprintf(&b, "    %d. %s by %s\n", i+1, verb, pointText(p))
+
+			if i == 0 && ex.DerivedFrom != "" {
+				fmt.Fprintf(&b, "       derived from `%s` = %s\n",
+					ex.DerivedFrom, p.Value)
+			} else {
+				fmt.Fprintf(&b, "       value: %s\n", p.Value)
+			}
+		}
+
+		if len(ex.History) > 1 {
+			fmt.Fprintf(&b, "    The last override wins.  Packages can only "+
+				"override settings defined by\n"+
+				"    lower priority packages (lowest first: lib, bsp, "+
+				"unittest, app, target).\n")
+		}
+		if ex.CopiedFrom != "" {
+			fmt.Fprintf(&b, "    Value copied from %s.\n", ex.CopiedFrom)
+		}
+	}
+
+	if len(ex.Ignored) > 0 {
+		fmt.Fprintf(&b, "\nIgnored overrides:\n")
+		for _, p := range ex.Ignored {
+			fmt.Fprintf(&b, "    * %s: %s\n", pointText(p), p.Value)
+		}
+	}
+
+	fmt.Fprintf(&b, "\nExpressions referencing %s:\n", ex.Setting)
+	if len(ex.Exprs) == 0 {
+		fmt.Fprintf(&b, "    (none)\n")
+	}
+	for _, e := range ex.Exprs {
+		fmt.Fprintf(&b, "    * %s (%s) %s: `%s` is %t\n",
+			e.Pkg, e.File, e.Key, e.Expr, e.Result)
+	}
+
+	fmt.Fprintf(&b, "\nRestrictions involving %s:\n", ex.Setting)
+	if len(ex.Restrictions) == 0 {
+		fmt.Fprintf(&b, "    (none)\n")
+	}
+	for _, r := range ex.Restrictions {
+		status := "met"
+		if !r.Met {
+			status = "VIOLATED"
+		}
+
+		owner := r.Pkg
+		if r.Setting != "" {
+			owner += " setting " + r.Setting
+		}
+		fmt.Fprintf(&b, "    * %s %s (%s)\n", owner, r.Text, status)
+	}
+
+	return b.String()
+}
@@ -64,7 +64,8 @@ func flashAreaErr(areaName string, format string, args ...interface{}) error {
 			fmt.Sprintf(format, args...))
 }
 
-func parseSize(val string) (int, error) {
+// ParseSize parses a size in bytes, optionally suffixed with "kB".
+func ParseSize(val string) (int, error) {
 	lower := strings.ToLower(val)
 
 	multiplier := 1
@@ -128,7 +129,7 @@ func parseFlashArea(
 			offsetPresent = true
 
 		case "size":
-			area.Size, err = parseSize(v)
+			area.Size, err = ParseSize(v)
 			if err != nil {
 				return area, flashAreaErr(name, err.Error())
 			}
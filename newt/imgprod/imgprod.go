@@ -22,6 +22,7 @@
 package imgprod
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
@@ -30,8 +31,10 @@ import (
 
 	"github.com/apache/mynewt-artifact/flash"
 	"github.com/apache/mynewt-artifact/image"
+	amanifest "github.com/apache/mynewt-artifact/manifest"
 	"github.com/apache/mynewt-artifact/sec"
 	"github.com/dachalco/mynewt-newt/newt/builder"
+	"github.com/dachalco/mynewt-newt/newt/event"
 	"github.com/dachalco/mynewt-newt/newt/manifest"
 	"github.com/dachalco/mynewt-newt/newt/newtutil"
 	"github.com/dachalco/mynewt-newt/newt/toolchain"
@@ -227,6 +230,18 @@ func verifyImgSizes(pset ProducedImageSet, maxSizes []int) error {
 	return nil
 }
 
+// emitImageEvent reports a produced image to the build event stream.
+func emitImageEvent(role string, pi ProducedImage) {
+	event.Emit("image_produced", event.Event{
+		File: pi.Filename,
+		Data: map[string]interface{}{
+			"role": role,
+			"hash": fmt.Sprintf("%x", pi.Hash),
+			"size": pi.FileSize,
+		},
+	})
+}
+
 func ProduceImages(opts ImageProdOpts) (ProducedImageSet, error) {
 	pset := ProducedImageSet{}
 
@@ -239,6 +254,7 @@ func ProduceImages(opts ImageProdOpts) (ProducedImageSet, error) {
 		loaderHash = pi.Hash
 
 		pset.Loader = &pi
+		emitImageEvent("loader", pi)
 	}
 
 	pi, err := produceApp(opts, loaderHash)
@@ -246,6 +262,7 @@ func ProduceImages(opts ImageProdOpts) (ProducedImageSet, error) {
 		return pset, err
 	}
 	pset.App = pi
+	emitImageEvent("app", pi)
 
 	return pset, nil
 }
@@ -263,8 +280,30 @@ func ProduceManifest(opts manifest.ManifestCreateOpts) error {
 	}
 	defer file.Close()
 
-	if _, err := m.Write(file); err != nil {
-		return err
+	// The artifact library's manifest type has no package versions or SBOM
+	// field.  Shadow its package lists with versioned ones and append the
+	// SBOM reference after the standard fields.
+	mx := struct {
+		*amanifest.Manifest
+		Pkgs       []manifest.ManifestPkg `json:"pkgs"`
+		LoaderPkgs []manifest.ManifestPkg `json:"loader_pkgs,omitempty"`
+		Sbom       *manifest.SbomRef      `json:"sbom,omitempty"`
+	}{
+		Manifest: &m,
+		Pkgs:     manifest.VersionedPkgs(m.Pkgs, opts.TgtBldr.AppBuilder),
+		Sbom:     opts.Sbom,
+	}
+	if opts.TgtBldr.LoaderBuilder != nil {
+		mx.LoaderPkgs = manifest.VersionedPkgs(m.LoaderPkgs,
+			opts.TgtBldr.LoaderBuilder)
+	}
+
+	buf, err := json.MarshalIndent(mx, "", "  ")
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	if _, err := file.Write(buf); err != nil {
+		return util.ChildNewtError(err)
 	}
 
 	return nil
@@ -319,9 +358,13 @@ func OptsFromTgtBldr(b *builder.TargetBuilder, ver image.ImageVersion,
 	return opts, nil
 }
 
+// ProduceAll creates the images and manifest for a target.  If sbomFormat is
+// non-empty, an SBOM in that format is also written and referenced from the
+// manifest.
 func ProduceAll(t *builder.TargetBuilder, ver image.ImageVersion,
 	sigKeys []sec.PrivSignKey, encKeyFilename string, encKeyIndex int,
-	hdrPad int, imagePad int, sectionString string, useLegacyTLV bool) error {
+	hdrPad int, imagePad int, sectionString string, useLegacyTLV bool,
+	sbomFormat string) error {
 
 	elfPath := t.AppBuilder.AppElfPath()
 
@@ -389,6 +432,13 @@ func ProduceAll(t *builder.TargetBuilder, ver image.ImageVersion,
 		return err
 	}
 
+	if sbomFormat != "" {
+		mopts.Sbom, err = ProduceSbom(t, sbomFormat, pset.App.Hash, loaderHash)
+		if err != nil {
+			return err
+		}
+	}
+
 	if err := ProduceManifest(mopts); err != nil {
 		return err
 	}
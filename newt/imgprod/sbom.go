@@ -0,0 +1,67 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package imgprod
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/dachalco/mynewt-newt/newt/builder"
+	"github.com/dachalco/mynewt-newt/newt/manifest"
+	"github.com/dachalco/mynewt-newt/newt/sbom"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// ProduceSbom writes an SBOM for a target whose images have just been
+// produced.  It returns a reference to the SBOM suitable for embedding in the
+// manifest.
+func ProduceSbom(t *builder.TargetBuilder, format string, appHash []byte,
+	loaderHash []byte) (*manifest.SbomRef, error) {
+
+	s, err := sbom.Collect(t)
+	if err != nil {
+		return nil, err
+	}
+
+	s.SetImageHash(sbom.IMAGE_APP, appHash)
+	if loaderHash != nil {
+		s.SetImageHash(sbom.IMAGE_LOADER, loaderHash)
+	}
+
+	path := t.AppBuilder.SbomPath()
+	if err := s.Write(format, path); err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"SBOM successfully generated: %s\n", path)
+
+	return &manifest.SbomRef{
+		Path:   path,
+		Format: format,
+		Hash:   fmt.Sprintf("%x", sha256.Sum256(b)),
+	}, nil
+}
@@ -196,6 +196,8 @@ func ProduceImagesV1(opts ImageProdOpts) (ProducedImageSetV1, error) {
 		loaderHash = pi.Hash
 
 		pset.Loader = &pi
+		emitImageEvent("loader", ProducedImage{
+			Filename: pi.Filename, Hash: pi.Hash, FileSize: pi.FileSize})
 	}
 
 	pi, err := produceAppV1(opts, loaderHash)
@@ -203,13 +205,16 @@ func ProduceImagesV1(opts ImageProdOpts) (ProducedImageSetV1, error) {
 		return pset, err
 	}
 	pset.App = pi
+	emitImageEvent("app", ProducedImage{
+		Filename: pi.Filename, Hash: pi.Hash, FileSize: pi.FileSize})
 
 	return pset, nil
 }
 
 func ProduceAllV1(t *builder.TargetBuilder, ver image.ImageVersion,
 	sigKeys []sec.PrivSignKey, encKeyFilename string, encKeyIndex int,
-	hdrPad int, imagePad int, sections string, useLegacyTLV bool) error {
+	hdrPad int, imagePad int, sections string, useLegacyTLV bool,
+	sbomFormat string) error {
 
 	popts, err := OptsFromTgtBldr(t, ver, sigKeys, encKeyFilename, encKeyIndex,
 		hdrPad, imagePad, nil, false)
@@ -233,6 +238,14 @@ func ProduceAllV1(t *builder.TargetBuilder, ver image.ImageVersion,
 		mopts.LoaderHash = pset.Loader.Hash
 	}
 
+	if sbomFormat != "" {
+		mopts.Sbom, err = ProduceSbom(t, sbomFormat, mopts.AppHash,
+			mopts.LoaderHash)
+		if err != nil {
+			return err
+		}
+	}
+
 	if err := ProduceManifest(mopts); err != nil {
 		return err
 	}
@@ -0,0 +1,267 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package license
+
+import (
+	"sort"
+
+	"github.com/dachalco/mynewt-newt/newt/builder"
+	"github.com/dachalco/mynewt-newt/newt/pkg"
+	"github.com/dachalco/mynewt-newt/newt/project"
+	"github.com/dachalco/mynewt-newt/newt/target"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// A Finding is a single license that applies to a package.
+type Finding struct {
+	License string
+	Source  string
+
+	// Source file containing the SPDX header; only set for SRC_SPDX_HDR.
+	Path string
+}
+
+type PkgReport struct {
+	Name     string
+	Findings []Finding
+}
+
+// A Violation is a license that is not in the allow-list.
+type Violation struct {
+	Pkg string
+	Finding
+
+	// Chain of dependencies that pulled the package into the target, starting
+	// from a top-level package and ending with the offending package.
+	Chain []string
+}
+
+type CheckReport struct {
+	Target string
+	Allow  []string
+
+	// Whether the target is a simulator target.
+	Sim bool
+
+	// Packages whose licenses were checked.
+	Checked []PkgReport
+
+	// Packages that don't ship, mapped to the reason why.
+	Skipped map[string]string
+
+	Violations []Violation
+}
+
+// AllowList retrieves the license allow-list that applies to a target.  A
+// `target.license_allow` setting in the target overrides the project's
+// `project.license_allow` setting.
+func AllowList(t *target.Target) []string {
+	if t.LicenseAllow != nil {
+		return t.LicenseAllow
+	}
+
+	return project.GetProject().LicenseAllow()
+}
+
+// PkgFindings collects the licenses that apply to a package: its declared
+// license and the licenses in the SPDX headers of its source files.  An
+// unknown declared license is ignored if the sources declare any licenses.
+func PkgFindings(lpkg *pkg.LocalPackage) ([]Finding, error) {
+	findings := []Finding{}
+
+	sls, err := SourceLicenses(lpkg)
+	if err != nil {
+		return nil, err
+	}
+
+	lic, src := PkgLicense(lpkg)
+	if lic != NOASSERTION || len(sls) == 0 {
+		findings = append(findings, Finding{
+			License: lic,
+			Source:  src,
+		})
+	}
+
+	seen := map[string]struct{}{lic: struct{}{}}
+	for _, sl := range sls {
+		if _, ok := seen[sl.License]; ok {
+			continue
+		}
+		seen[sl.License] = struct{}{}
+
+		findings = append(findings, Finding{
+			License: sl.License,
+			Source:  SRC_SPDX_HDR,
+			Path:    sl.Path,
+		})
+	}
+
+	return findings, nil
+}
+
+// skipReason indicates why a package's code does not ship in the target's
+// images.  It returns "" if the package ships.
+func skipReason(lpkg *pkg.LocalPackage) string {
+	switch lpkg.Type() {
+	case pkg.PACKAGE_TYPE_UNITTEST:
+		return "unit test"
+	case pkg.PACKAGE_TYPE_COMPILER:
+		return "toolchain"
+	default:
+		return ""
+	}
+}
+
+// depChain finds the shortest chain of shipping packages that depend on the
+// specified package.  The chain starts at a package that nothing else
+// depends on.
+func depChain(rdg builder.DepGraph, skipped map[string]string,
+	name string) []string {
+
+	prev := map[string]string{name: ""}
+	queue := []string{name}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		root := true
+		for _, e := range rdg[cur] {
+			if _, ok := skipped[e.PkgName]; ok {
+				continue
+			}
+			root = false
+
+			if _, ok := prev[e.PkgName]; !ok {
+				prev[e.PkgName] = cur
+				queue = append(queue, e.PkgName)
+			}
+		}
+
+		if root {
+			chain := []string{}
+			for n := cur; n != ""; n = prev[n] {
+				chain = append(chain, n)
+			}
+			return chain
+		}
+	}
+
+	// Every path leads to a cycle; just report the package itself.
+	return []string{name}
+}
+
+// Check verifies that every package that ships in the target's images has a
+// license in the specified allow-list.  Unit test and toolchain packages do
+// not ship, nor do packages that are only required by them.  Simulator
+// targets don't ship at all, so none of their packages are checked.
+func Check(t *builder.TargetBuilder, allow []string) (*CheckReport, error) {
+	res, err := t.Resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	rdg, err := t.CreateRevdepGraph()
+	if err != nil {
+		return nil, err
+	}
+
+	rpt := &CheckReport{
+		Target:  t.GetTarget().FullName(),
+		Allow:   allow,
+		Skipped: map[string]string{},
+	}
+
+	rpt.Sim = t.BspPkg().Arch == "sim"
+
+	names := make([]string, 0, len(res.MasterSet.Rpkgs))
+	lpkgs := map[string]*pkg.LocalPackage{}
+	for _, rpkg := range res.MasterSet.Rpkgs {
+		name := rpkg.Lpkg.FullName()
+		names = append(names, name)
+		lpkgs[name] = rpkg.Lpkg
+
+		if rpt.Sim {
+			rpt.Skipped[name] = "simulator target"
+		} else if reason := skipReason(rpkg.Lpkg); reason != "" {
+			rpt.Skipped[name] = reason
+		}
+	}
+	sort.Strings(names)
+
+	// A package doesn't ship if it is only required by packages that don't
+	// ship.  Repeat until no more packages are skipped.
+	for {
+		changed := false
+		for _, name := range names {
+			if _, ok := rpt.Skipped[name]; ok || len(rdg[name]) == 0 {
+				continue
+			}
+
+			shipped := false
+			for _, e := range rdg[name] {
+				if _, ok := rpt.Skipped[e.PkgName]; !ok {
+					shipped = true
+					break
+				}
+			}
+			if !shipped {
+				rpt.Skipped[name] = "only required by packages that don't ship"
+				changed = true
+			}
+		}
+
+		if !changed {
+			break
+		}
+	}
+
+	for _, name := range names {
+		if _, ok := rpt.Skipped[name]; ok {
+			continue
+		}
+
+		findings, err := PkgFindings(lpkgs[name])
+		if err != nil {
+			return nil, err
+		}
+		rpt.Checked = append(rpt.Checked, PkgReport{
+			Name:     name,
+			Findings: findings,
+		})
+
+		for _, f := range findings {
+			ok, err := Allowed(f.License, allow)
+			if err != nil {
+				return nil, util.FmtNewtError("package \"%s\": %s",
+					name, err.Error())
+			}
+			if !ok {
+				rpt.Violations = append(rpt.Violations, Violation{
+					Pkg:     name,
+					Finding: f,
+					Chain:   depChain(rdg, rpt.Skipped, name),
+				})
+			}
+		}
+	}
+
+	return rpt, nil
+}
@@ -0,0 +1,158 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package license
+
+import (
+	"strings"
+
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// exprParser evaluates an SPDX license expression against an allow-list.
+// Supported syntax:
+//     <expr>   ::= <and> [OR <and>...]
+//     <and>    ::= <atom> [AND <atom>...]
+//     <atom>   ::= <id> [WITH <exception>] | "(" <expr> ")"
+// An OR expression is allowed if any of its operands is allowed; an AND
+// expression is allowed only if all of its operands are.  A license with an
+// exception is allowed if the base license is.
+type exprParser struct {
+	toks  []string
+	pos   int
+	allow map[string]struct{}
+}
+
+func tokenizeExpr(expr string) []string {
+	expr = strings.Replace(expr, "(", " ( ", -1)
+	expr = strings.Replace(expr, ")", " ) ", -1)
+	return strings.Fields(expr)
+}
+
+func (p *exprParser) peek() string {
+	if p.pos >= len(p.toks) {
+		return ""
+	}
+	return p.toks[p.pos]
+}
+
+func (p *exprParser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *exprParser) parseExpr() (bool, error) {
+	ok, err := p.parseAnd()
+	if err != nil {
+		return false, err
+	}
+
+	for strings.ToUpper(p.peek()) == "OR" {
+		p.next()
+		ok2, err := p.parseAnd()
+		if err != nil {
+			return false, err
+		}
+		ok = ok || ok2
+	}
+
+	return ok, nil
+}
+
+func (p *exprParser) parseAnd() (bool, error) {
+	ok, err := p.parseAtom()
+	if err != nil {
+		return false, err
+	}
+
+	for strings.ToUpper(p.peek()) == "AND" {
+		p.next()
+		ok2, err := p.parseAtom()
+		if err != nil {
+			return false, err
+		}
+		ok = ok && ok2
+	}
+
+	return ok, nil
+}
+
+func (p *exprParser) parseAtom() (bool, error) {
+	tok := p.next()
+	switch strings.ToUpper(tok) {
+	case "":
+		return false, util.NewNewtError("unexpected end of expression")
+
+	case "(":
+		ok, err := p.parseExpr()
+		if err != nil {
+			return false, err
+		}
+		if p.next() != ")" {
+			return false, util.NewNewtError("missing ')'")
+		}
+		return ok, nil
+
+	case ")", "AND", "OR", "WITH":
+		return false, util.FmtNewtError("unexpected \"%s\"", tok)
+
+	default:
+		if strings.ToUpper(p.peek()) == "WITH" {
+			p.next()
+			if exc := p.next(); exc == "" || exc == "(" || exc == ")" {
+				return false, util.NewNewtError(
+					"missing exception after \"WITH\"")
+			}
+		}
+		_, ok := p.allow[tok]
+		return ok, nil
+	}
+}
+
+// Allowed indicates whether the specified SPDX license expression is
+// permitted by an allow-list of license identifiers.  An allow-list entry
+// may also be a complete expression, in which case it matches that
+// expression exactly.
+func Allowed(expr string, allow []string) (bool, error) {
+	m := make(map[string]struct{}, len(allow))
+	for _, a := range allow {
+		m[a] = struct{}{}
+	}
+
+	if _, ok := m[expr]; ok {
+		return true, nil
+	}
+
+	p := exprParser{
+		toks:  tokenizeExpr(expr),
+		allow: m,
+	}
+
+	ok, err := p.parseExpr()
+	if err == nil && p.pos < len(p.toks) {
+		err = util.FmtNewtError("unexpected \"%s\"", p.peek())
+	}
+	if err != nil {
+		return false, util.FmtNewtError(
+			"invalid license expression \"%s\": %s", expr, err.Error())
+	}
+
+	return ok, nil
+}
@@ -0,0 +1,164 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package license determines the licenses of packages.  A package's license
+// is taken from the `pkg.license` field in its `pkg.yml` file.  If that field
+// is absent, the license of the package's repo is used, as identified from
+// the repo's LICENSE file.  Licenses declared in SPDX headers of a package's
+// source files also apply to the package.
+package license
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/dachalco/mynewt-newt/newt/pkg"
+	"github.com/dachalco/mynewt-newt/newt/repo"
+)
+
+// The SPDX value indicating that a license could not be determined.
+const NOASSERTION = "NOASSERTION"
+
+// Where a package's license was obtained from.
+const (
+	SRC_PKG_YML  = "pkg.yml"
+	SRC_REPO     = "repo"
+	SRC_SPDX_HDR = "spdx-header"
+	SRC_UNKNOWN  = "unknown"
+)
+
+// Candidate license filenames at the root of a repo, in order of preference.
+var licenseFilenames = []string{
+	"LICENSE",
+	"LICENSE.txt",
+	"LICENSE.md",
+	"COPYING",
+}
+
+var spdxRe = regexp.MustCompile(`SPDX-License-Identifier:\s*([^\s*/][^*\n]*)`)
+
+// Each entry maps a set of phrases, all of which must be present in a
+// license text, to an SPDX identifier.  More specific entries come first.
+var licenseSigs = []struct {
+	phrases []string
+	id      string
+}{
+	{[]string{"Apache License", "Version 2.0"}, "Apache-2.0"},
+	{[]string{"GNU LESSER GENERAL PUBLIC LICENSE", "Version 2.1"},
+		"LGPL-2.1-only"},
+	{[]string{"GNU LESSER GENERAL PUBLIC LICENSE", "Version 3"},
+		"LGPL-3.0-only"},
+	{[]string{"GNU GENERAL PUBLIC LICENSE", "Version 2"}, "GPL-2.0-only"},
+	{[]string{"GNU GENERAL PUBLIC LICENSE", "Version 3"}, "GPL-3.0-only"},
+	{[]string{"Mozilla Public License", "2.0"}, "MPL-2.0"},
+	{[]string{"Permission is hereby granted, free of charge"}, "MIT"},
+	{[]string{"Permission to use, copy, modify, and/or distribute"}, "ISC"},
+	{[]string{"Redistribution and use in source and binary forms",
+		"Neither the name"}, "BSD-3-Clause"},
+	{[]string{"Redistribution and use in source and binary forms"},
+		"BSD-2-Clause"},
+}
+
+var repoLicenseMtx sync.Mutex
+var repoLicenses = map[*repo.Repo]string{}
+
+// FindSpdxIds extracts the SPDX license identifiers declared in the specified
+// text (e.g., "SPDX-License-Identifier: Apache-2.0").
+func FindSpdxIds(text []byte) []string {
+	ids := []string{}
+	for _, m := range spdxRe.FindAllSubmatch(text, -1) {
+		id := strings.TrimSpace(string(m[1]))
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+// Identify attempts to determine the SPDX identifier of the specified license
+// text.  It returns "" if the license is not recognized.
+func Identify(text []byte) string {
+	if ids := FindSpdxIds(text); len(ids) > 0 {
+		return ids[0]
+	}
+
+	for _, sig := range licenseSigs {
+		match := true
+		for _, phrase := range sig.phrases {
+			if !bytes.Contains(text, []byte(phrase)) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return sig.id
+		}
+	}
+
+	return ""
+}
+
+// RepoLicense identifies the license of a repo from its LICENSE file.  It
+// returns "" if the repo has no LICENSE file or if its license is not
+// recognized.
+func RepoLicense(r *repo.Repo) string {
+	if r == nil {
+		return ""
+	}
+
+	repoLicenseMtx.Lock()
+	defer repoLicenseMtx.Unlock()
+
+	if id, ok := repoLicenses[r]; ok {
+		return id
+	}
+
+	id := ""
+	for _, name := range licenseFilenames {
+		text, err := ioutil.ReadFile(filepath.Join(r.Path(), name))
+		if err == nil {
+			id = Identify(text)
+			break
+		}
+	}
+
+	repoLicenses[r] = id
+	return id
+}
+
+// PkgLicense determines the license of a package and where it came from (one
+// of the SRC_[...] constants).  If the license cannot be determined,
+// NOASSERTION is returned.
+func PkgLicense(lpkg *pkg.LocalPackage) (string, string) {
+	if lpkg.Desc() != nil && lpkg.Desc().License != "" {
+		return lpkg.Desc().License, SRC_PKG_YML
+	}
+
+	r, _ := lpkg.Repo().(*repo.Repo)
+	if id := RepoLicense(r); id != "" {
+		return id, SRC_REPO
+	}
+
+	return NOASSERTION, SRC_UNKNOWN
+}
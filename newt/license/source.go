@@ -0,0 +1,117 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package license
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dachalco/mynewt-newt/newt/pkg"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// Only the start of each source file is searched for SPDX headers.
+const spdxHdrMaxLen = 4096
+
+var sourceExts = map[string]struct{}{
+	".c":   struct{}{},
+	".h":   struct{}{},
+	".cc":  struct{}{},
+	".cpp": struct{}{},
+	".cxx": struct{}{},
+	".hpp": struct{}{},
+	".s":   struct{}{},
+	".S":   struct{}{},
+	".ld":  struct{}{},
+}
+
+// A SourceLicense is an SPDX license identifier found in a source file.
+type SourceLicense struct {
+	License string
+	Path    string
+}
+
+func readHead(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b := make([]byte, spdxHdrMaxLen)
+	n, err := io.ReadFull(f, b)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+
+	return b[:n], nil
+}
+
+// SourceLicenses collects the SPDX license identifiers declared in the headers
+// of a package's source files.  Directories belonging to nested packages are
+// not searched.
+func SourceLicenses(lpkg *pkg.LocalPackage) ([]SourceLicense, error) {
+	base := lpkg.BasePath()
+	sls := []SourceLicense{}
+
+	err := filepath.Walk(base,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if info.IsDir() {
+				if path == base {
+					return nil
+				}
+				if strings.HasPrefix(info.Name(), ".") {
+					return filepath.SkipDir
+				}
+				if util.NodeExist(filepath.Join(path, pkg.PACKAGE_FILE_NAME)) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if _, ok := sourceExts[filepath.Ext(path)]; !ok {
+				return nil
+			}
+
+			text, err := readHead(path)
+			if err != nil {
+				return err
+			}
+			for _, id := range FindSpdxIds(text) {
+				sls = append(sls, SourceLicense{
+					License: id,
+					Path:    path,
+				})
+			}
+
+			return nil
+		})
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return sls, nil
+}
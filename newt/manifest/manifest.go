@@ -49,6 +49,47 @@ type ManifestCreateOpts struct {
 	Version    image.ImageVersion
 	BuildID    string
 	Syscfg     map[string]string
+
+	// Optional; describes the SBOM generated alongside the image.
+	Sbom *SbomRef
+}
+
+// SbomRef identifies an SBOM file and its contents.  It is embedded in the
+// manifest under the "sbom" key.
+type SbomRef struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	Hash   string `json:"hash"`
+}
+
+// ManifestPkg is a package entry in the manifest.  It extends the artifact
+// library's entry with the package's version (pkg.version), if it has one.
+type ManifestPkg struct {
+	*manifest.ManifestPkg
+	Version string `json:"version,omitempty"`
+}
+
+// VersionedPkgs adds versions to a set of manifest package entries.  The
+// entries' packages are looked up among those in the specified build.
+func VersionedPkgs(ips []*manifest.ManifestPkg,
+	b *builder.Builder) []ManifestPkg {
+
+	lpkgs := map[string]*pkg.LocalPackage{}
+	for _, rpkg := range b.SortedRpkgs() {
+		lpkgs[rpkg.Lpkg.FullName()] = rpkg.Lpkg
+	}
+
+	mps := make([]ManifestPkg, len(ips))
+	for i, ip := range ips {
+		mps[i].ManifestPkg = ip
+		if lpkg := lpkgs[ip.Name]; lpkg != nil {
+			if ver, ok, _ := lpkg.Version(); ok {
+				mps[i].Version = ver.String()
+			}
+		}
+	}
+
+	return mps
 }
 
 type RepoManager struct {
@@ -151,6 +151,7 @@ func main() {
 	cmd := newtCmd()
 
 	cli.AddBuildCommands(cmd)
+	cli.AddCacheCommands(cmd)
 	cli.AddCompleteCommands(cmd)
 	cli.AddImageCommands(cmd)
 	cli.AddPackageCommands(cmd)
@@ -158,6 +159,7 @@ func main() {
 	cli.AddRunCommands(cmd)
 	cli.AddTargetCommands(cmd)
 	cli.AddValsCommands(cmd)
+	cli.AddWorkerCommands(cmd)
 	cli.AddMfgCommands(cmd)
 	cli.AddDocsCommands(cmd)
 	cli.AddManCommands(cmd)
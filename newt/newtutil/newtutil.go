@@ -36,6 +36,12 @@ var NewtDate = "unknown"
 
 var NewtBlinkyTag string = "master"
 var NewtNumJobs int
+var NewtKeepGoing bool
+var NewtReproducible bool
+
+// Formats to export the resolved syscfg in during a build (see
+// syscfg.ExportFormats).
+var NewtSyscfgExport []string
 var NewtForce bool
 var NewtAsk bool
 
@@ -77,6 +83,17 @@ func ParseVersion(s string) (Version, error) {
 	return v, nil
 }
 
+// ParsePartialVersion parses a version string of the form X[.Y[.Z]].
+// Unspecified parts are zero.
+func ParsePartialVersion(s string) (Version, error) {
+	parts := strings.Split(s, ".")
+	for len(parts) < 3 {
+		parts = append(parts, "0")
+	}
+
+	return ParseVersion(strings.Join(parts, "."))
+}
+
 func (v *Version) String() string {
 	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Revision)
 }
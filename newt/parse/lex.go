@@ -44,6 +44,16 @@ const (
 	TOKEN_STRING
 	TOKEN_NUMBER
 	TOKEN_IDENT
+	TOKEN_PLUS
+	TOKEN_MINUS
+	TOKEN_STAR
+	TOKEN_SLASH
+	TOKEN_PERCENT
+	TOKEN_LSHIFT
+	TOKEN_RSHIFT
+	TOKEN_BITAND
+	TOKEN_BITOR
+	TOKEN_COMMA
 )
 
 type Token struct {
@@ -55,7 +65,7 @@ type Token struct {
 // Returns length of token on success; 0 if no match.
 type LexFn func(s string) (string, int, error)
 
-const delimChars = "!='\"&|^() \t\n"
+const delimChars = "!='\"&|^()<>+-*/%, \t\n"
 
 func lexString(s string, sought string) (string, int, error) {
 	if strings.HasPrefix(s, sought) {
@@ -117,11 +127,21 @@ var lexEntries = []lexEntry{
 	{TOKEN_AND, lexStringFn("&&")},
 	{TOKEN_OR, lexStringFn("||")},
 	{TOKEN_XOR, lexStringFn("^^")},
+	{TOKEN_LSHIFT, lexStringFn("<<")},
+	{TOKEN_RSHIFT, lexStringFn(">>")},
 	{TOKEN_LTE, lexStringFn("<=")},
 	{TOKEN_GTE, lexStringFn(">=")},
 	{TOKEN_NOT, lexStringFn("!")},
 	{TOKEN_LT, lexStringFn("<")},
 	{TOKEN_GT, lexStringFn(">")},
+	{TOKEN_BITAND, lexStringFn("&")},
+	{TOKEN_BITOR, lexStringFn("|")},
+	{TOKEN_PLUS, lexStringFn("+")},
+	{TOKEN_MINUS, lexStringFn("-")},
+	{TOKEN_STAR, lexStringFn("*")},
+	{TOKEN_SLASH, lexStringFn("/")},
+	{TOKEN_PERCENT, lexStringFn("%")},
+	{TOKEN_COMMA, lexStringFn(",")},
 	{TOKEN_LPAREN, lexStringFn("(")},
 	{TOKEN_RPAREN, lexStringFn(")")},
 	{TOKEN_STRING, lexLitString},
@@ -181,6 +201,38 @@ func Lex(expr string) ([]Token, error) {
 	return tokens, nil
 }
 
+// Extracts the setting names referenced by a token sequence.  Function names
+// are excluded.
+func IdentNames(tokens []Token) []string {
+	var names []string
+
+	for i, t := range tokens {
+		if t.Code == TOKEN_IDENT {
+			if i+1 < len(tokens) && tokens[i+1].Code == TOKEN_LPAREN {
+				continue
+			}
+			names = append(names, t.Text)
+		}
+	}
+
+	return names
+}
+
+// Extracts the names of the functions called in a token sequence.
+func FuncNames(tokens []Token) []string {
+	var names []string
+
+	for i, t := range tokens {
+		if t.Code == TOKEN_IDENT &&
+			i+1 < len(tokens) && tokens[i+1].Code == TOKEN_LPAREN {
+
+			names = append(names, t.Text)
+		}
+	}
+
+	return names
+}
+
 // Produces a string representation of a token sequence.
 func SprintfTokens(tokens []Token) string {
 	s := ""
@@ -22,16 +22,26 @@ package parse
 import (
 	"fmt"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/dachalco/mynewt-newt/util"
 )
 
 // expr     ::= <unary><expr> | "("<expr>")" |
-//              <expr><binary><expr> | <ident> | <literal>
+//              <expr><binary><expr> | <ident> | <literal> |
+//              <func>"("<expr> { "," <expr> }")"
 // ident    ::= <printable-char> { <printable-char> }
 // literal  ::= """ <printable-char> { <printable-char> } """
-// unary    ::= "!"
-// binary   ::= "&&" | "^^" | "||" | "==" | "!=" | "<" | "<=" | ">" | ">="
+// unary    ::= "!" | "-"
+// binary   ::= "&&" | "^^" | "||" | "|" | "&" | "==" | "!=" |
+//              "<" | "<=" | ">" | ">=" | "<<" | ">>" |
+//              "+" | "-" | "*" | "/" | "%"
+// func     ::= "defined" | "min" | "max" | "in" |
+//              "flash_size" | "flash_offset" | "ram_size" |
+//              "mem_size" | "mem_used"
+//
+// Arithmetic and bitwise operators have C integer semantics.
 
 type ParseCode int
 
@@ -49,6 +59,17 @@ const (
 	PARSE_NUMBER
 	PARSE_STRING
 	PARSE_IDENT
+	PARSE_ADD
+	PARSE_SUB
+	PARSE_MUL
+	PARSE_DIV
+	PARSE_MOD
+	PARSE_LSHIFT
+	PARSE_RSHIFT
+	PARSE_BITAND
+	PARSE_BITOR
+	PARSE_NEG
+	PARSE_FUNC
 )
 
 type Node struct {
@@ -57,6 +78,76 @@ type Node struct {
 
 	Left  *Node
 	Right *Node
+
+	// Function arguments; only used by PARSE_FUNC nodes.
+	Args []*Node
+}
+
+// Precedence of each binary operator; higher values bind more tightly.
+var binaryPrecs = map[ParseCode]int{
+	PARSE_AND:        1,
+	PARSE_XOR:        2,
+	PARSE_OR:         3,
+	PARSE_BITOR:      4,
+	PARSE_BITAND:     5,
+	PARSE_EQUALS:     6,
+	PARSE_NOT_EQUALS: 6,
+	PARSE_LT:         7,
+	PARSE_LTE:        7,
+	PARSE_GT:         7,
+	PARSE_GTE:        7,
+	PARSE_LSHIFT:     8,
+	PARSE_RSHIFT:     8,
+	PARSE_ADD:        9,
+	PARSE_SUB:        9,
+	PARSE_MUL:        10,
+	PARSE_DIV:        10,
+	PARSE_MOD:        10,
+}
+
+// Operators at or above this precedence are left-associative.  Operators
+// below it are split at their leftmost occurrence, so they group to the
+// right.
+const leftAssocPrec = 6
+
+func (n *Node) isBinary() bool {
+	_, ok := binaryPrecs[n.Code]
+	return ok && n.Left != nil && n.Right != nil
+}
+
+// operandString converts an operand of this node to a string, parenthesizing
+// it if it would otherwise be parsed differently.
+func (n *Node) operandString(child *Node, isLeft bool) string {
+	if child == nil {
+		return ""
+	}
+
+	if !child.isBinary() {
+		return child.String()
+	}
+
+	// Unary operators bind more tightly than any binary operator.
+	if !n.isBinary() {
+		return "(" + child.String() + ")"
+	}
+
+	pp := binaryPrecs[n.Code]
+	cp := binaryPrecs[child.Code]
+
+	paren := cp < pp
+	if cp == pp {
+		if pp >= leftAssocPrec {
+			paren = !isLeft
+		} else {
+			paren = isLeft
+		}
+	}
+
+	if paren {
+		return "(" + child.String() + ")"
+	} else {
+		return child.String()
+	}
 }
 
 func (n *Node) String() string {
@@ -64,10 +155,18 @@ func (n *Node) String() string {
 		return ""
 	}
 
+	if n.Code == PARSE_FUNC {
+		args := make([]string, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = arg.String()
+		}
+		return n.Data + "(" + strings.Join(args, ", ") + ")"
+	}
+
 	s := ""
 
 	if n.Left != nil {
-		s += n.Left.String()
+		s += n.operandString(n.Left, true)
 	}
 
 	if n.Left != nil && n.Right != nil {
@@ -78,7 +177,7 @@ func (n *Node) String() string {
 	}
 
 	if n.Right != nil {
-		s += n.Right.String()
+		s += n.operandString(n.Right, false)
 	}
 
 	return s
@@ -96,6 +195,9 @@ func (n *Node) RpnString() string {
 	if n.Right != nil {
 		s += " " + n.Right.RpnString()
 	}
+	for _, arg := range n.Args {
+		s += " " + arg.RpnString()
+	}
 
 	return s
 }
@@ -157,6 +259,15 @@ func binTokenToParse(t TokenCode) ParseCode {
 		TOKEN_AND:        PARSE_AND,
 		TOKEN_OR:         PARSE_OR,
 		TOKEN_XOR:        PARSE_XOR,
+		TOKEN_BITOR:      PARSE_BITOR,
+		TOKEN_BITAND:     PARSE_BITAND,
+		TOKEN_LSHIFT:     PARSE_LSHIFT,
+		TOKEN_RSHIFT:     PARSE_RSHIFT,
+		TOKEN_PLUS:       PARSE_ADD,
+		TOKEN_MINUS:      PARSE_SUB,
+		TOKEN_STAR:       PARSE_MUL,
+		TOKEN_SLASH:      PARSE_DIV,
+		TOKEN_PERCENT:    PARSE_MOD,
 	}[t]
 }
 
@@ -190,23 +301,219 @@ var binaryTokens = []TokenCode{
 	TOKEN_AND,
 	TOKEN_XOR,
 	TOKEN_OR,
-	TOKEN_EQUALS,
-	TOKEN_NOT_EQUALS,
-	TOKEN_LT,
-	TOKEN_LTE,
-	TOKEN_GT,
-	TOKEN_GTE,
+	TOKEN_BITOR,
+	TOKEN_BITAND,
 	// Highest precedence.
 }
 
-func FindBinaryToken(tokens []Token) int {
+// Left-associative binary operators, grouped by precedence.  These have
+// higher precedence than any operator in `binaryTokens`.  As in C, a chained
+// comparison such as `1 < 2 < 3` compares the result of the first comparison
+// (0 or 1) with the third operand.
+var arithTokens = [][]TokenCode{
+	// Lowest precedence.
+	{TOKEN_EQUALS, TOKEN_NOT_EQUALS},
+	{TOKEN_LT, TOKEN_LTE, TOKEN_GT, TOKEN_GTE},
+	{TOKEN_LSHIFT, TOKEN_RSHIFT},
+	{TOKEN_PLUS, TOKEN_MINUS},
+	{TOKEN_STAR, TOKEN_SLASH, TOKEN_PERCENT},
+	// Highest precedence.
+}
+
+// Indicates whether the token at the specified index is a unary operator
+// rather than a binary one.  A "-" is unary if it is not preceded by an
+// operand.
+func isUnaryAt(tokens []Token, idx int) bool {
+	if tokens[idx].Code != TOKEN_MINUS {
+		return false
+	}
+	if idx == 0 {
+		return true
+	}
+
+	switch tokens[idx-1].Code {
+	case TOKEN_NUMBER, TOKEN_STRING, TOKEN_IDENT, TOKEN_RPAREN:
+		return false
+	default:
+		return true
+	}
+}
+
+// Searches a tokenized expression for the last binary operator that is a
+// member of the supplied token set.  This function does not descend into
+// parenthesized expressions.
+func findLastBinaryToken(tokens []Token, any []TokenCode) (int, error) {
+	pcount := 0
+
+	for i := len(tokens) - 1; i >= 0; i-- {
+		t := tokens[i]
+		if t.Code == TOKEN_RPAREN {
+			pcount++
+		} else if t.Code == TOKEN_LPAREN {
+			pcount--
+			if pcount < 0 {
+				return -1, fmt.Errorf("imbalanced parenthesis")
+			}
+		} else if pcount == 0 && !isUnaryAt(tokens, i) {
+			for _, a := range any {
+				if t.Code == a {
+					return i, nil
+				}
+			}
+		}
+	}
+
+	return -1, nil
+}
+
+// Finds the binary operator that a tokenized expression should be split at,
+// i.e., the lowest precedence operator that is not in parentheses.
+func findSplitToken(tokens []Token) (int, error) {
 	binIdx, err := findAnyToken(tokens, binaryTokens)
+	if err != nil || binIdx != -1 {
+		return binIdx, err
+	}
+
+	for _, codes := range arithTokens {
+		binIdx, err := findLastBinaryToken(tokens, codes)
+		if err != nil || binIdx != -1 {
+			return binIdx, err
+		}
+	}
+
+	return -1, nil
+}
+
+func FindBinaryToken(tokens []Token) int {
+	binIdx, err := findSplitToken(tokens)
 	if err != nil {
 		return -1
 	}
 	return binIdx
 }
 
+// Built-in functions and their permitted argument counts.  A max of -1
+// indicates no limit.
+var funcArgCounts = map[string][2]int{
+	"defined": {1, 1},
+	"min":     {1, -1},
+	"max":     {1, -1},
+	"in":      {2, -1},
+
+	// BSP properties.
+	"flash_size":   {1, 1},
+	"flash_offset": {1, 1},
+	"ram_size":     {0, 0},
+
+	// Link-time properties; only available after the image is linked.
+	"mem_size": {1, 1},
+	"mem_used": {1, 1},
+}
+
+// PropKey produces the key under which the value of a property function is
+// stored in a settings map.  For example, the size of the flash area
+// FLASH_AREA_LOG is looked up under `flash_size(FLASH_AREA_LOG)`.  Keys of
+// this form cannot collide with setting names.
+func PropKey(fn string, arg string) string {
+	return fn + "(" + arg + ")"
+}
+
+// IsPropFunc indicates whether the named function reads a BSP or link-time
+// property rather than a syscfg setting.
+func IsPropFunc(name string) bool {
+	switch name {
+	case "flash_size", "flash_offset", "ram_size", "mem_size", "mem_used":
+		return true
+	default:
+		return false
+	}
+}
+
+// IsLinkFunc indicates whether the named function reads a property that is
+// only known after the image has been linked.
+func IsLinkFunc(name string) bool {
+	return name == "mem_size" || name == "mem_used"
+}
+
+// Finds the parenthesis that closes the one at the specified index.
+func findCloseParen(tokens []Token, idx int) int {
+	pcount := 0
+	for i := idx; i < len(tokens); i++ {
+		switch tokens[i].Code {
+		case TOKEN_LPAREN:
+			pcount++
+		case TOKEN_RPAREN:
+			pcount--
+			if pcount == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// Parses a function call.  The first token is the function name and the
+// last is the closing parenthesis of the argument list.
+func parseFunc(tokens []Token) (*Node, error) {
+	name := tokens[0].Text
+	counts, ok := funcArgCounts[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function: %s", name)
+	}
+
+	n := &Node{
+		Code: PARSE_FUNC,
+		Data: name,
+	}
+
+	// Split the arguments at top-level commas.
+	argToks := tokens[2 : len(tokens)-1]
+	if len(argToks) > 0 {
+		pcount := 0
+		start := 0
+		for i := 0; i <= len(argToks); i++ {
+			if i < len(argToks) {
+				switch argToks[i].Code {
+				case TOKEN_LPAREN:
+					pcount++
+					continue
+				case TOKEN_RPAREN:
+					pcount--
+					continue
+				case TOKEN_COMMA:
+					if pcount != 0 {
+						continue
+					}
+				default:
+					continue
+				}
+			}
+
+			if i == start {
+				return nil, fmt.Errorf("empty argument to %s()", name)
+			}
+			arg, err := Parse(argToks[start:i])
+			if err != nil {
+				return nil, err
+			}
+			n.Args = append(n.Args, arg)
+			start = i + 1
+		}
+	}
+
+	if len(n.Args) < counts[0] || (counts[1] != -1 && len(n.Args) > counts[1]) {
+		return nil, fmt.Errorf("wrong number of arguments to %s(): %d",
+			name, len(n.Args))
+	}
+
+	if name == "defined" && n.Args[0].Code != PARSE_IDENT {
+		return nil, fmt.Errorf("argument to defined() must be a setting name")
+	}
+
+	return n, nil
+}
+
 // Recursively parses a tokenized expression.
 //
 // @param tokens                The sequence of tokens representing the
@@ -249,7 +556,7 @@ func Parse(tokens []Token) (*Node, error) {
 	////// Nonterminal symbols.
 
 	// <expr><binary><expr>
-	binIdx, err := findAnyToken(tokens, binaryTokens)
+	binIdx, err := findSplitToken(tokens)
 	if err != nil {
 		return nil, err
 	}
@@ -293,6 +600,39 @@ func Parse(tokens []Token) (*Node, error) {
 		return n, nil
 	}
 
+	if tokens[0].Code == TOKEN_MINUS {
+		// Fold negative number literals so that they can be compared to
+		// settings like any other number.
+		if len(tokens) == 2 && tokens[1].Code == TOKEN_NUMBER {
+			return &Node{
+				Code: PARSE_NUMBER,
+				Data: "-" + tokens[1].Text,
+			}, nil
+		}
+
+		n := &Node{
+			Code: PARSE_NEG,
+			Data: tokens[0].Text,
+		}
+		r, err := Parse(tokens[1:])
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			return nil, fmt.Errorf("missing operand for unary -")
+		}
+		n.Right = r
+		return n, nil
+	}
+
+	// <func>"("<expr> { "," <expr> }")"
+	if len(tokens) >= 3 && tokens[0].Code == TOKEN_IDENT &&
+		tokens[1].Code == TOKEN_LPAREN &&
+		findCloseParen(tokens, 1) == len(tokens)-1 {
+
+		return parseFunc(tokens)
+	}
+
 	// "("<expr>")"
 	if tokens[0].Code == TOKEN_LPAREN {
 		stripped, err := stripParens(tokens)
@@ -343,10 +683,254 @@ func coerceToInt(n *Node, settings map[string]string) (int, error) {
 		}
 		return num, nil
 
-	default:
+	case PARSE_STRING:
 		return 0,
 			util.FmtNewtError("expression `%s` is not a valid number",
 				n.String())
+
+	default:
+		return EvalInt(n, settings)
+	}
+}
+
+// Indicates whether an expression produces an integer rather than a boolean.
+func isIntExpr(n *Node) bool {
+	switch n.Code {
+	case PARSE_ADD, PARSE_SUB, PARSE_MUL, PARSE_DIV, PARSE_MOD,
+		PARSE_LSHIFT, PARSE_RSHIFT, PARSE_BITAND, PARSE_BITOR, PARSE_NEG:
+
+		return true
+
+	case PARSE_FUNC:
+		switch n.Data {
+		case "min", "max", "flash_size", "flash_offset", "ram_size",
+			"mem_size", "mem_used":
+
+			return true
+		default:
+			return false
+		}
+
+	default:
+		return false
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	} else {
+		return 0
+	}
+}
+
+// Evaluates an arithmetic or bitwise operation.
+func evalArith(expr *Node, settings map[string]string) (int, error) {
+	l, r, err := coerceTwoInts(expr.Left, expr.Right, settings, expr.Data)
+	if err != nil {
+		return 0, err
+	}
+
+	switch expr.Code {
+	case PARSE_ADD:
+		return l + r, nil
+	case PARSE_SUB:
+		return l - r, nil
+	case PARSE_MUL:
+		return l * r, nil
+	case PARSE_DIV, PARSE_MOD:
+		if r == 0 {
+			return 0, util.FmtNewtError("division by zero in `%s`",
+				expr.String())
+		}
+		if expr.Code == PARSE_DIV {
+			return l / r, nil
+		} else {
+			return l % r, nil
+		}
+	case PARSE_LSHIFT, PARSE_RSHIFT:
+		if r < 0 {
+			return 0, util.FmtNewtError("negative shift count in `%s`",
+				expr.String())
+		}
+		if expr.Code == PARSE_LSHIFT {
+			return l << uint(r), nil
+		} else {
+			return l >> uint(r), nil
+		}
+	case PARSE_BITAND:
+		return l & r, nil
+	case PARSE_BITOR:
+		return l | r, nil
+	default:
+		return 0, fmt.Errorf("invalid arithmetic parse code: %d", expr.Code)
+	}
+}
+
+// Retrieves the text value of a function argument.  Settings evaluate to
+// their values; integer expressions to their decimal representation.
+func argText(n *Node, settings map[string]string) (string, error) {
+	switch n.Code {
+	case PARSE_IDENT:
+		return settings[n.Data], nil
+	case PARSE_STRING, PARSE_NUMBER:
+		return n.Data, nil
+	default:
+		num, err := coerceToInt(n, settings)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(num), nil
+	}
+}
+
+// Evaluates a call to one of the built-in functions:
+//     defined(X)       True if setting X is defined.
+//     min(a, b, ...)   The smallest of the integer arguments.
+//     max(a, b, ...)   The largest of the integer arguments.
+//     in(X, a, b, ...) True if X is equal to any of the subsequent
+//                      arguments.
+//     flash_size(A)    The size of flash area A, in bytes.
+//     flash_offset(A)  The offset of flash area A, in bytes.
+//     ram_size()       The RAM size declared by the BSP, in bytes.
+//     mem_size(R)      The size of linker memory region R, in bytes.
+//     mem_used(R)      The number of bytes the linked image occupies in
+//                      memory region R.
+//
+// A flash area or memory region argument may be given directly, as a string,
+// or as a setting whose value names it (e.g., LOG_FCB_FLASH_AREA).
+func evalFunc(expr *Node, settings map[string]string) (int, error) {
+	switch expr.Data {
+	case "defined":
+		_, ok := settings[expr.Args[0].Data]
+		return boolToInt(ok), nil
+
+	case "min", "max":
+		var result int
+		for i, arg := range expr.Args {
+			num, err := coerceToInt(arg, settings)
+			if err != nil {
+				return 0, util.FmtNewtError("cannot apply %s() to `%s`; "+
+					"argument not a number", expr.Data, arg.String())
+			}
+			if i == 0 ||
+				(expr.Data == "min" && num < result) ||
+				(expr.Data == "max" && num > result) {
+
+				result = num
+			}
+		}
+		return result, nil
+
+	case "in":
+		needle, err := argText(expr.Args[0], settings)
+		if err != nil {
+			return 0, err
+		}
+		nnum, nok := util.AtoiNoOctTry(needle)
+
+		for _, arg := range expr.Args[1:] {
+			text, err := argText(arg, settings)
+			if err != nil {
+				return 0, err
+			}
+			if text == needle {
+				return 1, nil
+			}
+			if num, ok := util.AtoiNoOctTry(text); ok && nok && num == nnum {
+				return 1, nil
+			}
+		}
+		return 0, nil
+
+	case "flash_size", "flash_offset", "ram_size", "mem_size", "mem_used":
+		return evalPropFunc(expr, settings)
+
+	default:
+		return 0, fmt.Errorf("unknown function: %s", expr.Data)
+	}
+}
+
+// Evaluates a call to one of the property functions (flash_size(), etc.).
+func evalPropFunc(expr *Node, settings map[string]string) (int, error) {
+	arg := ""
+	if len(expr.Args) > 0 {
+		a := expr.Args[0]
+		switch a.Code {
+		case PARSE_IDENT:
+			// A setting may hold the name of the area or region.
+			arg = a.Data
+			if val := settings[a.Data]; val != "" {
+				if _, ok := util.AtoiNoOctTry(val); !ok {
+					arg = val
+				}
+			}
+		case PARSE_STRING:
+			arg = a.Data
+		default:
+			return 0, util.FmtNewtError("invalid argument to %s(): `%s`",
+				expr.Data, a.String())
+		}
+	}
+
+	val, ok := settings[PropKey(expr.Data, arg)]
+	if !ok {
+		switch expr.Data {
+		case "flash_size", "flash_offset":
+			return 0, util.FmtNewtError("unknown flash area: %s", arg)
+		case "ram_size":
+			return 0, util.NewNewtError("BSP does not specify a RAM size")
+		default:
+			return 0, util.FmtNewtError("unknown memory region: %s", arg)
+		}
+	}
+
+	num, ok := util.AtoiNoOctTry(val)
+	if !ok {
+		return 0, util.FmtNewtError("%s has invalid value `%s`",
+			PropKey(expr.Data, arg), val)
+	}
+	return num, nil
+}
+
+// Evaluates a fully-parsed expression as an integer.  Boolean operations
+// evaluate to 1 or 0.
+//
+// @param node                  The root of the expression to evaluate.
+// @param settings              The map of syscfg settings.
+//
+// @return int                  The integer value of the expression.
+func EvalInt(expr *Node, settings map[string]string) (int, error) {
+	if expr == nil {
+		return 0, util.NewNewtError("empty expression is not a number")
+	}
+
+	switch expr.Code {
+	case PARSE_NUMBER, PARSE_IDENT, PARSE_STRING:
+		return coerceToInt(expr, settings)
+
+	case PARSE_NEG:
+		r, err := coerceToInt(expr.Right, settings)
+		if err != nil {
+			return 0, util.FmtNewtError("cannot apply - to `%s`; "+
+				"operand not a number", expr.Right.String())
+		}
+		return -r, nil
+
+	case PARSE_ADD, PARSE_SUB, PARSE_MUL, PARSE_DIV, PARSE_MOD,
+		PARSE_LSHIFT, PARSE_RSHIFT, PARSE_BITAND, PARSE_BITOR:
+
+		return evalArith(expr, settings)
+
+	case PARSE_FUNC:
+		return evalFunc(expr, settings)
+
+	default:
+		b, err := Eval(expr, settings)
+		if err != nil {
+			return 0, err
+		}
+		return boolToInt(b), nil
 	}
 }
 
@@ -355,12 +939,18 @@ func coerceTwoInts(left *Node, right *Node,
 
 	lnum, err := coerceToInt(left, settings)
 	if err != nil {
+		if isIntExpr(left) {
+			return 0, 0, err
+		}
 		return 0, 0, util.FmtNewtError("cannot apply %s to `%s`; "+
 			"operand not a number", opStr, left.String())
 	}
 
 	rnum, err := coerceToInt(right, settings)
 	if err != nil {
+		if isIntExpr(right) {
+			return 0, 0, err
+		}
 		return 0, 0, util.FmtNewtError("cannot apply %s to `%s`; "+
 			"operand not a number", opStr, right.String())
 	}
@@ -491,6 +1081,15 @@ func evalEquals(
 		return val, nil
 	}
 
+	// If either operand is an integer expression, compare numerically.
+	if isIntExpr(left) || isIntExpr(right) {
+		l, r, err := coerceTwoInts(left, right, settings, "==")
+		if err != nil {
+			return false, err
+		}
+		return l == r, nil
+	}
+
 	// No special procedure identified.  Fallback to evaluating both operands
 	// as booleans and comparing the results.
 	booll, boolr, err := evalTwo(left, right, settings)
@@ -590,6 +1189,17 @@ func Eval(expr *Node, settings map[string]string) (bool, error) {
 		val := settings[expr.Data]
 		return ValueIsTrue(val), nil
 
+	case PARSE_ADD, PARSE_SUB, PARSE_MUL, PARSE_DIV, PARSE_MOD,
+		PARSE_LSHIFT, PARSE_RSHIFT, PARSE_BITAND, PARSE_BITOR, PARSE_NEG,
+		PARSE_FUNC:
+
+		// As in C, an integer is true if it is nonzero.
+		num, err := EvalInt(expr, settings)
+		if err != nil {
+			return false, err
+		}
+		return num != 0, nil
+
 	default:
 		return false, fmt.Errorf("invalid parse code: %d", expr.Code)
 	}
@@ -44,6 +44,7 @@ type BspPackage struct {
 	OptChkScript       string
 	ImageOffset        int
 	ImagePad           int
+	RamSize            int /* 0 if unspecified */
 	FlashMap           flashmap.FlashMap
 	BspV               ycfg.YCfg
 }
@@ -139,6 +140,18 @@ func (bsp *BspPackage) Reload(settings map[string]string) error {
 	bsp.ImagePad, err = bsp.BspV.GetValInt("bsp.image_pad", settings)
 	util.OneTimeWarningError(err)
 
+	ramSize, err := bsp.BspV.GetValString("bsp.ram_size", settings)
+	util.OneTimeWarningError(err)
+	bsp.RamSize = 0
+	if ramSize != "" {
+		bsp.RamSize, err = flashmap.ParseSize(ramSize)
+		if err != nil {
+			return util.FmtNewtError(
+				"BSP \"%s\" specifies invalid bsp.ram_size setting: %s",
+				bsp.Name(), ramSize)
+		}
+	}
+
 	bsp.LinkerScripts, err = bsp.resolveLinkerScriptSetting(
 		settings, "bsp.linkerscript")
 	if err != nil {
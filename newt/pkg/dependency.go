@@ -20,20 +20,121 @@
 package pkg
 
 import (
+	"strings"
+
 	"github.com/dachalco/mynewt-newt/newt/interfaces"
 	"github.com/dachalco/mynewt-newt/newt/newtutil"
 	"github.com/dachalco/mynewt-newt/newt/repo"
+	"github.com/dachalco/mynewt-newt/util"
 )
 
+// VersionReq is a constraint on the version of a dependency, e.g., ">=2.1".
+type VersionReq struct {
+	Op  string
+	Ver newtutil.Version
+}
+
 type Dependency struct {
 	Name string
 	Repo string
+
+	// Constraints on the depended-on package's version (pkg.version).  All
+	// must be satisfied.
+	VersionReqs []VersionReq
+}
+
+// Comparison operators permitted in version constraints.  Two-character
+// operators precede their one-character prefixes.
+var versionReqOps = []string{">=", "<=", "==", "!=", ">", "<", "="}
+
+// RejoinDepStrings reassembles dependency strings whose version constraints
+// were split off at whitespace when the dependency list was read (e.g.,
+// ["foo", ">=2.1"] becomes ["foo >=2.1"]).
+func RejoinDepStrings(strs []string) []string {
+	var joined []string
+	for _, s := range strs {
+		isReq := false
+		for _, op := range versionReqOps {
+			if strings.HasPrefix(s, op) {
+				isReq = true
+				break
+			}
+		}
+
+		if isReq && len(joined) > 0 {
+			joined[len(joined)-1] += " " + s
+		} else {
+			joined = append(joined, s)
+		}
+	}
+
+	return joined
+}
+
+func parseVersionReq(s string) (VersionReq, error) {
+	req := VersionReq{Op: "=="}
+
+	verStr := s
+	for _, op := range versionReqOps {
+		if strings.HasPrefix(s, op) {
+			req.Op = op
+			verStr = s[len(op):]
+			break
+		}
+	}
+	if req.Op == "=" {
+		req.Op = "=="
+	}
+
+	ver, err := newtutil.ParsePartialVersion(verStr)
+	if err != nil {
+		return req, util.FmtNewtError(
+			"invalid version constraint \"%s\"", s)
+	}
+	req.Ver = ver
+
+	return req, nil
+}
+
+func (req *VersionReq) String() string {
+	return req.Op + req.Ver.String()
+}
+
+// Satisfied indicates whether the specified version meets the constraint.
+func (req *VersionReq) Satisfied(ver newtutil.Version) bool {
+	cmp := newtutil.VerCmp(ver, req.Ver)
+
+	switch req.Op {
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case "!=":
+		return cmp != 0
+	default:
+		return cmp == 0
+	}
 }
 
 func (dep *Dependency) String() string {
 	return newtutil.BuildPackageString(dep.Repo, dep.Name)
 }
 
+// VersionReqsString describes the dependency's version constraints, e.g.,
+// ">=2.1.0 <3.0.0".
+func (dep *Dependency) VersionReqsString() string {
+	strs := make([]string, len(dep.VersionReqs))
+	for i, req := range dep.VersionReqs {
+		strs[i] = req.String()
+	}
+
+	return strings.Join(strs, " ")
+}
+
 func (dep *Dependency) SatisfiesDependency(pkg interfaces.PackageInterface) bool {
 	if dep.Name != pkg.Name() {
 		return false
@@ -70,11 +171,28 @@ func (dep *Dependency) setRepoAndName(parentRepo interfaces.RepoInterface, str s
 	return nil
 }
 
+// Init parses a dependency string: a package name optionally followed by
+// version constraints, separated by spaces or commas (e.g.,
+// "@mcu/hal/foo >=2.1,<3").
 func (dep *Dependency) Init(parentRepo interfaces.RepoInterface, depStr string) error {
-	if err := dep.setRepoAndName(parentRepo, depStr); err != nil {
+	fields := strings.Fields(strings.Replace(depStr, ",", " ", -1))
+	if len(fields) == 0 {
+		return util.NewNewtError("empty package dependency")
+	}
+
+	if err := dep.setRepoAndName(parentRepo, fields[0]); err != nil {
 		return err
 	}
 
+	for _, f := range fields[1:] {
+		req, err := parseVersionReq(f)
+		if err != nil {
+			return util.PreNewtError(err,
+				"invalid dependency \"%s\"", depStr)
+		}
+		dep.VersionReqs = append(dep.VersionReqs, req)
+	}
+
 	return nil
 }
 
@@ -20,7 +20,6 @@
 package pkg
 
 import (
-	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -32,7 +31,6 @@ import (
 	"github.com/dachalco/mynewt-newt/newt/repo"
 	"github.com/dachalco/mynewt-newt/newt/ycfg"
 	"github.com/dachalco/mynewt-newt/util"
-	"github.com/dachalco/mynewt-newt/yaml"
 )
 
 var PackageHashIgnoreDirs = map[string]bool{
@@ -135,6 +133,23 @@ func (pkg *LocalPackage) Desc() *PackageDesc {
 	return pkg.desc
 }
 
+// Version parses the package's version (pkg.version).  The bool return value
+// is false if the package does not specify a version.
+func (pkg *LocalPackage) Version() (newtutil.Version, bool, error) {
+	if pkg.desc == nil || pkg.desc.Version == "" {
+		return newtutil.Version{}, false, nil
+	}
+
+	ver, err := newtutil.ParsePartialVersion(pkg.desc.Version)
+	if err != nil {
+		return ver, false, util.FmtNewtError(
+			"package \"%s\" specifies invalid version (pkg.version): %s",
+			pkg.FullName(), pkg.desc.Version)
+	}
+
+	return ver, true, nil
+}
+
 func (pkg *LocalPackage) SetName(name string) {
 	pkg.name = name
 }
@@ -180,23 +195,13 @@ func (pkg *LocalPackage) readDesc(yc ycfg.YCfg) (*PackageDesc, error) {
 	pdesc.Keywords, err = yc.GetValStringSlice("pkg.keywords", nil)
 	util.OneTimeWarningError(err)
 
-	return pdesc, nil
-}
-
-func (pkg *LocalPackage) sequenceString(key string) string {
-	var buffer bytes.Buffer
+	pdesc.License, err = yc.GetValString("pkg.license", nil)
+	util.OneTimeWarningError(err)
 
-	vals, err := pkg.PkgY.GetValStringSlice(key, nil)
+	pdesc.Version, err = yc.GetValString("pkg.version", nil)
 	util.OneTimeWarningError(err)
-	for _, f := range vals {
-		buffer.WriteString("    - " + yaml.EscapeString(f) + "\n")
-	}
 
-	if buffer.Len() == 0 {
-		return ""
-	} else {
-		return key + ":\n" + buffer.String()
-	}
+	return pdesc, nil
 }
 
 func (lpkg *LocalPackage) SaveSyscfg() error {
@@ -205,19 +210,12 @@ func (lpkg *LocalPackage) SaveSyscfg() error {
 		return util.NewNewtError(err.Error())
 	}
 
-	file, err := os.Create(lpkg.SyscfgYamlPath())
-	if err != nil {
-		return util.NewNewtError(err.Error())
-	}
-	defer file.Close()
-
-	s := lpkg.SyscfgY.YAML()
-	file.WriteString(s)
-
-	return nil
+	return config.SaveFile(lpkg.SyscfgYamlPath(), lpkg.SyscfgY.AllSettings(),
+		nil)
 }
 
-// Saves the package's pkg.yml file.
+// Saves the package's pkg.yml file.  If the file already exists, it is
+// edited in place so that its comments and unrelated settings are preserved.
 // NOTE: This does not save every field in the package.  Only the fields
 // necessary for creating a new target get saved.
 func (pkg *LocalPackage) Save() error {
@@ -226,32 +224,24 @@ func (pkg *LocalPackage) Save() error {
 		return util.NewNewtError(err.Error())
 	}
 
-	file, err := os.Create(pkg.PkgYamlPath())
-	if err != nil {
-		return util.NewNewtError(err.Error())
-	}
-	defer file.Close()
-
-	// XXX: Just iterate ycfg object's settings rather than calling out
-	// cached settings individually.
-	file.WriteString("pkg.name: " + yaml.EscapeString(pkg.Name()) + "\n")
-	file.WriteString("pkg.type: " +
-		yaml.EscapeString(PackageTypeNames[pkg.Type()]) + "\n")
-	file.WriteString("pkg.description: " +
-		yaml.EscapeString(pkg.Desc().Description) + "\n")
-	file.WriteString("pkg.author: " +
-		yaml.EscapeString(pkg.Desc().Author) + "\n")
-	file.WriteString("pkg.homepage: " +
-		yaml.EscapeString(pkg.Desc().Homepage) + "\n")
-
-	file.WriteString("\n")
-
-	file.WriteString(pkg.sequenceString("pkg.aflags"))
-	file.WriteString(pkg.sequenceString("pkg.cflags"))
-	file.WriteString(pkg.sequenceString("pkg.cxxflags"))
-	file.WriteString(pkg.sequenceString("pkg.lflags"))
-
-	return nil
+	settings := pkg.PkgY.AllSettings()
+	settings["pkg.name"] = pkg.Name()
+	settings["pkg.type"] = PackageTypeNames[pkg.Type()]
+	settings["pkg.description"] = pkg.Desc().Description
+	settings["pkg.author"] = pkg.Desc().Author
+	settings["pkg.homepage"] = pkg.Desc().Homepage
+
+	return config.SaveFile(pkg.PkgYamlPath(), settings, []string{
+		"pkg.name",
+		"pkg.type",
+		"pkg.description",
+		"pkg.author",
+		"pkg.homepage",
+		"pkg.aflags",
+		"pkg.cflags",
+		"pkg.cxxflags",
+		"pkg.lflags",
+	})
 }
 
 func matchNamePath(name, path string) bool {
@@ -93,4 +93,8 @@ type PackageDesc struct {
 	Homepage    string
 	Description string
 	Keywords    []string
+	// SPDX license expression (e.g., "Apache-2.0")
+	License string
+	// Version of the package (X[.Y[.Z]]); empty if unversioned
+	Version string
 }
@@ -0,0 +1,167 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package pkg
+
+import (
+	"path"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"github.com/dachalco/mynewt-newt/newt/newtutil"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+const (
+	// Any package may depend on this one (default).
+	VISIBILITY_PUBLIC = "public"
+
+	// Only packages in the same repo may depend on this one.
+	VISIBILITY_REPO_PRIVATE = "repo-private"
+)
+
+// Visibility restricts which packages may depend on a package.  It is read
+// from the `pkg.visibility` field in pkg.yml, which is one of:
+//   - "public"
+//   - "repo-private"
+//   - A list of packages allowed to depend on this one.
+//
+// Entries in the list are package names or globs (e.g., "apps/foo/*").  A
+// trailing "/**" matches every package beneath a directory.  Names without a
+// repo prefix refer to packages in the same repo as the restricted package.
+type Visibility struct {
+	// VISIBILITY_PUBLIC, VISIBILITY_REPO_PRIVATE, or "" if only the packages
+	// in `Allowed` may depend on this package.
+	Mode string
+
+	// Allowed dependents; fully qualified (i.e., "@<repo>/<pkg>").
+	Allowed []string
+
+	// Repo containing the restricted package.
+	repoName string
+}
+
+// Visibility reads the package's `pkg.visibility` setting.
+func (pkg *LocalPackage) Visibility() (Visibility, error) {
+	v := Visibility{
+		Mode:     VISIBILITY_PUBLIC,
+		repoName: pkg.Repo().Name(),
+	}
+
+	val, err := pkg.PkgY.GetFirstVal("pkg.visibility", nil)
+	util.OneTimeWarningError(err)
+
+	if val == nil {
+		return v, nil
+	}
+
+	var strs []string
+	switch val.(type) {
+	case []interface{}:
+		strs, err = cast.ToStringSliceE(val)
+		if err != nil || len(strs) == 0 {
+			return v, util.FmtNewtError(
+				"package \"%s\" specifies invalid visibility "+
+					"(pkg.visibility): %v", pkg.FullName(), val)
+		}
+
+	default:
+		s := cast.ToString(val)
+		if s == VISIBILITY_PUBLIC || s == VISIBILITY_REPO_PRIVATE {
+			v.Mode = s
+			return v, nil
+		}
+		strs = []string{s}
+	}
+
+	v.Mode = ""
+	for _, s := range strs {
+		pattern := s
+		if !strings.HasPrefix(pattern, "@") {
+			pattern = newtutil.BuildPackageString(v.repoName, pattern)
+		}
+
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/**"),
+			""); err != nil {
+
+			return v, util.FmtNewtError(
+				"package \"%s\" specifies invalid visibility pattern "+
+					"(pkg.visibility): %s", pkg.FullName(), s)
+		}
+
+		v.Allowed = append(v.Allowed, pattern)
+	}
+
+	return v, nil
+}
+
+// visibilityMatch indicates whether a fully qualified package name matches
+// an allowed-dependent pattern.
+func visibilityMatch(pattern string, name string) bool {
+	if prefix := strings.TrimSuffix(pattern, "/**"); prefix != pattern {
+		// Match the pattern's leading directories against the same number of
+		// directories in the package name.
+		n := strings.Count(prefix, "/") + 1
+		parts := strings.Split(name, "/")
+		if len(parts) < n {
+			return false
+		}
+
+		ok, _ := path.Match(prefix, strings.Join(parts[:n], "/"))
+		return ok
+	}
+
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// Permits indicates whether the specified package may depend on the package
+// with this visibility.
+func (v Visibility) Permits(depender *LocalPackage) bool {
+	switch v.Mode {
+	case VISIBILITY_PUBLIC:
+		return true
+
+	case VISIBILITY_REPO_PRIVATE:
+		return depender.Repo().Name() == v.repoName
+
+	default:
+		name := depender.NameWithRepo()
+		for _, pattern := range v.Allowed {
+			if visibilityMatch(pattern, name) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (v Visibility) String() string {
+	switch v.Mode {
+	case VISIBILITY_PUBLIC:
+		return "public"
+
+	case VISIBILITY_REPO_PRIVATE:
+		return "private to repo @" + v.repoName
+
+	default:
+		return "visible only to: " + strings.Join(v.Allowed, ", ")
+	}
+}
@@ -0,0 +1,344 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package profile records the timing of build phases and jobs.  The recorded
+// spans can be written as a Chrome trace-event file (viewable in
+// chrome://tracing or Perfetto) and summarized as text.
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// Span categories.
+const (
+	CAT_PHASE   = "phase"
+	CAT_RESOLVE = "resolve"
+	CAT_COMPILE = "compile"
+	CAT_ARCHIVE = "archive"
+	CAT_LINK    = "link"
+)
+
+// Thread ID of the main goroutine.  Build workers are numbered from 1.
+const TID_MAIN = 0
+
+// traceEvent is a single entry in a Chrome trace-event file.  Timestamps and
+// durations are in microseconds.
+type traceEvent struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat,omitempty"`
+	Ph   string                 `json:"ph"`
+	Ts   int64                  `json:"ts"`
+	Dur  int64                  `json:"dur,omitempty"`
+	Pid  int                    `json:"pid"`
+	Tid  int                    `json:"tid"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// A Span is a timed operation.  Spans are created with Begin and recorded
+// when End is called.  A nil span is valid and is a no-op; this is what Begin
+// returns when profiling is disabled.
+type Span struct {
+	name  string
+	cat   string
+	tid   int
+	start time.Time
+	args  map[string]interface{}
+}
+
+var mtx sync.Mutex
+var enabled bool
+var origin time.Time
+var events []traceEvent
+var tids = map[int]struct{}{}
+var critPaths []CriticalPath
+
+// A PathStep is one job along a critical path.
+type PathStep struct {
+	Name string
+	Dur  time.Duration
+}
+
+// A CriticalPath is the longest chain of dependent jobs in a job graph.  No
+// amount of additional parallelism can make the graph finish faster than its
+// critical path.
+type CriticalPath struct {
+	Name  string
+	Steps []PathStep
+}
+
+func (cp *CriticalPath) Dur() time.Duration {
+	var total time.Duration
+	for _, s := range cp.Steps {
+		total += s.Dur
+	}
+
+	return total
+}
+
+// Enable starts recording spans.
+func Enable() {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	enabled = true
+	origin = time.Now()
+	events = nil
+	tids = map[int]struct{}{}
+	critPaths = nil
+}
+
+// Enabled indicates whether spans are being recorded.
+func Enabled() bool {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	return enabled
+}
+
+// Begin starts a span on the specified thread.  It returns nil if profiling
+// is disabled.
+func Begin(cat string, name string, tid int) *Span {
+	if !Enabled() {
+		return nil
+	}
+
+	return &Span{
+		name:  name,
+		cat:   cat,
+		tid:   tid,
+		start: time.Now(),
+	}
+}
+
+// SetArg attaches a key-value pair to the span.
+func (s *Span) SetArg(key string, val interface{}) {
+	if s == nil {
+		return
+	}
+
+	if s.args == nil {
+		s.args = map[string]interface{}{}
+	}
+	s.args[key] = val
+}
+
+// End records the span.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	end := time.Now()
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if !enabled {
+		return
+	}
+
+	events = append(events, traceEvent{
+		Name: s.name,
+		Cat:  s.cat,
+		Ph:   "X",
+		Ts:   s.start.Sub(origin).Nanoseconds() / 1000,
+		Dur:  end.Sub(s.start).Nanoseconds() / 1000,
+		Pid:  1,
+		Tid:  s.tid,
+		Args: s.args,
+	})
+	tids[s.tid] = struct{}{}
+}
+
+// AddCriticalPath records the critical path of a job graph for inclusion in
+// the summary.
+func AddCriticalPath(cp CriticalPath) {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if enabled {
+		critPaths = append(critPaths, cp)
+	}
+}
+
+func threadName(tid int) string {
+	if tid == TID_MAIN {
+		return "main"
+	}
+
+	return fmt.Sprintf("worker %d", tid)
+}
+
+// Write writes all recorded spans to the specified file in the Chrome
+// trace-event format.
+func Write(path string) error {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	all := []traceEvent{
+		traceEvent{
+			Name: "process_name",
+			Ph:   "M",
+			Pid:  1,
+			Args: map[string]interface{}{"name": "newt"},
+		},
+	}
+
+	tidList := make([]int, 0, len(tids))
+	for tid, _ := range tids {
+		tidList = append(tidList, tid)
+	}
+	sort.Ints(tidList)
+
+	for _, tid := range tidList {
+		all = append(all, traceEvent{
+			Name: "thread_name",
+			Ph:   "M",
+			Pid:  1,
+			Tid:  tid,
+			Args: map[string]interface{}{"name": threadName(tid)},
+		})
+	}
+	all = append(all, events...)
+
+	b, err := json.MarshalIndent(map[string]interface{}{
+		"traceEvents":     all,
+		"displayTimeUnit": "ms",
+	}, "", "  ")
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return util.FmtNewtError(
+			"failed to write profile \"%s\": %s", path, err.Error())
+	}
+
+	return nil
+}
+
+type durEntry struct {
+	name string
+	dur  int64
+}
+
+func sortedEntries(m map[string]int64) []durEntry {
+	entries := make([]durEntry, 0, len(m))
+	for name, dur := range m {
+		entries = append(entries, durEntry{name, dur})
+	}
+	sort.Slice(entries, func(i int, j int) bool {
+		if entries[i].dur != entries[j].dur {
+			return entries[i].dur > entries[j].dur
+		}
+		return entries[i].name < entries[j].name
+	})
+
+	return entries
+}
+
+func fmtDur(us int64) string {
+	return fmt.Sprintf("%9.3fs", float64(us)/1e6)
+}
+
+func argString(args map[string]interface{}, key string) string {
+	if s, ok := args[key].(string); ok {
+		return s
+	}
+	return ""
+}
+
+// Summary produces a textual report of the recorded build: the duration of
+// each phase, the slowest packages and source files, and the critical path of
+// each job graph.  At most `limit` packages and files are listed.
+func Summary(limit int) string {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	phases := []traceEvent{}
+	pkgDurs := map[string]int64{}
+	fileDurs := map[string]int64{}
+
+	for _, e := range events {
+		switch e.Cat {
+		case CAT_PHASE:
+			phases = append(phases, e)
+
+		case CAT_COMPILE:
+			pkgDurs[argString(e.Args, "package")] += e.Dur
+			fileDurs[argString(e.Args, "file")] += e.Dur
+
+		case CAT_ARCHIVE:
+			pkgDurs[argString(e.Args, "package")] += e.Dur
+		}
+	}
+
+	sort.SliceStable(phases, func(i int, j int) bool {
+		return phases[i].Ts < phases[j].Ts
+	})
+
+	buffer := &bytes.Buffer{}
+
+	fmt.Fprintf(buffer, "Build phases:\n")
+	for _, p := range phases {
+		name := p.Name
+		if target := argString(p.Args, "target"); target != "" {
+			name = target + ": " + name
+		}
+		fmt.Fprintf(buffer, "    %s  %s\n", fmtDur(p.Dur), name)
+	}
+
+	printTop := func(title string, m map[string]int64) {
+		entries := sortedEntries(m)
+		if len(entries) > limit {
+			entries = entries[:limit]
+		}
+		if len(entries) == 0 {
+			return
+		}
+
+		fmt.Fprintf(buffer, "\n%s:\n", title)
+		for _, e := range entries {
+			fmt.Fprintf(buffer, "    %s  %s\n", fmtDur(e.dur), e.name)
+		}
+	}
+
+	printTop("Slowest packages (compile + archive time)", pkgDurs)
+	printTop("Slowest source files", fileDurs)
+
+	for _, cp := range critPaths {
+		fmt.Fprintf(buffer, "\nCritical path (%s): %.3fs\n", cp.Name,
+			cp.Dur().Seconds())
+		for _, step := range cp.Steps {
+			fmt.Fprintf(buffer, "    %s  %s\n",
+				fmtDur(step.Dur.Nanoseconds()/1000), step.Name)
+		}
+	}
+
+	return buffer.String()
+}
@@ -82,6 +82,10 @@ type Project struct {
 	// duplicate warnings.
 	unknownRepoVers map[string]struct{}
 
+	// SPDX license identifiers that may be linked into an app, as read from
+	// `project.yml`.
+	licenseAllow []string
+
 	yc ycfg.YCfg
 }
 
@@ -171,6 +175,10 @@ func (proj *Project) Name() string {
 	return proj.name
 }
 
+func (proj *Project) LicenseAllow() []string {
+	return proj.licenseAllow
+}
+
 func (proj *Project) Repos() map[string]*repo.Repo {
 	return proj.repos
 }
@@ -611,6 +619,9 @@ func (proj *Project) loadConfig(download bool) error {
 		r.AddIgnoreDir(dirName)
 	}
 
+	proj.licenseAllow, err = yc.GetValStringSlice("project.license_allow", nil)
+	util.OneTimeWarningError(err)
+
 	if err := proj.checkNewtVer(); err != nil {
 		return err
 	}
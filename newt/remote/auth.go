@@ -0,0 +1,146 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package remote
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+
+	"github.com/dachalco/mynewt-newt/newt/settings"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// Environment variable that overrides the token in newtrc.yml.
+const TOKEN_ENV_VAR = "NEWT_REMOTE_TOKEN"
+
+// Handshake messages.  A client opens a connection by sending
+// "<hsHello> <token>\n"; the worker answers with "<hsOk>\n" or "<hsDenied>\n".
+// RPCs are only served after a successful handshake.
+const (
+	hsHello  = "NEWT-REMOTE-1"
+	hsOk     = "OK"
+	hsDenied = "DENIED"
+)
+
+// How long a worker waits for a new connection to complete the handshake.
+const hsTimeout = 10 * time.Second
+
+// Token retrieves the shared secret that authenticates clients to workers.
+// It is read from the NEWT_REMOTE_TOKEN environment variable or from the
+// "remote.token" setting in newtrc.yml.
+func Token() string {
+	if t := os.Getenv(TOKEN_ENV_VAR); t != "" {
+		return t
+	}
+
+	t := cast.ToString(settings.NewtrcVal("remote", "token"))
+	return strings.TrimSpace(t)
+}
+
+func tokensEqual(a string, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+	return hmac.Equal(ha[:], hb[:])
+}
+
+// authConn couples a connection with the buffered reader used to read its
+// handshake, so that no buffered RPC data is lost.
+type authConn struct {
+	*bufio.Reader
+	net.Conn
+}
+
+func (c authConn) Read(p []byte) (int, error) {
+	return c.Reader.Read(p)
+}
+
+// acceptHandshake authenticates a new client connection.  On success, it
+// returns the connection to serve RPCs on.
+func acceptHandshake(conn net.Conn, token string) (io.ReadWriteCloser, error) {
+	conn.SetReadDeadline(time.Now().Add(hsTimeout))
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, util.FmtNewtError("handshake failed: %s", err.Error())
+	}
+
+	fields := strings.SplitN(strings.TrimRight(line, "\r\n"), " ", 2)
+	if len(fields) != 2 || fields[0] != hsHello ||
+		!tokensEqual(fields[1], token) {
+
+		conn.Write([]byte(hsDenied + "\n"))
+		return nil, util.NewNewtError("client sent an invalid token")
+	}
+
+	if _, err := conn.Write([]byte(hsOk + "\n")); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	conn.SetReadDeadline(time.Time{})
+	return authConn{r, conn}, nil
+}
+
+// dialHandshake connects to a worker and authenticates with the specified
+// token.
+func dialHandshake(addr string, token string) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", addr, hsTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(hsTimeout))
+	if _, err := conn.Write([]byte(hsHello + " " + token + "\n")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Read the reply one byte at a time so that no RPC data is consumed.
+	reply := []byte{}
+	b := make([]byte, 1)
+	for len(reply) < len(hsDenied)+1 {
+		if _, err := conn.Read(b); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if b[0] == '\n' {
+			break
+		}
+		reply = append(reply, b[0])
+	}
+	conn.SetDeadline(time.Time{})
+
+	if string(reply) != hsOk {
+		conn.Close()
+		return nil, util.FmtNewtError(
+			"worker %s rejected the remote token; check %s or "+
+				"\"remote.token\" in newtrc.yml", addr, TOKEN_ENV_VAR)
+	}
+
+	return conn, nil
+}
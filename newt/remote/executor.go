@@ -0,0 +1,194 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package remote
+
+import (
+	"io/ioutil"
+	"net/rpc"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/dachalco/mynewt-newt/newt/toolchain"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// Executor sends compile jobs to one or more worker daemons.  Jobs are
+// distributed among the workers in round-robin order.  If a worker cannot be
+// reached, the job is attempted on the next worker; if none can be reached,
+// the job is compiled locally.
+//
+// Assembly files are always assembled locally.
+type Executor struct {
+	addrs []string
+	token string
+
+	mtx     sync.Mutex
+	next    int
+	clients map[string]*rpc.Client
+}
+
+func NewExecutor(addrs []string, token string) *Executor {
+	return &Executor{
+		addrs:   addrs,
+		token:   token,
+		clients: map[string]*rpc.Client{},
+	}
+}
+
+func (e *Executor) nextAddr() string {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	addr := e.addrs[e.next]
+	e.next = (e.next + 1) % len(e.addrs)
+
+	return addr
+}
+
+// client retrieves the connection to the specified worker, connecting if
+// necessary.
+func (e *Executor) client(addr string) (*rpc.Client, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if c := e.clients[addr]; c != nil {
+		return c, nil
+	}
+
+	conn, err := dialHandshake(addr, e.token)
+	if err != nil {
+		return nil, err
+	}
+	c := rpc.NewClient(conn)
+	e.clients[addr] = c
+
+	return c, nil
+}
+
+// dropClient discards a broken connection so that the next job reconnects.
+func (e *Executor) dropClient(addr string, c *rpc.Client) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if e.clients[addr] == c {
+		c.Close()
+		delete(e.clients, addr)
+	}
+}
+
+// call sends a compile request to the first worker that accepts it.
+func (e *Executor) call(args *CompileArgs) (*CompileReply, error) {
+	var lastErr error
+
+	for i := 0; i < len(e.addrs); i++ {
+		addr := e.nextAddr()
+
+		c, err := e.client(addr)
+		if err != nil {
+			log.Debugf("Failed to connect to worker %s: %s", addr, err.Error())
+			lastErr = err
+			continue
+		}
+
+		reply := &CompileReply{}
+		if err := c.Call(rpcCompile, args, reply); err != nil {
+			log.Debugf("Compile request to worker %s failed: %s", addr,
+				err.Error())
+			if _, ok := err.(rpc.ServerError); !ok {
+				e.dropClient(addr, c)
+			}
+			lastErr = err
+			continue
+		}
+
+		return reply, nil
+	}
+
+	return nil, lastErr
+}
+
+func (e *Executor) Compile(job toolchain.ExecJob) (toolchain.ExecResult,
+	error) {
+
+	local := toolchain.LocalExecutor{}
+
+	var lang string
+	switch job.CompilerType {
+	case toolchain.COMPILER_TYPE_C:
+		lang = LANG_C
+	case toolchain.COMPILER_TYPE_CPP:
+		lang = LANG_CPP
+	default:
+		return local.Compile(job)
+	}
+
+	src, ppOutput, err := job.Preprocess()
+	if err != nil {
+		return toolchain.ExecResult{}, err
+	}
+
+	objName := filepath.Base(job.ObjPath)
+	reply, err := e.call(&CompileArgs{
+		Cmd:     job.BaseCmd(),
+		Lang:    lang,
+		Source:  src,
+		ObjName: objName,
+	})
+	if err != nil {
+		log.Warnf("Remote compile of %s failed (%s); compiling locally",
+			job.SrcPath(), err.Error())
+		return local.Compile(job)
+	}
+
+	output := append(ppOutput, reply.Output...)
+	if reply.ExitCode != 0 {
+		log.Debugf("Remote compile of %s exited with status %d",
+			job.SrcPath(), reply.ExitCode)
+		if len(output) == 0 {
+			return toolchain.ExecResult{}, util.FmtNewtError(
+				"compiler exited with status %d", reply.ExitCode)
+		}
+		return toolchain.ExecResult{}, util.NewNewtError(
+			strings.TrimRight(string(output), "\n") + "\n")
+	}
+
+	if err := ioutil.WriteFile(job.ObjPath, reply.Object, 0644); err != nil {
+		return toolchain.ExecResult{}, util.ChildNewtError(err)
+	}
+
+	return toolchain.ExecResult{
+		Output: output,
+		Deps:   reply.Deps,
+	}, nil
+}
+
+// Close disconnects from all workers.
+func (e *Executor) Close() {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	for addr, c := range e.clients {
+		c.Close()
+		delete(e.clients, addr)
+	}
+}
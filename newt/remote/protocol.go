@@ -0,0 +1,73 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package remote implements remote compilation.  A newt client preprocesses
+// each source file locally and ships the translation unit and compile command
+// to a worker daemon ("newt worker").  The worker compiles the translation
+// unit with its own copy of the toolchain and sends back the object file and
+// a dependency rule.
+//
+// The client and worker communicate using Go's net/rpc package over TCP.
+// Each connection begins with a handshake in which the client presents a
+// shared token; the worker only runs compilers from its own allow-list, with
+// options from a fixed allow-list (see sanitizeCmd()).
+//
+// Nothing is encrypted: the token is sent in plain text, so anyone who can
+// observe the connection can reuse it.  Workers must only be reachable from a
+// trusted network, or the connections must be wrapped in a secure tunnel
+// (e.g., SSH port forwarding or a TLS proxy).
+package remote
+
+const DEFAULT_ADDR = "localhost:7878"
+
+const rpcCompile = "Worker.Compile"
+
+// Source language of a preprocessed translation unit.
+const (
+	LANG_C   = "c"
+	LANG_CPP = "c++"
+)
+
+type CompileArgs struct {
+	// The compile command, without the trailing "-c -o <obj> <src>" tokens.
+	Cmd []string
+
+	// One of the LANG_[...] constants.
+	Lang string
+
+	// The preprocessed translation unit.
+	Source []byte
+
+	// Target of the generated dependency rule (e.g., "foo.o").
+	ObjName string
+}
+
+type CompileReply struct {
+	// Contents of the generated object file.  Empty if compilation failed.
+	Object []byte
+
+	// Makefile dependency rule for the object file.
+	Deps []byte
+
+	// Compiler output (warnings and errors).
+	Output []byte
+
+	// The compiler's exit status.
+	ExitCode int
+}
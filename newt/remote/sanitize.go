@@ -0,0 +1,227 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package remote
+
+import (
+	"strings"
+
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// Preprocessor options.  The worker compiles already-preprocessed input, so
+// these have no effect and are dropped.  Several of them name files to read
+// or write.  The value is true if the option takes a separate argument when
+// written without one attached (e.g., "-I dir" vs. "-Idir").
+var ppOpts = map[string]bool{
+	"-I":           true,
+	"-D":           true,
+	"-U":           true,
+	"-include":     true,
+	"-imacros":     true,
+	"-isystem":     true,
+	"-iquote":      true,
+	"-idirafter":   true,
+	"-iprefix":     true,
+	"-iwithprefix": true,
+	"-isysroot":    true,
+	"-MF":          true,
+	"-MT":          true,
+	"-MQ":          true,
+	"-MD":          false,
+	"-MMD":         false,
+	"-MP":          false,
+	"-MG":          false,
+	"-M":           false,
+	"-MM":          false,
+	"--sysroot":    true,
+}
+
+// Families of compiler options that are accepted: code generation and
+// feature flags, machine options, warnings, optimization, debug info, and the
+// language standard.  All other options are rejected.
+var allowedOptPrefixes = []string{
+	"-f",
+	"-m",
+	"-W",
+	"-O",
+	"-g",
+	"-std=",
+}
+
+// Individual options that are accepted.
+var allowedOpts = map[string]struct{}{
+	"-ansi":            struct{}{},
+	"-pedantic":        struct{}{},
+	"-pedantic-errors": struct{}{},
+	"-w":               struct{}{},
+}
+
+// Options within the allowed families that are rejected anyway, because they
+// load code into the compiler.
+var deniedOpts = map[string]struct{}{
+	"-fplugin":     struct{}{},
+	"-fplugin-arg": struct{}{},
+}
+
+// Options whose values are path mappings rather than files to access (e.g.,
+// "-ffile-prefix-map=/home/me/proj=."); their values are not restricted.
+var prefixMapOpts = map[string]struct{}{
+	"-ffile-prefix-map":    struct{}{},
+	"-fdebug-prefix-map":   struct{}{},
+	"-fmacro-prefix-map":   struct{}{},
+	"-fprofile-prefix-map": struct{}{},
+}
+
+// isPlainOptVal indicates whether an option value is a plain word (e.g.,
+// "cortex-m4" or "address,undefined").  A plain value cannot name a file
+// outside the worker's scratch directory.
+func isPlainOptVal(val string) bool {
+	if strings.HasPrefix(val, ".") {
+		return false
+	}
+
+	for _, c := range val {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("_-+.,", c):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// optAllowed indicates whether a compiler option is on the worker's
+// allow-list.
+func optAllowed(arg string) bool {
+	if _, ok := allowedOpts[arg]; ok {
+		return true
+	}
+
+	family := false
+	for _, prefix := range allowedOptPrefixes {
+		if strings.HasPrefix(arg, prefix) {
+			family = true
+			break
+		}
+	}
+	if !family {
+		return false
+	}
+
+	// -Wa, -Wl, and -Wp pass options to other programs.
+	if strings.HasPrefix(arg, "-W") && strings.Contains(arg, ",") {
+		return false
+	}
+
+	name := arg
+	val := ""
+	if i := strings.Index(arg, "="); i >= 0 {
+		name = arg[:i]
+		val = arg[i+1:]
+	}
+
+	if _, ok := deniedOpts[name]; ok {
+		return false
+	}
+	if _, ok := prefixMapOpts[name]; ok {
+		return true
+	}
+
+	return isPlainOptVal(val)
+}
+
+// sanitizeCmd validates a compile command received from a client and strips
+// options that are irrelevant to preprocessed input.  The compiler must be
+// one of the worker's allowed compilers, and every remaining option must be
+// on the allow-list.  Option values that could name files are restricted to
+// plain words, so the compiler can only access its scratch directory.
+func sanitizeCmd(cmd []string, compilers []string) ([]string, error) {
+	allowed := false
+	for _, c := range compilers {
+		if cmd[0] == c {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, util.FmtNewtError(
+			"compiler \"%s\" is not allowed by this worker", cmd[0])
+	}
+
+	out := []string{cmd[0]}
+	for i := 1; i < len(cmd); i++ {
+		arg := cmd[i]
+
+		if strings.HasPrefix(arg, "@") {
+			return nil, util.FmtNewtError(
+				"response files are not allowed: %s", arg)
+		}
+		if !strings.HasPrefix(arg, "-") {
+			return nil, util.FmtNewtError(
+				"input files are not allowed: %s", arg)
+		}
+
+		// "--param <name>=<value>" tunes the optimizer.
+		if arg == "--param" {
+			if i+1 >= len(cmd) {
+				return nil, util.FmtNewtError(
+					"option %s is missing its argument", arg)
+			}
+			param := strings.SplitN(cmd[i+1], "=", 2)
+			if len(param) != 2 || !isPlainOptVal(param[0]) ||
+				!isPlainOptVal(param[1]) {
+
+				return nil, util.FmtNewtError(
+					"option is not allowed: %s %s", arg, cmd[i+1])
+			}
+			out = append(out, arg, cmd[i+1])
+			i++
+			continue
+		}
+
+		dropped := false
+		for opt, sepArg := range ppOpts {
+			if arg == opt {
+				if sepArg {
+					i++
+				}
+				dropped = true
+				break
+			}
+			if sepArg && strings.HasPrefix(arg, opt) {
+				dropped = true
+				break
+			}
+		}
+		if dropped {
+			continue
+		}
+
+		if !optAllowed(arg) {
+			return nil, util.FmtNewtError("option is not allowed: %s", arg)
+		}
+
+		out = append(out, arg)
+	}
+
+	return out, nil
+}
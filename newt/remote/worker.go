@@ -0,0 +1,225 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// Worker is the RPC service that compiles translation units on behalf of
+// remote newt clients.
+type Worker struct {
+	// Limits the number of concurrent compilations.
+	sem chan struct{}
+
+	// The compiler executables that clients may run.
+	compilers []string
+}
+
+func NewWorker(numJobs int, compilers []string) *Worker {
+	if numJobs < 1 {
+		numJobs = 1
+	}
+
+	return &Worker{
+		sem:       make(chan struct{}, numJobs),
+		compilers: compilers,
+	}
+}
+
+// Compile compiles a single preprocessed translation unit.  A compiler
+// failure is reported in the reply's exit code and output; an error is only
+// returned if the worker could not run the compiler at all.
+func (w *Worker) Compile(args CompileArgs, reply *CompileReply) error {
+	if len(args.Cmd) == 0 {
+		return util.NewNewtError("empty compile command")
+	}
+
+	baseCmd, err := sanitizeCmd(args.Cmd, w.compilers)
+	if err != nil {
+		return err
+	}
+
+	w.sem <- struct{}{}
+	defer func() { <-w.sem }()
+
+	dir, err := ioutil.TempDir("", "newt-worker")
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The file extension tells the compiler that its input is already
+	// preprocessed.
+	srcName := "tu.i"
+	if args.Lang == LANG_CPP {
+		srcName = "tu.ii"
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, srcName), args.Source,
+		0644); err != nil {
+
+		return util.ChildNewtError(err)
+	}
+
+	cmdStrs := append(baseCmd,
+		"-c", "-o", "tu.o", srcName)
+	log.Debugf("Compiling for remote client: %s", strings.Join(cmdStrs, " "))
+
+	cmd := exec.Command(cmdStrs[0], cmdStrs[1:]...)
+	cmd.Dir = dir
+
+	o, err := cmd.CombinedOutput()
+	reply.Output = o
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			reply.ExitCode = ee.ExitCode()
+			return nil
+		}
+		return util.FmtNewtError("failed to run compiler \"%s\": %s",
+			cmdStrs[0], err.Error())
+	}
+
+	reply.Object, err = ioutil.ReadFile(filepath.Join(dir, "tu.o"))
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	reply.Deps = depsFromLinemarkers(args.Source, args.ObjName)
+
+	return nil
+}
+
+// depsFromLinemarkers generates a Makefile dependency rule from the
+// linemarkers in a preprocessed translation unit.  As with the compiler's
+// "-MM" option, system headers are omitted.
+func depsFromLinemarkers(source []byte, objName string) []byte {
+	files := []string{}
+	seen := map[string]struct{}{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(source))
+	scanner.Buffer(nil, len(source)+1)
+	for scanner.Scan() {
+		// Linemarker format: # <line> "<file>" [flags...]
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "# ") {
+			continue
+		}
+
+		fields := strings.SplitN(line[2:], " ", 2)
+		if len(fields) < 2 || !strings.HasPrefix(fields[1], "\"") {
+			continue
+		}
+
+		end := strings.LastIndex(fields[1], "\"")
+		name, err := strconv.Unquote(fields[1][:end+1])
+		if err != nil || strings.HasPrefix(name, "<") {
+			continue
+		}
+
+		// Flag 3 indicates a system header.
+		isSystem := false
+		for _, flag := range strings.Fields(fields[1][end+1:]) {
+			if flag == "3" {
+				isSystem = true
+			}
+		}
+		if isSystem {
+			continue
+		}
+
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			files = append(files, strings.Replace(name, " ", "\\ ", -1))
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(objName + ":")
+	for _, f := range files {
+		buf.WriteString(" \\\n " + f)
+	}
+	buf.WriteString("\n")
+
+	return buf.Bytes()
+}
+
+// Serve runs a worker daemon that listens for compile requests on the
+// specified address.  Clients must authenticate with the specified token, and
+// may only run the specified compilers.  It only returns if the listener
+// fails.
+func Serve(addr string, numJobs int, compilers []string, token string) error {
+	if token == "" {
+		return util.FmtNewtError(
+			"no remote token configured; set %s or \"remote.token\" in "+
+				"newtrc.yml", TOKEN_ENV_VAR)
+	}
+	if len(compilers) == 0 {
+		return util.NewNewtError(
+			"no compilers allowed; specify --compiler or set " +
+				"\"remote.compilers\" in newtrc.yml")
+	}
+
+	srv := rpc.NewServer()
+	if err := srv.Register(NewWorker(numJobs, compilers)); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return util.FmtNewtError("failed to listen on %s: %s", addr,
+			err.Error())
+	}
+	defer l.Close()
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Listening for compile requests on %s\n", l.Addr().String())
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return util.ChildNewtError(err)
+		}
+
+		log.Debugf("Accepted connection from %s", conn.RemoteAddr().String())
+		go func(conn net.Conn) {
+			rwc, err := acceptHandshake(conn, token)
+			if err != nil {
+				log.Warnf("Rejected connection from %s: %s",
+					conn.RemoteAddr().String(), err.Error())
+				conn.Close()
+				return
+			}
+			srv.ServeConn(rwc)
+		}(conn)
+	}
+}
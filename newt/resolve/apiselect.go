@@ -0,0 +1,349 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package resolve
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/dachalco/mynewt-newt/newt/pkg"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// When more than one package in the build supplies the same API, the
+// supplier is chosen by the first of these rules that applies:
+//
+// 1. The target selects a supplier (`pkg.api_select` in the target's
+//    pkg.yml).
+// 2. The app selects a supplier (`pkg.api_select` in the app's pkg.yml).
+// 3. Exactly one supplier marks itself as the API's default
+//    (`pkg.api_default`).
+// 4. Exactly one supplier does not mark itself as the API's fallback
+//    (`pkg.api_fallback`).
+//
+// If no rule applies, an API conflict is reported.
+
+// An explicit choice of API supplier.
+type apiSelection struct {
+	// Name of the selected package.
+	pkgName string
+
+	// The package that made the selection (target or app).
+	selector *ResolvePackage
+}
+
+// Indicates whether a package's name matches the one specified in an API
+// selection.  Packages in the local repo can be specified without a repo
+// prefix.
+func selectionMatches(lpkg *pkg.LocalPackage, name string) bool {
+	return name == lpkg.FullName() || name == lpkg.Name() ||
+		name == "@"+lpkg.Repo().Name()+"/"+lpkg.Name()
+}
+
+// Reads the explicit API selections of the target and app packages, in
+// priority order.  The result is a map of API name to selection list.
+func (r *Resolver) readApiSelections() map[string][]apiSelection {
+	var targets []*ResolvePackage
+	var apps []*ResolvePackage
+	for _, rpkg := range r.sortedRpkgs() {
+		switch rpkg.Lpkg.Type() {
+		case pkg.PACKAGE_TYPE_TARGET:
+			targets = append(targets, rpkg)
+		case pkg.PACKAGE_TYPE_APP, pkg.PACKAGE_TYPE_UNITTEST:
+			apps = append(apps, rpkg)
+		}
+	}
+
+	m := map[string][]apiSelection{}
+	for _, rpkg := range append(targets, apps...) {
+		settings := r.cfg.AllSettingsForLpkg(rpkg.Lpkg)
+
+		sels, err := rpkg.Lpkg.PkgY.GetValStringMapString(
+			"pkg.api_select", settings)
+		if err != nil {
+			r.parseWarnings[rpkg] = append(r.parseWarnings[rpkg],
+				err.Error())
+		}
+
+		for api, name := range sels {
+			m[api] = append(m[api], apiSelection{
+				pkgName:  name,
+				selector: rpkg,
+			})
+		}
+	}
+
+	return m
+}
+
+// Reads the set of APIs that a package marks with the specified key (e.g.,
+// "pkg.api_default").
+func (r *Resolver) readApiMarkers(
+	rpkg *ResolvePackage, key string) map[string]struct{} {
+
+	settings := r.cfg.AllSettingsForLpkg(rpkg.Lpkg)
+
+	em, warn, err := readExprMap(rpkg.Lpkg.PkgY, key, settings)
+	if err != nil {
+		util.OneTimeWarningError(err)
+	}
+	if warn != "" {
+		r.parseWarnings[rpkg] = append(r.parseWarnings[rpkg], warn)
+	}
+
+	m := make(map[string]struct{}, len(em))
+	for api, _ := range em {
+		m[api] = struct{}{}
+	}
+
+	return m
+}
+
+// Narrows a set of suppliers to those that mark the API with the specified
+// key (or, if `want` is false, to those that don't).
+func (r *Resolver) filterApiMarked(name string, apis []resolveApi,
+	key string, want bool) []resolveApi {
+
+	var filtered []resolveApi
+	for _, api := range apis {
+		_, marked := r.readApiMarkers(api.rpkg, key)[name]
+		if marked == want {
+			filtered = append(filtered, api)
+		}
+	}
+
+	return filtered
+}
+
+// Chooses the supplier of an API from the packages that supply it.  It
+// returns the chosen supplier and a description of the rule that chose it.
+// If no rule can choose a single supplier, the returned slice contains the
+// conflicting suppliers.
+func (r *Resolver) chooseApiSupplier(name string, apis []resolveApi,
+	sels []apiSelection) (resolveApi, string, []resolveApi) {
+
+	for _, sel := range sels {
+		for _, api := range apis {
+			if selectionMatches(api.rpkg.Lpkg, sel.pkgName) {
+				return api, fmt.Sprintf("selected by %s %s",
+					pkg.PackageTypeNames[sel.selector.Lpkg.Type()],
+					sel.selector.Lpkg.FullName()), nil
+			}
+		}
+
+		r.apiSelectErrors = append(r.apiSelectErrors, fmt.Sprintf(
+			"%s selects %s to supply API %s, but %s is not in the build "+
+				"or does not supply %s",
+			sel.selector.Lpkg.FullName(), sel.pkgName, name, sel.pkgName,
+			name))
+	}
+
+	if len(apis) == 1 {
+		return apis[0], "only supplier", nil
+	}
+
+	dflts := r.filterApiMarked(name, apis, "pkg.api_default", true)
+	if len(dflts) == 1 {
+		return dflts[0], "default supplier", nil
+	}
+	if len(dflts) > 1 {
+		return dflts[0], "", dflts
+	}
+
+	nonFallbacks := r.filterApiMarked(name, apis, "pkg.api_fallback", false)
+	if len(nonFallbacks) == 1 {
+		return nonFallbacks[0], "only non-fallback supplier", nil
+	}
+	if len(nonFallbacks) > 1 {
+		return nonFallbacks[0], "", nonFallbacks
+	}
+
+	return apis[0], "", apis
+}
+
+// Indicates why an API supplier that was not chosen cannot be removed from
+// the build.  It returns "" if the package can be removed.
+func (r *Resolver) apiLoserKeepReason(rpkg *ResolvePackage) string {
+	for _, lpkg := range r.seedPkgs {
+		if lpkg == rpkg.Lpkg {
+			return "it is a seed package"
+		}
+	}
+
+	if _, ok := r.apiReadmitted[rpkg.Lpkg]; ok {
+		return "it was readmitted after the chosen supplier left the build"
+	}
+
+	if rpkg.Lpkg.Type() != pkg.PACKAGE_TYPE_LIB {
+		return fmt.Sprintf("it is a %s package",
+			pkg.PackageTypeNames[rpkg.Lpkg.Type()])
+	}
+
+	for _, name := range r.sortedApiNames() {
+		if r.apis[name].rpkg == rpkg {
+			return fmt.Sprintf("it supplies API %s", name)
+		}
+	}
+
+	for name, _ := range rpkg.Apis {
+		if _, ok := r.apiConflicts[name][rpkg]; ok {
+			return fmt.Sprintf("it is in conflict over API %s", name)
+		}
+	}
+
+	return ""
+}
+
+func (r *Resolver) sortedApiNames() []string {
+	names := r.apiSlice()
+	sort.Strings(names)
+	return names
+}
+
+// sortedApiPruned returns the pruned API suppliers, sorted by name.
+func (r *Resolver) sortedApiPruned() []*ResolvePackage {
+	rpkgs := make([]*ResolvePackage, 0, len(r.apiPruned))
+	for _, rpkg := range r.apiPruned {
+		rpkgs = append(rpkgs, rpkg)
+	}
+
+	SortResolvePkgs(rpkgs)
+	return rpkgs
+}
+
+// Finds an API that the specified supplier was not chosen to supply.
+func (r *Resolver) lostApi(rpkg *ResolvePackage) (string, bool) {
+	for _, name := range r.sortedApiNames() {
+		for _, loser := range r.apiLosers[name] {
+			if loser == rpkg {
+				return name, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// Selects the API suppliers and rebuilds the set of pruned suppliers from the
+// result.  Packages that supply only APIs for which a different supplier was
+// chosen are removed, along with their dependency edges; dependencies on them
+// are ignored from then on.  A pruned package that is no longer a losing
+// supplier (e.g., because the chosen supplier left the build) is readmitted.
+// It returns true if the set of packages changed.
+func (r *Resolver) pruneApiLosers() (bool, error) {
+	r.trace.begin(TRACE_STEP_API_LOSERS)
+
+	r.selectApiSuppliers()
+
+	changed := false
+
+	for lpkg, rpkg := range r.apiPruned {
+		if _, ok := r.lostApi(rpkg); !ok {
+			delete(r.apiPruned, lpkg)
+			r.apiReadmitted[lpkg] = struct{}{}
+			changed = true
+		}
+	}
+	if changed {
+		// Dependencies on the readmitted packages need to be reprocessed.
+		for _, rpkg := range r.pkgMap {
+			rpkg.depsResolved = false
+		}
+	}
+
+	for _, name := range r.sortedApiNames() {
+		for _, rpkg := range r.apiLosers[name] {
+			if _, ok := r.pkgMap[rpkg.Lpkg]; !ok {
+				// Already removed.
+				continue
+			}
+			if r.apiLoserKeepReason(rpkg) != "" {
+				continue
+			}
+
+			r.trace.removal(TRACE_EVENT_API_LOSER, rpkg, nil, fmt.Sprintf(
+				"%s supplies API %s (%s)",
+				r.apis[name].rpkg.Lpkg.FullName(), name, r.apiRules[name]))
+
+			// Remember the dependencies that are dropped along with the
+			// package.
+			for depender, _ := range rpkg.revDeps {
+				if r.apiPrunedDeps[depender] == nil {
+					r.apiPrunedDeps[depender] =
+						map[*pkg.LocalPackage]struct{}{}
+				}
+				r.apiPrunedDeps[depender][rpkg.Lpkg] = struct{}{}
+			}
+
+			r.apiPruned[rpkg.Lpkg] = rpkg
+			if err := r.deletePkg(rpkg); err != nil {
+				return false, err
+			}
+			changed = true
+		}
+	}
+
+	return changed, nil
+}
+
+// Describes the API suppliers that were not chosen but remain in the build,
+// and the dependencies on pruned suppliers that were ignored.
+func (r *Resolver) apiLoserWarnings() []string {
+	var warnings []string
+
+	for _, name := range r.sortedApiNames() {
+		for _, rpkg := range r.apiLosers[name] {
+			if _, ok := r.pkgMap[rpkg.Lpkg]; !ok {
+				continue
+			}
+
+			warnings = append(warnings, fmt.Sprintf(
+				"%s supplies API %s, but %s was chosen (%s); %s remains in "+
+					"the build because %s",
+				rpkg.Lpkg.FullName(), name, r.apis[name].rpkg.Lpkg.FullName(),
+				r.apiRules[name], rpkg.Lpkg.FullName(),
+				r.apiLoserKeepReason(rpkg)))
+		}
+	}
+
+	for _, depender := range r.sortedRpkgs() {
+		var names []string
+		for lpkg, _ := range r.apiPrunedDeps[depender] {
+			rpkg := r.apiPruned[lpkg]
+			if rpkg == nil {
+				continue
+			}
+			name, ok := r.lostApi(rpkg)
+			if !ok {
+				continue
+			}
+
+			names = append(names, fmt.Sprintf(
+				"%s depends on %s, but the dependency is ignored because %s "+
+					"was chosen to supply API %s (%s)",
+				depender.Lpkg.FullName(), lpkg.FullName(),
+				r.apis[name].rpkg.Lpkg.FullName(), name, r.apiRules[name]))
+		}
+		sort.Strings(names)
+		warnings = append(warnings, names...)
+	}
+
+	return warnings
+}
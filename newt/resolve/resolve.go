@@ -32,6 +32,7 @@ import (
 	"github.com/dachalco/mynewt-newt/newt/newtutil"
 	"github.com/dachalco/mynewt-newt/newt/parse"
 	"github.com/dachalco/mynewt-newt/newt/pkg"
+	"github.com/dachalco/mynewt-newt/newt/profile"
 	"github.com/dachalco/mynewt-newt/newt/project"
 	"github.com/dachalco/mynewt-newt/newt/syscfg"
 	"github.com/dachalco/mynewt-newt/newt/sysdown"
@@ -75,7 +76,34 @@ type Resolver struct {
 	// [api-name][api-supplier]
 	apiConflicts map[string]map[*ResolvePackage]struct{}
 
+	// [api-name] => description of the rule that chose the API's supplier.
+	apiRules map[string]string
+
+	// Target and app API selections that could not be honored.
+	apiSelectErrors []string
+
+	// [api-name] => suppliers that were not chosen to supply the API.
+	apiLosers map[string][]*ResolvePackage
+
+	// Packages deleted because a different package was chosen to supply
+	// their APIs.  Dependencies on these packages are ignored.  The set is
+	// rebuilt each time the suppliers are selected.
+	apiPruned map[*pkg.LocalPackage]*ResolvePackage
+
+	// Pruned packages that were readmitted because the chosen supplier left
+	// the build.  These are not pruned again; otherwise a supplier whose
+	// removal removes the chosen supplier would be pruned and readmitted
+	// forever.
+	apiReadmitted map[*pkg.LocalPackage]struct{}
+
+	// [depender][pruned-package] => the depender's `pkg.deps` lists a
+	// pruned package.
+	apiPrunedDeps map[*ResolvePackage]map[*pkg.LocalPackage]struct{}
+
 	parseWarnings map[*ResolvePackage][]string
+
+	// Records each resolution step; nil if tracing is disabled.
+	trace *Trace
 }
 
 type ResolveDep struct {
@@ -88,6 +116,9 @@ type ResolveDep struct {
 	// Represents the set of API requirements that this dependency satisfies.
 	// The map key is the API name.
 	ApiExprMap parse.ExprMap
+
+	// Constraints on the depended-on package's version.
+	VersionReqs []pkg.VersionReq
 }
 
 type ResolvePackage struct {
@@ -133,6 +164,19 @@ type Resolution struct {
 	ApiConflicts    []ApiConflict
 	ParseWarnings   []string
 
+	// [api-name] => description of the rule that chose the API's supplier.
+	ApiRules map[string]string
+
+	// Target and app API selections that could not be honored.
+	ApiSelectErrors []string
+
+	// Suppliers that were not chosen to supply an API but could not be
+	// removed from the build.
+	ApiLoserWarnings []string
+
+	// Dependency version constraints that are not met.
+	VersionErrors []string
+
 	LpkgRpkgMap map[*pkg.LocalPackage]*ResolvePackage
 
 	// Contains all dependencies; union of loader and app.
@@ -155,6 +199,11 @@ func newResolver(
 		flashMap:         flashMap,
 		cfg:              syscfg.NewCfg(),
 		apiConflicts:     map[string]map[*ResolvePackage]struct{}{},
+		apiRules:         map[string]string{},
+		apiLosers:        map[string][]*ResolvePackage{},
+		apiPruned:        map[*pkg.LocalPackage]*ResolvePackage{},
+		apiPrunedDeps:    map[*ResolvePackage]map[*pkg.LocalPackage]struct{}{},
+		apiReadmitted:    map[*pkg.LocalPackage]struct{}{},
 		parseWarnings:    map[*ResolvePackage][]string{},
 	}
 
@@ -173,6 +222,7 @@ func newResolution() *Resolution {
 	r := &Resolution{
 		ApiMap:          map[string]*ResolvePackage{},
 		UnsatisfiedApis: map[string][]*ResolvePackage{},
+		ApiRules:        map[string]string{},
 	}
 
 	r.MasterSet = &ResolveSet{Res: r}
@@ -348,13 +398,24 @@ func (r *Resolver) fillApisFor(rpkg *ResolvePackage) error {
 
 // Selects the final API suppliers among all packages implementing APIs.  The
 // result gets written to the resolver's `apis` map.  If more than one package
-// implements the same API, an API conflict error is recorded.
+// implements the same API and no selection rule picks one of them, an API
+// conflict error is recorded.
 func (r *Resolver) selectApiSuppliers() {
 	apiMap := map[string][]resolveApi{}
 
-	// Fill each package's list of supplied APIs.
+	// Discard the results of any previous selection.
+	r.apis = map[string]resolveApi{}
+	r.apiConflicts = map[string]map[*ResolvePackage]struct{}{}
+	r.apiRules = map[string]string{}
+	r.apiLosers = map[string][]*ResolvePackage{}
+
+	// Fill each package's list of supplied APIs.  Pruned suppliers remain
+	// candidates (with the APIs they supplied when they were pruned) so that
+	// they can be readmitted if the chosen supplier leaves the build.
 	for _, rpkg := range r.sortedRpkgs() {
 		r.fillApisFor(rpkg)
+	}
+	for _, rpkg := range append(r.sortedRpkgs(), r.sortedApiPruned()...) {
 		for apiName, exprSet := range rpkg.Apis {
 			apiMap[apiName] = append(apiMap[apiName], resolveApi{
 				rpkg: rpkg,
@@ -363,6 +424,9 @@ func (r *Resolver) selectApiSuppliers() {
 		}
 	}
 
+	sels := r.readApiSelections()
+	r.apiSelectErrors = nil
+
 	// Detect API conflicts and determine which packages supply which APIs.
 	apiNames := make([]string, 0, len(apiMap))
 	for name, _ := range apiMap {
@@ -371,19 +435,26 @@ func (r *Resolver) selectApiSuppliers() {
 	sort.Strings(apiNames)
 
 	for _, name := range apiNames {
-		apis := apiMap[name]
-		for _, api := range apis {
-			old := r.apis[name]
-			if old.rpkg != nil {
-				if r.apiConflicts[name] == nil {
-					r.apiConflicts[name] = map[*ResolvePackage]struct{}{}
+		api, rule, conflicts := r.chooseApiSupplier(
+			name, apiMap[name], sels[name])
+		if len(conflicts) > 0 {
+			if r.apiConflicts[name] == nil {
+				r.apiConflicts[name] = map[*ResolvePackage]struct{}{}
+			}
+			for _, c := range conflicts {
+				r.apiConflicts[name][c.rpkg] = struct{}{}
+			}
+			rule = "conflict"
+		} else {
+			for _, a := range apiMap[name] {
+				if a.rpkg != api.rpkg {
+					r.apiLosers[name] = append(r.apiLosers[name], a.rpkg)
 				}
-				r.apiConflicts[name][api.rpkg] = struct{}{}
-				r.apiConflicts[name][old.rpkg] = struct{}{}
-			} else {
-				r.apis[name] = api
 			}
 		}
+
+		r.apis[name] = api
+		r.apiRules[name] = rule
 	}
 }
 
@@ -455,6 +526,9 @@ func (r *Resolver) deletePkg(rpkg *ResolvePackage) error {
 		}
 		delete(dep.revDeps, rpkg)
 		if len(dep.revDeps) == 0 {
+			r.trace.removal(TRACE_EVENT_DELETE, dep, rpkg, fmt.Sprintf(
+				"no remaining dependers after %s was deleted",
+				rpkg.Lpkg.FullName()))
 			if err := r.deletePkg(dep); err != nil {
 				return err
 			}
@@ -473,6 +547,7 @@ func (r *Resolver) loadDepsForPkg(rpkg *ResolvePackage) (bool, error) {
 	if _, ok := r.parseWarnings[rpkg]; ok {
 		delete(r.parseWarnings, rpkg)
 	}
+	delete(r.apiPrunedDeps, rpkg)
 
 	settings := r.cfg.AllSettingsForLpkg(rpkg.Lpkg)
 
@@ -500,7 +575,7 @@ func (r *Resolver) loadDepsForPkg(rpkg *ResolvePackage) (bool, error) {
 	oldDeps := rpkg.Deps
 	rpkg.Deps = make(map[*ResolvePackage]*ResolveDep, len(oldDeps))
 	for expr, depNames := range depEm {
-		for _, depName := range depNames {
+		for _, depName := range pkg.RejoinDepStrings(depNames) {
 			newDep, err := pkg.NewDependency(rpkg.Lpkg.Repo(), depName)
 			if err != nil {
 				return false, err
@@ -511,8 +586,35 @@ func (r *Resolver) loadDepsForPkg(rpkg *ResolvePackage) (bool, error) {
 				return false, err
 			}
 
-			depRpkg, _ := r.addPkg(lpkg)
+			// A different package was chosen to supply this package's
+			// APIs.
+			if _, ok := r.apiPruned[lpkg]; ok {
+				if r.apiPrunedDeps[rpkg] == nil {
+					r.apiPrunedDeps[rpkg] = map[*pkg.LocalPackage]struct{}{}
+				}
+				r.apiPrunedDeps[rpkg][lpkg] = struct{}{}
+				continue
+			}
+
+			// A transient package's link is an alias, not a dependency.
+			if rpkg.Lpkg.Type() != pkg.PACKAGE_TYPE_TRANSIENT {
+				if err := checkVisibility(rpkg.Lpkg, lpkg, expr,
+					depName); err != nil {
+
+					return false, err
+				}
+			}
+
+			depRpkg, isNew := r.addPkg(lpkg)
+			if isNew {
+				r.trace.dep(TRACE_EVENT_ADD, depRpkg, rpkg, expr)
+			} else if _, ok := oldDeps[depRpkg]; !ok {
+				if _, ok := rpkg.Deps[depRpkg]; !ok {
+					r.trace.dep(TRACE_EVENT_DEP, depRpkg, rpkg, expr)
+				}
+			}
 			rpkg.AddDep(depRpkg, expr)
+			rpkg.Deps[depRpkg].addVersionReqs(newDep.VersionReqs)
 		}
 	}
 
@@ -524,10 +626,13 @@ func (r *Resolver) loadDepsForPkg(rpkg *ResolvePackage) (bool, error) {
 		if _, ok := rpkg.Deps[rdep]; !ok {
 			delete(rdep.revDeps, rpkg)
 			changed = true
+			r.trace.removal(TRACE_EVENT_UNDEP, rdep, rpkg, "")
 
 			// If we just deleted the last reference to a package, remove the
 			// package entirely from the resolver and syscfg.
 			if len(rdep.revDeps) == 0 {
+				r.trace.removal(TRACE_EVENT_DELETE, rdep, rpkg,
+					"no remaining dependers")
 				if err := r.deletePkg(rdep); err != nil {
 					return true, err
 				}
@@ -571,6 +676,8 @@ func (r *Resolver) resolvePkg(rpkg *ResolvePackage) (bool, error) {
 
 // @return                      changed,err
 func (r *Resolver) reloadCfg() (bool, error) {
+	r.trace.begin(TRACE_STEP_RELOAD)
+
 	lpkgs := RpkgSliceToLpkgSlice(r.rpkgSlice())
 	apis := r.apiSlice()
 
@@ -585,12 +692,17 @@ func (r *Resolver) reloadCfg() (bool, error) {
 	}
 
 	cfg.ResolveValueRefs()
+	cfg.ResolveDerived()
+
+	r.trace.reload(r.cfg, cfg)
 
 	// Determine if any new settings have been added or if any existing
 	// settings have changed.
 	for k, v := range cfg.Settings {
 		oldval, ok := r.cfg.Settings[k]
-		if !ok || len(oldval.History) != len(v.History) {
+		if !ok || len(oldval.History) != len(v.History) ||
+			oldval.Value != v.Value {
+
 			r.cfg = cfg
 			return true, nil
 		}
@@ -604,6 +716,8 @@ func (r *Resolver) reloadCfg() (bool, error) {
 		}
 	}
 
+	r.trace.add(TraceEvent{Type: TRACE_EVENT_CFG_STABLE})
+
 	return false, nil
 }
 
@@ -818,6 +932,8 @@ func (r *Resolver) pruneImposters() (bool, error) {
 			// prior delete.  If it has no more reverse dependencies, it is
 			// already invalid.
 			if len(rpkg.revDeps) > 0 {
+				r.trace.removal(TRACE_EVENT_IMPOSTER, rpkg, nil,
+					imposterReason(rpkg))
 				if err := r.deletePkg(rpkg); err != nil {
 					return false, err
 				}
@@ -866,6 +982,8 @@ func (r *Resolver) pruneOrphans() (bool, error) {
 	for _, rpkg := range r.pkgMap {
 		if _, ok := seenMap[rpkg]; !ok {
 			anyPruned = true
+			r.trace.removal(TRACE_EVENT_ORPHAN, rpkg, nil,
+				"not reachable from any seed package")
 			if err := r.deletePkg(rpkg); err != nil {
 				return false, err
 			}
@@ -878,6 +996,8 @@ func (r *Resolver) pruneOrphans() (bool, error) {
 func (r *Resolver) resolveHardDepsOnce() (bool, error) {
 	// Circularly resolve dependencies, APIs, and required APIs until no new
 	// ones exist.
+	r.trace.begin(TRACE_STEP_DEPS)
+
 	reprocess := false
 	for _, rpkg := range r.pkgMap {
 		newDeps, err := r.resolvePkg(rpkg)
@@ -897,6 +1017,7 @@ func (r *Resolver) resolveHardDepsOnce() (bool, error) {
 	}
 
 	// Prune orphan packages.
+	r.trace.begin(TRACE_STEP_ORPHANS)
 	anyPruned, err := r.pruneOrphans()
 	if err != nil {
 		return false, err
@@ -906,6 +1027,7 @@ func (r *Resolver) resolveHardDepsOnce() (bool, error) {
 	}
 
 	// Prune imposter packages.
+	r.trace.begin(TRACE_STEP_IMPOSTERS)
 	anyPruned, err = r.pruneImposters()
 	if err != nil {
 		return false, err
@@ -966,12 +1088,20 @@ func (r *Resolver) resolveDeps() ([]*ResolvePackage, error) {
 // 2. Determines which packages satisfy which API requirements.
 // 3. Resolves package dependencies by populating the resolver's package map.
 func (r *Resolver) resolveDepsAndCfg() error {
-	if err := r.resolveHardDeps(); err != nil {
+	span := profile.Begin(profile.CAT_RESOLVE, "resolve hard deps",
+		profile.TID_MAIN)
+	err := r.resolveHardDeps()
+	span.End()
+	if err != nil {
 		return err
 	}
 
-	for {
+	for i := 1; ; i++ {
+		span := profile.Begin(profile.CAT_RESOLVE, "reload syscfg",
+			profile.TID_MAIN)
+		span.SetArg("iteration", i)
 		cfgChanged, err := r.reloadCfg()
+		span.End()
 		if err != nil {
 			return err
 		}
@@ -985,15 +1115,33 @@ func (r *Resolver) resolveDepsAndCfg() error {
 			}
 		}
 
-		if err := r.resolveHardDeps(); err != nil {
+		span = profile.Begin(profile.CAT_RESOLVE, "resolve hard deps",
+			profile.TID_MAIN)
+		span.SetArg("iteration", i)
+		err = r.resolveHardDeps()
+		span.End()
+		if err != nil {
 			return err
 		}
 
 		if !cfgChanged {
-			break
+			// Syscfg is stable.  Remove the API suppliers that were not
+			// chosen; their settings and dependencies no longer apply, so
+			// iterate again if any were removed.
+			pruned, err := r.pruneApiLosers()
+			if err != nil {
+				return err
+			}
+			if !pruned {
+				break
+			}
 		}
 	}
 
+	span = profile.Begin(profile.CAT_RESOLVE, "resolve apis",
+		profile.TID_MAIN)
+	defer span.End()
+
 	// Now that the final set of packages is known, determine which ones
 	// satisfy each required API.
 	r.selectApiSuppliers()
@@ -1107,7 +1255,8 @@ func ResolveFull(
 	loaderSeeds []*pkg.LocalPackage,
 	appSeeds []*pkg.LocalPackage,
 	injectedSettings map[string]string,
-	flashMap flashmap.FlashMap) (*Resolution, error) {
+	flashMap flashmap.FlashMap, ramSize int,
+	trace *Trace) (*Resolution, error) {
 
 	// First, calculate syscfg and determine which package provides each
 	// required API.  Syscfg and APIs are project-wide; that is, they are
@@ -1118,7 +1267,20 @@ func ResolveFull(
 	allSeeds := append(loaderSeeds, appSeeds...)
 	r := newResolver(allSeeds, injectedSettings, flashMap)
 
-	if err := r.resolveDepsAndCfg(); err != nil {
+	// Only the project-wide resolution is traced; this is where packages are
+	// added and pruned.
+	r.trace = trace
+	r.trace.begin(TRACE_STEP_SEED)
+	for _, lpkg := range allSeeds {
+		r.trace.add(TraceEvent{
+			Type: TRACE_EVENT_SEED,
+			Pkg:  lpkg.FullName(),
+		})
+	}
+
+	err := r.resolveDepsAndCfg()
+	r.trace.finish(r)
+	if err != nil {
 		return nil, err
 	}
 
@@ -1157,6 +1319,11 @@ func ResolveFull(
 		res.ApiConflicts = append(res.ApiConflicts, c)
 	}
 
+	res.ApiRules = r.apiRules
+	res.ApiSelectErrors = r.apiSelectErrors
+	res.ApiLoserWarnings = r.apiLoserWarnings()
+	res.VersionErrors = r.checkDepVersions()
+
 	res.LpkgRpkgMap = r.pkgMap
 
 	res.MasterSet.Rpkgs = r.rpkgSlice()
@@ -1168,6 +1335,9 @@ func ResolveFull(
 			util.OneTimeWarning("%s", line)
 		}
 	}
+	for _, warn := range res.ApiLoserWarnings {
+		util.OneTimeWarning("%s", warn)
+	}
 	for _, rpkg := range res.MasterSet.Rpkgs {
 		LogTransientWarning(rpkg.Lpkg)
 	}
@@ -1178,7 +1348,7 @@ func ResolveFull(
 	if loaderSeeds == nil {
 		res.AppSet.Rpkgs = r.rpkgSlice()
 		res.LoaderSet = nil
-		res.Cfg.DetectErrors(flashMap)
+		res.Cfg.DetectErrors(flashMap, ramSize)
 		return res, nil
 	}
 
@@ -1196,13 +1366,18 @@ func ResolveFull(
 		appSeeds = append(appSeeds, rpkg.Lpkg)
 	}
 
+	// The loader and app inherit the project-wide API supplier choices.
+	apiPruned := r.apiPruned
+
 	// Resolve loader dependencies.
 	r = newResolver(loaderSeeds, injectedSettings, flashMap)
 	r.cfg = res.Cfg
+	r.apiPruned = apiPruned
 
-	var err error
-
+	span := profile.Begin(profile.CAT_RESOLVE, "resolve loader deps",
+		profile.TID_MAIN)
 	res.LoaderSet.Rpkgs, err = r.resolveDeps()
+	span.End()
 	if err != nil {
 		return nil, err
 	}
@@ -1220,8 +1395,12 @@ func ResolveFull(
 
 	r = newResolver(appSeeds, injectedSettings, flashMap)
 	r.cfg = res.Cfg
+	r.apiPruned = apiPruned
 
+	span = profile.Begin(profile.CAT_RESOLVE, "resolve app deps",
+		profile.TID_MAIN)
 	res.AppSet.Rpkgs, err = r.resolveDeps()
+	span.End()
 	if err != nil {
 		return nil, err
 	}
@@ -1229,7 +1408,7 @@ func ResolveFull(
 		return nil, err
 	}
 
-	res.Cfg.DetectErrors(flashMap)
+	res.Cfg.DetectErrors(flashMap, ramSize)
 
 	return res, nil
 }
@@ -1260,6 +1439,20 @@ func (res *Resolution) ErrorText() string {
 		}
 	}
 
+	if len(res.ApiSelectErrors) > 0 {
+		str += "API selection errors:\n"
+		for _, e := range res.ApiSelectErrors {
+			str += "    * " + e + "\n"
+		}
+	}
+
+	if len(res.VersionErrors) > 0 {
+		str += "Package version conflicts detected:\n"
+		for _, e := range res.VersionErrors {
+			str += "    * " + e + "\n"
+		}
+	}
+
 	str += res.Cfg.ErrorText()
 	str += res.LCfg.ErrorText()
 	str += res.SysinitCfg.ErrorText()
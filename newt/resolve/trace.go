@@ -0,0 +1,528 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package resolve
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dachalco/mynewt-newt/newt/parse"
+	"github.com/dachalco/mynewt-newt/newt/syscfg"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+const (
+	TRACE_FORMAT_TEXT = "text"
+	TRACE_FORMAT_JSON = "json"
+	TRACE_FORMAT_DOT  = "dot"
+)
+
+var TraceFormats = []string{
+	TRACE_FORMAT_TEXT,
+	TRACE_FORMAT_JSON,
+	TRACE_FORMAT_DOT,
+}
+
+// Resolver steps.  Each trace iteration corresponds to one step.
+const (
+	TRACE_STEP_SEED       = "seed"
+	TRACE_STEP_DEPS       = "deps"
+	TRACE_STEP_RELOAD     = "reload"
+	TRACE_STEP_ORPHANS    = "orphans"
+	TRACE_STEP_IMPOSTERS  = "imposters"
+	TRACE_STEP_API_LOSERS = "api-losers"
+)
+
+// Trace event types.
+const (
+	// A seed package.
+	TRACE_EVENT_SEED = "seed"
+
+	// A package was added to the graph by a dependency.
+	TRACE_EVENT_ADD = "add"
+
+	// A dependency on a package that was already in the graph.
+	TRACE_EVENT_DEP = "dep"
+
+	// A dependency was dropped because its expression no longer applies.
+	TRACE_EVENT_UNDEP = "undep"
+
+	// Syscfg was loaded for the first time.
+	TRACE_EVENT_CFG_LOAD = "cfg-load"
+
+	// A setting was added, removed, or changed on a syscfg reload.
+	TRACE_EVENT_SETTING = "setting"
+
+	// A syscfg reload did not change any settings' definitions or
+	// overrides, so dependencies were not reprocessed.
+	TRACE_EVENT_CFG_STABLE = "cfg-stable"
+
+	// A package was deleted because nothing depends on it anymore.
+	TRACE_EVENT_DELETE = "delete"
+
+	// A package was pruned because it is unreachable from the seeds.
+	TRACE_EVENT_ORPHAN = "orphan"
+
+	// A package was pruned because it is only reachable via its own syscfg.
+	TRACE_EVENT_IMPOSTER = "imposter"
+
+	// A package was pruned because a different package was chosen to supply
+	// its APIs.
+	TRACE_EVENT_API_LOSER = "api-loser"
+)
+
+type TraceEvent struct {
+	Type string `json:"type"`
+
+	// The package that was added, removed, or depended on.
+	Pkg string `json:"pkg,omitempty"`
+
+	// The package that depends on (or depended on) `Pkg`.
+	Depender string `json:"depender,omitempty"`
+
+	// The syscfg expression that enabled the dependency; empty if
+	// unconditional.
+	Expr string `json:"expr,omitempty"`
+
+	// Settings referenced by `Expr` that were changed by an earlier syscfg
+	// reload.  Each entry has the form "<setting> (iteration <n>)".
+	Causes []string `json:"causes,omitempty"`
+
+	// Setting changes only.
+	Setting  string `json:"setting,omitempty"`
+	Change   string `json:"change,omitempty"`
+	OldValue string `json:"old_value,omitempty"`
+	NewValue string `json:"new_value,omitempty"`
+	Source   string `json:"source,omitempty"`
+
+	// Why a package or dependency was removed.
+	Reason string `json:"reason,omitempty"`
+}
+
+type TraceIteration struct {
+	Num    int          `json:"iteration"`
+	Step   string       `json:"step"`
+	Events []TraceEvent `json:"events"`
+}
+
+// Trace records the resolver's progress toward a fixed point: which packages
+// and dependencies each iteration added or removed, and why.
+type Trace struct {
+	Iterations []*TraceIteration `json:"iterations"`
+
+	// The fully resolved set of packages.
+	Pkgs []string `json:"packages"`
+
+	// [setting-name] => number of the iteration that last changed it.
+	changed map[string]int
+}
+
+func NewTrace() *Trace {
+	return &Trace{
+		changed: map[string]int{},
+	}
+}
+
+// All trace methods are no-ops on a nil trace.  This lets the resolver call
+// them unconditionally.
+
+func (t *Trace) begin(step string) {
+	if t == nil {
+		return
+	}
+
+	t.Iterations = append(t.Iterations, &TraceIteration{
+		Num:  len(t.Iterations),
+		Step: step,
+	})
+}
+
+func (t *Trace) add(ev TraceEvent) {
+	if t == nil {
+		return
+	}
+
+	if len(t.Iterations) == 0 {
+		t.begin(TRACE_STEP_DEPS)
+	}
+	it := t.Iterations[len(t.Iterations)-1]
+	it.Events = append(it.Events, ev)
+}
+
+// exprIdents collects the names of all settings referenced by an expression.
+func exprIdents(n *parse.Node, idents map[string]struct{}) {
+	if n == nil {
+		return
+	}
+
+	if n.Code == parse.PARSE_IDENT {
+		idents[n.Data] = struct{}{}
+	}
+	exprIdents(n.Left, idents)
+	exprIdents(n.Right, idents)
+	for _, arg := range n.Args {
+		exprIdents(arg, idents)
+	}
+}
+
+func (t *Trace) dep(evType string, rpkg *ResolvePackage,
+	depender *ResolvePackage, expr *parse.Node) {
+
+	if t == nil {
+		return
+	}
+
+	ev := TraceEvent{
+		Type:     evType,
+		Pkg:      rpkg.Lpkg.FullName(),
+		Depender: depender.Lpkg.FullName(),
+	}
+
+	if expr != nil {
+		ev.Expr = expr.String()
+
+		idents := map[string]struct{}{}
+		exprIdents(expr, idents)
+		for name, _ := range idents {
+			if iter, ok := t.changed[name]; ok {
+				ev.Causes = append(ev.Causes,
+					fmt.Sprintf("%s (iteration %d)", name, iter))
+			}
+		}
+		sort.Strings(ev.Causes)
+	}
+
+	t.add(ev)
+}
+
+func (t *Trace) removal(evType string, rpkg *ResolvePackage,
+	depender *ResolvePackage, reason string) {
+
+	if t == nil {
+		return
+	}
+
+	ev := TraceEvent{
+		Type:   evType,
+		Pkg:    rpkg.Lpkg.FullName(),
+		Reason: reason,
+	}
+	if depender != nil {
+		ev.Depender = depender.Lpkg.FullName()
+	}
+
+	t.add(ev)
+}
+
+func settingSource(entry syscfg.CfgEntry) string {
+	if len(entry.History) == 0 {
+		return ""
+	}
+
+	return entry.History[len(entry.History)-1].Name()
+}
+
+// reload records the differences between the old and new syscfg.
+func (t *Trace) reload(oldCfg syscfg.Cfg, newCfg syscfg.Cfg) {
+	if t == nil {
+		return
+	}
+
+	iter := len(t.Iterations) - 1
+
+	// The initial load defines every setting; summarize it rather than
+	// listing each one.
+	if len(oldCfg.Settings) == 0 {
+		for name, _ := range newCfg.Settings {
+			t.changed[name] = iter
+		}
+		t.add(TraceEvent{
+			Type:   TRACE_EVENT_CFG_LOAD,
+			Reason: fmt.Sprintf("%d settings", len(newCfg.Settings)),
+		})
+		return
+	}
+
+	names := make([]string, 0, len(newCfg.Settings))
+	for name, _ := range newCfg.Settings {
+		names = append(names, name)
+	}
+	for name, _ := range oldCfg.Settings {
+		if _, ok := newCfg.Settings[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		oldEntry, oldOk := oldCfg.Settings[name]
+		newEntry, newOk := newCfg.Settings[name]
+
+		ev := TraceEvent{
+			Type:    TRACE_EVENT_SETTING,
+			Setting: name,
+		}
+
+		switch {
+		case !oldOk:
+			ev.Change = "added"
+			ev.NewValue = newEntry.Value
+			ev.Source = settingSource(newEntry)
+
+		case !newOk:
+			ev.Change = "removed"
+			ev.OldValue = oldEntry.Value
+
+		case oldEntry.Value != newEntry.Value ||
+			len(oldEntry.History) != len(newEntry.History):
+
+			ev.Change = "changed"
+			ev.OldValue = oldEntry.Value
+			ev.NewValue = newEntry.Value
+			ev.Source = settingSource(newEntry)
+
+		default:
+			continue
+		}
+
+		t.changed[name] = iter
+		t.add(ev)
+	}
+}
+
+// finish records the final set of packages.
+func (t *Trace) finish(r *Resolver) {
+	if t == nil {
+		return
+	}
+
+	t.Pkgs = nil
+	for _, rpkg := range r.sortedRpkgs() {
+		t.Pkgs = append(t.Pkgs, rpkg.Lpkg.FullName())
+	}
+}
+
+func (ev *TraceEvent) text() string {
+	var s string
+
+	switch ev.Type {
+	case TRACE_EVENT_SEED:
+		s = fmt.Sprintf("seed %s", ev.Pkg)
+
+	case TRACE_EVENT_ADD, TRACE_EVENT_DEP:
+		verb := "added"
+		if ev.Type == TRACE_EVENT_DEP {
+			verb = "also required"
+		}
+		s = fmt.Sprintf("+ %s %s by %s", ev.Pkg, verb, ev.Depender)
+		if ev.Expr != "" {
+			s += fmt.Sprintf(" [%s]", ev.Expr)
+		}
+		if len(ev.Causes) > 0 {
+			s += fmt.Sprintf("; enabled by %s", strings.Join(ev.Causes, ", "))
+		}
+
+	case TRACE_EVENT_UNDEP:
+		s = fmt.Sprintf("- %s no longer required by %s",
+			ev.Pkg, ev.Depender)
+
+	case TRACE_EVENT_CFG_LOAD:
+		s = fmt.Sprintf("syscfg loaded: %s", ev.Reason)
+
+	case TRACE_EVENT_CFG_STABLE:
+		s = "no settings added, removed, or changed; " +
+			"dependencies not reprocessed"
+
+	case TRACE_EVENT_SETTING:
+		switch ev.Change {
+		case "added":
+			s = fmt.Sprintf("%s added: %s", ev.Setting, ev.NewValue)
+		case "removed":
+			s = fmt.Sprintf("%s removed (was %s)", ev.Setting, ev.OldValue)
+		default:
+			s = fmt.Sprintf("%s changed: %s -> %s",
+				ev.Setting, ev.OldValue, ev.NewValue)
+		}
+		if ev.Source != "" {
+			s += fmt.Sprintf(" (%s)", ev.Source)
+		}
+
+	case TRACE_EVENT_DELETE:
+		s = fmt.Sprintf("- %s deleted: %s", ev.Pkg, ev.Reason)
+
+	default:
+		s = fmt.Sprintf("- %s pruned as %s: %s", ev.Pkg, ev.Type, ev.Reason)
+	}
+
+	return s
+}
+
+// Text produces a human-readable listing of the trace.  Iterations that
+// changed nothing are omitted.
+func (t *Trace) Text() string {
+	buf := bytes.Buffer{}
+
+	for _, it := range t.Iterations {
+		if len(it.Events) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&buf, "Iteration %d (%s):\n", it.Num, it.Step)
+		for _, ev := range it.Events {
+			fmt.Fprintf(&buf, "    %s\n", ev.text())
+		}
+	}
+
+	fmt.Fprintf(&buf, "Resolved %d packages after %d iterations:\n",
+		len(t.Pkgs), len(t.Iterations))
+	for _, name := range t.Pkgs {
+		fmt.Fprintf(&buf, "    %s\n", name)
+	}
+
+	return buf.String()
+}
+
+func (t *Trace) JSON() (string, error) {
+	b, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	return string(b) + "\n", nil
+}
+
+// Dot produces a Graphviz graph of every dependency the resolver added.
+// Pruned packages and dropped dependencies are drawn dashed.  Edges are
+// labelled with the iteration that added them and the enabling expression.
+func (t *Trace) Dot() string {
+	final := map[string]struct{}{}
+	for _, name := range t.Pkgs {
+		final[name] = struct{}{}
+	}
+
+	type edge struct {
+		from string
+		to   string
+	}
+
+	nodes := map[string]struct{}{}
+	edges := map[edge]string{}
+	dropped := map[edge]struct{}{}
+	var order []edge
+
+	for _, it := range t.Iterations {
+		for _, ev := range it.Events {
+			switch ev.Type {
+			case TRACE_EVENT_SEED:
+				nodes[ev.Pkg] = struct{}{}
+
+			case TRACE_EVENT_ADD, TRACE_EVENT_DEP:
+				e := edge{ev.Depender, ev.Pkg}
+				nodes[ev.Depender] = struct{}{}
+				nodes[ev.Pkg] = struct{}{}
+
+				label := fmt.Sprintf("#%d", it.Num)
+				if ev.Expr != "" {
+					label += " " + ev.Expr
+				}
+				if _, ok := edges[e]; !ok {
+					order = append(order, e)
+				}
+				edges[e] = label
+				delete(dropped, e)
+
+			case TRACE_EVENT_UNDEP:
+				dropped[edge{ev.Depender, ev.Pkg}] = struct{}{}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(nodes))
+	for name, _ := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "digraph resolve {\n")
+	fmt.Fprintf(&buf, "    rankdir=LR;\n")
+	fmt.Fprintf(&buf, "    node [shape=box];\n")
+
+	for _, name := range names {
+		if _, ok := final[name]; ok {
+			fmt.Fprintf(&buf, "    %q;\n", name)
+		} else {
+			fmt.Fprintf(&buf, "    %q [style=dashed, color=gray];\n", name)
+		}
+	}
+
+	for _, e := range order {
+		attrs := fmt.Sprintf("label=%q", edges[e])
+
+		_, fromOk := final[e.from]
+		_, toOk := final[e.to]
+		_, isDropped := dropped[e]
+		if isDropped || !fromOk || !toOk {
+			attrs += ", style=dashed, color=gray"
+		}
+
+		fmt.Fprintf(&buf, "    %q -> %q [%s];\n", e.from, e.to, attrs)
+	}
+
+	fmt.Fprintf(&buf, "}\n")
+
+	return buf.String()
+}
+
+// Render produces the trace in the specified format.
+func (t *Trace) Render(format string) (string, error) {
+	switch format {
+	case TRACE_FORMAT_TEXT:
+		return t.Text(), nil
+	case TRACE_FORMAT_JSON:
+		return t.JSON()
+	case TRACE_FORMAT_DOT:
+		return t.Dot(), nil
+	default:
+		return "", util.FmtNewtError(
+			"Invalid trace format \"%s\"; must be one of: %s",
+			format, strings.Join(TraceFormats, ", "))
+	}
+}
+
+// imposterReason explains why a package was identified as an imposter.
+func imposterReason(rpkg *ResolvePackage) string {
+	var dependers []string
+	for depender, _ := range rpkg.revDeps {
+		s := depender.Lpkg.FullName()
+		if expr := depender.Deps[rpkg].Exprs.Disjunction(); expr != nil {
+			s += fmt.Sprintf(" [%s]", expr.String())
+		}
+		dependers = append(dependers, s)
+	}
+	sort.Strings(dependers)
+
+	return fmt.Sprintf("cannot be traced to a seed package without its "+
+		"own syscfg definitions and overrides; required by %s",
+		strings.Join(dependers, ", "))
+}
@@ -0,0 +1,155 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package resolve
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dachalco/mynewt-newt/newt/pkg"
+)
+
+// Adds version constraints to a dependency, ignoring duplicates.
+func (dep *ResolveDep) addVersionReqs(reqs []pkg.VersionReq) {
+	for _, req := range reqs {
+		dup := false
+		for _, old := range dep.VersionReqs {
+			if old == req {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			dep.VersionReqs = append(dep.VersionReqs, req)
+		}
+	}
+}
+
+// Finds the shortest chain of dependencies leading from a seed package to the
+// specified package.  The returned slice starts with the seed and ends with
+// the specified package.
+func (r *Resolver) depChain(dst *ResolvePackage) []*ResolvePackage {
+	prev := map[*ResolvePackage]*ResolvePackage{}
+	var queue []*ResolvePackage
+
+	for _, lpkg := range r.seedPkgs {
+		if rpkg := r.pkgMap[lpkg]; rpkg != nil {
+			if _, ok := prev[rpkg]; !ok {
+				prev[rpkg] = nil
+				queue = append(queue, rpkg)
+			}
+		}
+	}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		if cur == dst {
+			var chain []*ResolvePackage
+			for p := cur; p != nil; p = prev[p] {
+				chain = append([]*ResolvePackage{p}, chain...)
+			}
+			return chain
+		}
+
+		deps := make([]*ResolvePackage, 0, len(cur.Deps))
+		for dep, _ := range cur.Deps {
+			deps = append(deps, dep)
+		}
+		SortResolvePkgs(deps)
+
+		for _, dep := range deps {
+			if _, ok := prev[dep]; !ok {
+				prev[dep] = cur
+				queue = append(queue, dep)
+			}
+		}
+	}
+
+	return []*ResolvePackage{dst}
+}
+
+// Verifies that each package satisfies the version constraints that its
+// dependents place on it.  It returns a description of every unmet
+// constraint.
+func (r *Resolver) checkDepVersions() []string {
+	var errs []string
+
+	for _, rpkg := range r.sortedRpkgs() {
+		deps := make([]*ResolvePackage, 0, len(rpkg.Deps))
+		for dep, _ := range rpkg.Deps {
+			deps = append(deps, dep)
+		}
+		SortResolvePkgs(deps)
+
+		for _, depPkg := range deps {
+			rdep := rpkg.Deps[depPkg]
+			if len(rdep.VersionReqs) == 0 {
+				continue
+			}
+
+			reqStrs := make([]string, len(rdep.VersionReqs))
+			for i, req := range rdep.VersionReqs {
+				reqStrs[i] = req.String()
+			}
+
+			desc := fmt.Sprintf("%s requires %s %s",
+				rpkg.Lpkg.FullName(), depPkg.Lpkg.FullName(),
+				strings.Join(reqStrs, " "))
+
+			ver, ok, err := depPkg.Lpkg.Version()
+			switch {
+			case err != nil:
+				desc += "; " + err.Error()
+			case !ok:
+				desc += fmt.Sprintf(", but %s does not specify a version "+
+					"(pkg.version)", depPkg.Lpkg.FullName())
+			default:
+				met := true
+				for _, req := range rdep.VersionReqs {
+					if !req.Satisfied(ver) {
+						met = false
+						break
+					}
+				}
+				if met {
+					continue
+				}
+				desc += fmt.Sprintf(", but %s has version %s",
+					depPkg.Lpkg.FullName(), ver.String())
+			}
+
+			chain := r.depChain(rpkg)
+			names := make([]string, 0, len(chain)+1)
+			for _, c := range chain {
+				names = append(names, c.Lpkg.FullName())
+			}
+			names = append(names, depPkg.Lpkg.FullName())
+
+			errs = append(errs, desc+"\n        dependency chain: "+
+				strings.Join(names, " -> "))
+		}
+	}
+
+	sort.Strings(errs)
+	return errs
+}
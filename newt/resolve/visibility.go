@@ -0,0 +1,53 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package resolve
+
+import (
+	"github.com/dachalco/mynewt-newt/newt/parse"
+	"github.com/dachalco/mynewt-newt/newt/pkg"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// checkVisibility ensures the dependee's `pkg.visibility` setting permits the
+// depender to depend on it.  The error identifies where the offending
+// dependency was declared.
+func checkVisibility(depender *pkg.LocalPackage, dependee *pkg.LocalPackage,
+	expr *parse.Node, depStr string) error {
+
+	vis, err := dependee.Visibility()
+	if err != nil {
+		return err
+	}
+
+	if vis.Permits(depender) {
+		return nil
+	}
+
+	key := "pkg.deps"
+	if expr != nil {
+		key += "." + expr.String()
+	}
+
+	return util.FmtNewtError(
+		"Package visibility violation: %s depends on %s, which is %s\n"+
+			"    declared in %s: %s: %s",
+		depender.FullName(), dependee.FullName(), vis.String(),
+		depender.PkgYamlPath(), key, depStr)
+}
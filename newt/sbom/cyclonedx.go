@@ -0,0 +1,158 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package sbom
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/dachalco/mynewt-newt/newt/license"
+	"github.com/dachalco/mynewt-newt/newt/newtutil"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// CycloneDX 1.4 JSON BOM.  Only the fields that newt populates are defined.
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxLicense struct {
+	Expression string `json:"expression"`
+}
+
+type cdxExtRef struct {
+	Type string `json:"type"`
+	Url  string `json:"url"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxComponent struct {
+	Type               string         `json:"type"`
+	BomRef             string         `json:"bom-ref"`
+	Name               string         `json:"name"`
+	Version            string         `json:"version,omitempty"`
+	Hashes             []cdxHash      `json:"hashes,omitempty"`
+	Licenses           []cdxLicense   `json:"licenses,omitempty"`
+	ExternalReferences []cdxExtRef    `json:"externalReferences,omitempty"`
+	Properties         []cdxProperty  `json:"properties,omitempty"`
+	Components         []cdxComponent `json:"components,omitempty"`
+}
+
+type cdxTool struct {
+	Vendor  string `json:"vendor"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type cdxMetadata struct {
+	Timestamp string        `json:"timestamp"`
+	Tools     []cdxTool     `json:"tools"`
+	Component *cdxComponent `json:"component,omitempty"`
+}
+
+type cdxBom struct {
+	BomFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber"`
+	Version      int            `json:"version"`
+	Metadata     cdxMetadata    `json:"metadata"`
+	Components   []cdxComponent `json:"components"`
+}
+
+func (s *Sbom) marshalCycloneDx() ([]byte, error) {
+	bom := cdxBom{
+		BomFormat:    "CycloneDX",
+		SpecVersion:  "1.4",
+		SerialNumber: "urn:uuid:" + newUuid(),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: s.Created.Format(time.RFC3339),
+			Tools: []cdxTool{{
+				Vendor:  "Apache Mynewt",
+				Name:    "newt",
+				Version: newtutil.NewtVersionStr,
+			}},
+		},
+		Components: []cdxComponent{},
+	}
+
+	// The target itself is the subject of the BOM.  Its images are nested
+	// within it.
+	target := &cdxComponent{
+		Type:   "firmware",
+		BomRef: s.Target,
+		Name:   s.Target,
+	}
+	for _, img := range s.Images {
+		ic := cdxComponent{
+			Type:   "firmware",
+			BomRef: s.Target + "/" + img.Role,
+			Name:   s.Target + "/" + img.Role,
+		}
+		if img.Hash != "" {
+			ic.Hashes = []cdxHash{{Alg: "SHA-256", Content: img.Hash}}
+		}
+		target.Components = append(target.Components, ic)
+	}
+	bom.Metadata.Component = target
+
+	for _, c := range s.Components {
+		cc := cdxComponent{
+			Type:    "library",
+			BomRef:  c.Name,
+			Name:    c.Name,
+			Version: c.Version,
+		}
+		if c.License != license.NOASSERTION {
+			cc.Licenses = []cdxLicense{{Expression: c.License}}
+		}
+		if c.RepoURL != "" {
+			cc.ExternalReferences = []cdxExtRef{{Type: "vcs", Url: c.RepoURL}}
+		}
+		if c.Repo != "" {
+			cc.Properties = append(cc.Properties,
+				cdxProperty{Name: "newt:repo", Value: c.Repo})
+		}
+		if c.Commit != "" {
+			cc.Properties = append(cc.Properties,
+				cdxProperty{Name: "newt:commit", Value: c.Commit},
+				cdxProperty{Name: "newt:dirty",
+					Value: strconv.FormatBool(c.Dirty)})
+		}
+		cc.Properties = append(cc.Properties,
+			cdxProperty{Name: "newt:license-source", Value: c.LicenseSource})
+
+		bom.Components = append(bom.Components, cc)
+	}
+
+	b, err := json.MarshalIndent(bom, "", "    ")
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,257 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package sbom generates a software bill of materials (SBOM) for a target.
+// The SBOM lists every package linked into the target's images along with its
+// origin and license.  SPDX and CycloneDX JSON formats are supported.
+package sbom
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/apache/mynewt-artifact/image"
+	"github.com/dachalco/mynewt-newt/newt/builder"
+	"github.com/dachalco/mynewt-newt/newt/license"
+	"github.com/dachalco/mynewt-newt/newt/manifest"
+	"github.com/dachalco/mynewt-newt/newt/repo"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+const (
+	FORMAT_SPDX_JSON      = "spdx-json"
+	FORMAT_CYCLONEDX_JSON = "cyclonedx-json"
+)
+
+var Formats = []string{
+	FORMAT_SPDX_JSON,
+	FORMAT_CYCLONEDX_JSON,
+}
+
+// Image roles.
+const (
+	IMAGE_APP    = "app"
+	IMAGE_LOADER = "loader"
+)
+
+// A Component is a single package included in the target.
+type Component struct {
+	Name          string
+	Repo          string
+	RepoURL       string
+	Version       string
+	Commit        string
+	Dirty         bool
+	License       string
+	LicenseSource string
+}
+
+// An Image is a firmware image produced for the target.
+type Image struct {
+	Role string
+	Path string
+
+	// Hex-encoded SHA256 image hash; empty if the image has not been created.
+	Hash string
+}
+
+type Sbom struct {
+	Target     string
+	Created    time.Time
+	Components []Component
+	Images     []Image
+}
+
+// repoVersion determines the installed version of a repo.
+func repoVersion(r *repo.Repo) string {
+	if r == nil || r.IsLocal() {
+		return ""
+	}
+
+	ver, err := r.InstalledVersion()
+	if err != nil || ver == nil {
+		return ""
+	}
+
+	return ver.String()
+}
+
+// imageHash reads the hash of an existing image file.  It returns "" if the
+// image cannot be read.
+func imageHash(path string) string {
+	if util.NodeNotExist(path) {
+		return ""
+	}
+
+	img, err := image.ReadImage(path)
+	if err != nil {
+		log.Debugf("Failed to read image %s: %s", path, err.Error())
+		return ""
+	}
+
+	hash, err := img.Hash()
+	if err != nil {
+		log.Debugf("Failed to read hash of image %s: %s", path, err.Error())
+		return ""
+	}
+
+	return fmt.Sprintf("%x", hash)
+}
+
+// Collect builds an SBOM for the specified target.  The hash of each image is
+// read from the image file if it exists.
+func Collect(t *builder.TargetBuilder) (*Sbom, error) {
+	res, err := t.Resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Sbom{
+		Target:  t.GetTarget().FullName(),
+		Created: time.Now().UTC(),
+	}
+
+	rm := manifest.NewRepoManager()
+	for _, rpkg := range res.MasterSet.Rpkgs {
+		lpkg := rpkg.Lpkg
+		mp := rm.GetManifestPkg(lpkg)
+
+		lic, src := license.PkgLicense(lpkg)
+		r, _ := lpkg.Repo().(*repo.Repo)
+
+		s.Components = append(s.Components, Component{
+			Name:          lpkg.FullName(),
+			Repo:          mp.Repo,
+			Version:       repoVersion(r),
+			License:       lic,
+			LicenseSource: src,
+		})
+	}
+
+	// Fill in the repo details now that the repo manager has visited every
+	// repo.
+	allRepos := rm.AllRepos()
+	for i, _ := range s.Components {
+		c := &s.Components[i]
+		for _, mr := range allRepos {
+			if mr.Name == c.Repo {
+				c.RepoURL = mr.URL
+				c.Dirty = mr.Dirty
+
+				// The manifest uses a placeholder for repos that aren't
+				// under git.
+				if mr.Commit != "UNKNOWN" {
+					c.Commit = mr.Commit
+				}
+			}
+		}
+	}
+
+	sort.Slice(s.Components, func(i int, j int) bool {
+		return s.Components[i].Name < s.Components[j].Name
+	})
+
+	tgt := t.GetTarget()
+	addImage := func(role string, buildName string, appName string) {
+		path := builder.AppImgPath(tgt.FullName(), buildName, appName)
+		s.Images = append(s.Images, Image{
+			Role: role,
+			Path: path,
+			Hash: imageHash(path),
+		})
+	}
+
+	if tgt.Loader() != nil {
+		addImage(IMAGE_LOADER, builder.BUILD_NAME_LOADER,
+			tgt.Loader().FullName())
+	}
+	if tgt.App() != nil {
+		addImage(IMAGE_APP, builder.BUILD_NAME_APP, tgt.App().FullName())
+	}
+
+	return s, nil
+}
+
+// SetImageHash records the hash of a newly produced image.
+func (s *Sbom) SetImageHash(role string, hash []byte) {
+	for i, _ := range s.Images {
+		if s.Images[i].Role == role {
+			s.Images[i].Hash = fmt.Sprintf("%x", hash)
+		}
+	}
+}
+
+func newUuid() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	// Version 4, variant 1.
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10],
+		b[10:])
+}
+
+// Marshal encodes the SBOM in the specified format.
+func (s *Sbom) Marshal(format string) ([]byte, error) {
+	switch format {
+	case FORMAT_SPDX_JSON:
+		return s.marshalSpdx()
+	case FORMAT_CYCLONEDX_JSON:
+		return s.marshalCycloneDx()
+	default:
+		return nil, util.FmtNewtError(
+			"invalid SBOM format \"%s\"; must be one of %v", format, Formats)
+	}
+}
+
+// Write encodes the SBOM in the specified format and writes it to a file.
+func (s *Sbom) Write(format string, path string) error {
+	b, err := s.Marshal(format)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return util.FmtNewtError("failed to write SBOM \"%s\": %s", path,
+			err.Error())
+	}
+
+	return nil
+}
+
+// WriteStdout encodes the SBOM in the specified format and writes it to
+// stdout.
+func (s *Sbom) WriteStdout(format string) error {
+	b, err := s.Marshal(format)
+	if err != nil {
+		return err
+	}
+
+	os.Stdout.Write(b)
+	os.Stdout.Write([]byte("\n"))
+	return nil
+}
@@ -0,0 +1,169 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package sbom
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/dachalco/mynewt-newt/newt/license"
+	"github.com/dachalco/mynewt-newt/newt/newtutil"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// SPDX 2.3 JSON document.  Only the fields that newt populates are defined.
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxPackage struct {
+	SpdxId           string         `json:"SPDXID"`
+	Name             string         `json:"name"`
+	VersionInfo      string         `json:"versionInfo,omitempty"`
+	DownloadLocation string         `json:"downloadLocation"`
+	FilesAnalyzed    bool           `json:"filesAnalyzed"`
+	LicenseConcluded string         `json:"licenseConcluded"`
+	LicenseDeclared  string         `json:"licenseDeclared"`
+	CopyrightText    string         `json:"copyrightText"`
+	SourceInfo       string         `json:"sourceInfo,omitempty"`
+	PrimaryPurpose   string         `json:"primaryPackagePurpose,omitempty"`
+	Checksums        []spdxChecksum `json:"checksums,omitempty"`
+}
+
+type spdxRelationship struct {
+	Element string `json:"spdxElementId"`
+	Type    string `json:"relationshipType"`
+	Related string `json:"relatedSpdxElement"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxDoc struct {
+	SpdxVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SpdxId            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+var spdxIdRepl = strings.NewReplacer("@", "", "/", "-", "_", "-", "~", "-")
+
+// spdxId converts a package name to an SPDX element identifier.  Identifiers
+// may only contain letters, numbers, '.', and '-'.
+func spdxId(prefix string, name string) string {
+	return "SPDXRef-" + prefix + "-" + spdxIdRepl.Replace(name)
+}
+
+func (s *Sbom) marshalSpdx() ([]byte, error) {
+	doc := spdxDoc{
+		SpdxVersion: "SPDX-2.3",
+		DataLicense: "CC0-1.0",
+		SpdxId:      "SPDXRef-DOCUMENT",
+		Name:        s.Target,
+		DocumentNamespace: "https://mynewt.apache.org/spdxdocs/" +
+			spdxIdRepl.Replace(s.Target) + "-" + newUuid(),
+		CreationInfo: spdxCreationInfo{
+			Created:  s.Created.Format(time.RFC3339),
+			Creators: []string{"Tool: newt-" + newtutil.NewtVersionStr},
+		},
+	}
+
+	// Each image is a top-level package that contains every component.
+	for _, img := range s.Images {
+		p := spdxPackage{
+			SpdxId:           spdxId("Image", img.Role),
+			Name:             s.Target + "/" + img.Role,
+			DownloadLocation: license.NOASSERTION,
+			LicenseConcluded: license.NOASSERTION,
+			LicenseDeclared:  license.NOASSERTION,
+			CopyrightText:    license.NOASSERTION,
+			PrimaryPurpose:   "FIRMWARE",
+		}
+		if img.Hash != "" {
+			p.Checksums = []spdxChecksum{{
+				Algorithm:     "SHA256",
+				ChecksumValue: img.Hash,
+			}}
+		}
+		doc.Packages = append(doc.Packages, p)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			Element: doc.SpdxId,
+			Type:    "DESCRIBES",
+			Related: p.SpdxId,
+		})
+	}
+
+	for _, c := range s.Components {
+		p := spdxPackage{
+			SpdxId:           spdxId("Package", c.Name),
+			Name:             c.Name,
+			VersionInfo:      c.Version,
+			DownloadLocation: license.NOASSERTION,
+			LicenseConcluded: license.NOASSERTION,
+			LicenseDeclared:  c.License,
+			CopyrightText:    license.NOASSERTION,
+			PrimaryPurpose:   "LIBRARY",
+		}
+		if c.RepoURL != "" {
+			p.DownloadLocation = "git+" + c.RepoURL
+			if c.Commit != "" {
+				p.DownloadLocation += "@" + c.Commit
+			}
+		}
+		if c.Commit != "" {
+			p.SourceInfo = "repo " + c.Repo + " at commit " + c.Commit
+			if c.Dirty {
+				p.SourceInfo += " (with local modifications)"
+			}
+		}
+		doc.Packages = append(doc.Packages, p)
+
+		if len(s.Images) == 0 {
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				Element: doc.SpdxId,
+				Type:    "DESCRIBES",
+				Related: p.SpdxId,
+			})
+		}
+		for _, img := range s.Images {
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				Element: spdxId("Image", img.Role),
+				Type:    "CONTAINS",
+				Related: p.SpdxId,
+			})
+		}
+	}
+
+	b, err := json.MarshalIndent(doc, "", "    ")
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return b, nil
+}
@@ -92,3 +92,25 @@ func Newtrc() ycfg.YCfg {
 	newtrc = &yc
 	return yc
 }
+
+// NewtrcVal reads a setting from a section of newtrc.yml (e.g., "dir" in the
+// "build_cache" section).  The setting may be specified as a flat key
+// ("build_cache.dir: ...") or nested under a map named after the section.  It
+// returns nil if the setting is absent.
+func NewtrcVal(section string, name string) interface{} {
+	yc := Newtrc()
+
+	val, err := yc.GetFirstVal(section+"."+name, nil)
+	util.OneTimeWarningError(err)
+	if val != nil {
+		return val
+	}
+
+	val, err = yc.GetFirstVal(section, nil)
+	util.OneTimeWarningError(err)
+	if m, ok := val.(map[interface{}]interface{}); ok {
+		return m[name]
+	}
+
+	return nil
+}
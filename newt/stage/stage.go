@@ -97,11 +97,22 @@ func SortStageFuncs(sfs []StageFunc, entryType string) {
 			return false
 		}
 
-		// Same stage and function name?
+		// 3: Sort by package name.  This keeps the order deterministic
+		// when the same function is specified more than once.
+		if a.Pkg != nil && b.Pkg != nil {
+			switch strings.Compare(a.Pkg.FullName(), b.Pkg.FullName()) {
+			case -1:
+				return true
+			case 1:
+				return false
+			}
+		}
+
+		// Same stage, function name, and package?
 		log.Warnf("Warning: Identical %s entries detected: %s",
 			entryType, a.Name)
 
-		return true
+		return false
 	})
 }
 
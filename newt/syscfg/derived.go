@@ -0,0 +1,253 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package syscfg
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dachalco/mynewt-newt/newt/parse"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// Derived settings have a value that is computed from other settings.  A
+// derived setting is defined with a `derived` field (an expression) instead of
+// a `value` field, e.g.,
+//
+//     syscfg.defs:
+//         MSYS_1_POOL_SIZE:
+//             description: 'Total size of msys pool 1, in bytes'
+//             derived: 'MSYS_1_BLOCK_COUNT * MSYS_1_BLOCK_SIZE'
+//
+// Derived values are calculated after all overrides and value references have
+// been resolved.  Derived settings cannot be overridden.  A value reference
+// (`MYNEWT_VAL(...)`) to a derived setting is resolved along with the derived
+// settings, so the copy receives the calculated value.
+
+// isComputed indicates whether a setting's value is calculated from other
+// settings, i.e., whether it is derived or copied from another setting.
+func (entry CfgEntry) isComputed() bool {
+	return entry.DerivedExpr != "" || entry.ValueRefName != ""
+}
+
+// computedExpr describes how a computed setting's value is calculated.
+func (entry CfgEntry) computedExpr() string {
+	if entry.DerivedExpr != "" {
+		return entry.DerivedExpr
+	}
+	return "MYNEWT_VAL(" + entry.ValueRefName + ")"
+}
+
+// derivedDeps returns the names of the computed settings that the specified
+// computed setting depends on.
+func (cfg *Cfg) derivedDeps(entry CfgEntry) []string {
+	var names []string
+	if entry.DerivedExpr != "" {
+		tokens, err := parse.Lex(entry.DerivedExpr)
+		if err != nil {
+			return nil
+		}
+		names = parse.IdentNames(tokens)
+	} else if entry.ValueRefName != "" {
+		names = []string{entry.ValueRefName}
+	}
+
+	var deps []string
+	for _, name := range names {
+		if dep, ok := cfg.Settings[name]; ok && dep.isComputed() {
+			deps = append(deps, name)
+		}
+	}
+
+	return deps
+}
+
+// evalDerived evaluates a derived setting's expression.  Expressions that
+// yield a boolean produce 1 or 0.
+func evalDerived(exprStr string, settings map[string]string) (string, error) {
+	expr, err := parse.LexAndParse(exprStr)
+	if err != nil {
+		return "", err
+	}
+
+	i, err := parse.EvalInt(expr, settings)
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.Itoa(i), nil
+}
+
+// setDerivedValue records the calculated value of a derived setting.  The
+// value is attributed to the defining package.
+func (entry *CfgEntry) setDerivedValue(val string) {
+	entry.Value = val
+	entry.History[0].Value = val
+}
+
+// ResolveDerived calculates the value of each derived setting and refreshes
+// the value of each setting that references another setting.  It must be
+// called after ResolveValueRefs.  Settings are evaluated in dependency order;
+// settings that form a cycle are recorded as errors and left undefined.
+func (cfg *Cfg) ResolveDerived() {
+	names := []string{}
+	for name, entry := range cfg.Settings {
+		if entry.isComputed() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+
+	state := map[string]int{}
+	settings := cfg.SettingValues()
+
+	var visit func(name string, path []string)
+	visit = func(name string, path []string) {
+		switch state[name] {
+		case done:
+			return
+		case visiting:
+			// Report the cycle starting from its first occurrence in the path.
+			for i, p := range path {
+				if p == name {
+					cycle := append(append([]string{}, path[i:]...), name)
+					text := "cycle: " + strings.Join(cycle, " -> ")
+					for _, c := range path[i:] {
+						cfg.DerivedErrors[c] = text
+					}
+					break
+				}
+			}
+			return
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+
+		entry := cfg.Settings[name]
+		for _, dep := range cfg.derivedDeps(entry) {
+			visit(dep, path)
+		}
+
+		state[name] = done
+
+		if entry.DerivedExpr == "" {
+			// A value reference; copy the referenced setting's value.
+			if _, ok := cfg.DerivedErrors[name]; ok {
+				entry.Value = ""
+			} else {
+				entry.Value = settings[entry.ValueRefName]
+			}
+		} else if _, ok := cfg.DerivedErrors[name]; ok {
+			entry.setDerivedValue("")
+		} else {
+			val, err := evalDerived(entry.DerivedExpr, settings)
+			if err != nil {
+				cfg.DerivedErrors[name] = err.Error()
+				val = ""
+			}
+			entry.setDerivedValue(val)
+		}
+
+		settings[name] = entry.Value
+		cfg.Settings[name] = entry
+		cfg.checkValueType(entry, settings)
+	}
+
+	for _, name := range names {
+		visit(name, nil)
+	}
+}
+
+// Records an attempted override of a derived setting.
+func (cfg *Cfg) addDerivedOverride(settingName string, point CfgPoint) {
+	cfg.DerivedOverrides[settingName] =
+		append(cfg.DerivedOverrides[settingName], point)
+}
+
+func (cfg *Cfg) derivedErrorText(historyMap map[string][]CfgPoint) string {
+	str := ""
+
+	if len(cfg.DerivedErrors) > 0 {
+		str += "Derived setting errors detected:\n"
+
+		names := make([]string, 0, len(cfg.DerivedErrors))
+		for name, _ := range cfg.DerivedErrors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			entry := cfg.Settings[name]
+			str += fmt.Sprintf("    %s = `%s`: %s\n",
+				name, entry.computedExpr(), cfg.DerivedErrors[name])
+		}
+	}
+
+	if len(cfg.DerivedOverrides) > 0 {
+		str += "Override of derived settings detected:\n"
+
+		names := make([]string, 0, len(cfg.DerivedOverrides))
+		for name, _ := range cfg.DerivedOverrides {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			entry := cfg.Settings[name]
+			points := cfg.DerivedOverrides[name]
+
+			pkgNames := make([]string, len(points))
+			for i, p := range points {
+				pkgNames[i] = p.Name()
+			}
+
+			str += fmt.Sprintf("    %s (derived from `%s`) overridden by: %s\n",
+				name, entry.DerivedExpr, strings.Join(pkgNames, ", "))
+			historyMap[name] = append(
+				[]CfgPoint{entry.History[0]}, points...)
+		}
+	}
+
+	return str
+}
+
+// readDerived parses the `derived` field of a setting definition.
+func (entry *CfgEntry) readDerived(vals map[interface{}]interface{}) error {
+	entry.DerivedExpr = stringValue(vals["derived"])
+	if entry.DerivedExpr == "" {
+		return util.FmtNewtError("empty derived expression")
+	}
+
+	if _, err := parse.LexAndParse(entry.DerivedExpr); err != nil {
+		return util.FmtNewtError("invalid derived expression `%s`: %s",
+			entry.DerivedExpr, err.Error())
+	}
+
+	return nil
+}
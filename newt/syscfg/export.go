@@ -0,0 +1,367 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package syscfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/dachalco/mynewt-newt/newt/newtutil"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+const (
+	EXPORT_FORMAT_JSON   = "json"
+	EXPORT_FORMAT_CMAKE  = "cmake"
+	EXPORT_FORMAT_MAKE   = "make"
+	EXPORT_FORMAT_PYTHON = "python"
+	EXPORT_FORMAT_RUST   = "rust"
+	EXPORT_FORMAT_ENV    = "env"
+)
+
+var ExportFormats = []string{
+	EXPORT_FORMAT_JSON,
+	EXPORT_FORMAT_CMAKE,
+	EXPORT_FORMAT_MAKE,
+	EXPORT_FORMAT_PYTHON,
+	EXPORT_FORMAT_RUST,
+	EXPORT_FORMAT_ENV,
+}
+
+// Name of the file each export format is written to during a build.
+var exportFilenames = map[string]string{
+	EXPORT_FORMAT_JSON:   "syscfg.json",
+	EXPORT_FORMAT_CMAKE:  "syscfg.cmake",
+	EXPORT_FORMAT_MAKE:   "syscfg.mk",
+	EXPORT_FORMAT_PYTHON: "syscfg.py",
+	EXPORT_FORMAT_RUST:   "syscfg.rs",
+	EXPORT_FORMAT_ENV:    "syscfg.env",
+}
+
+// ExportSetting is a single resolved setting in exported form.
+type ExportSetting struct {
+	Name string `json:"-"`
+
+	// One of: nil (undefined), int64, bool, or string.
+	Value interface{} `json:"value"`
+
+	Type    string `json:"type,omitempty"`
+	Package string `json:"package"`
+}
+
+// NativeValue converts a setting's value to the most natural host
+// representation: an int64 for numeric values, a bool for booleans, or a
+// string.  Untyped settings are exported as integers if their values are
+// integer literals.  Nil is returned for settings without a value.
+func (entry *CfgEntry) NativeValue(settings map[string]string) interface{} {
+	val := strings.TrimSpace(entry.Value)
+	if val == "" {
+		return nil
+	}
+
+	switch entry.ValueType {
+	case CFG_VALUE_TYPE_NONE:
+		if i, ok := parseIntLit(val); ok {
+			return i
+		}
+		return val
+
+	case CFG_VALUE_TYPE_BOOL:
+		if b, err := parseBool(val); err == nil {
+			return b
+		}
+		return val
+
+	case CFG_VALUE_TYPE_STRING, CFG_VALUE_TYPE_CHOICE:
+		return val
+
+	default:
+		cval, err := entry.CValue(settings)
+		if err != nil {
+			return val
+		}
+		if i, ok := parseIntLit(cval); ok {
+			return i
+		}
+		return val
+	}
+}
+
+// ExportSettings produces the exported form of every setting, sorted by name.
+func (cfg *Cfg) ExportSettings() []ExportSetting {
+	settings := cfg.SettingValues()
+
+	names := make([]string, 0, len(cfg.Settings))
+	for name, _ := range cfg.Settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ess := make([]ExportSetting, len(names))
+	for i, name := range names {
+		entry := cfg.Settings[name]
+		ess[i] = ExportSetting{
+			Name:    name,
+			Value:   entry.NativeValue(settings),
+			Type:    entry.ValueType.String(),
+			Package: entry.History[0].Name(),
+		}
+	}
+
+	return ess
+}
+
+// exportComment describes a setting's type and origin.
+func exportComment(es ExportSetting) string {
+	if es.Type == "" {
+		return "defined by " + es.Package
+	}
+	return es.Type + "; defined by " + es.Package
+}
+
+// exportScalar formats a value for a format that represents everything as
+// text (booleans become 1 or 0, as in C).
+func exportScalar(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func exportJson(ess []ExportSetting, w io.Writer) error {
+	m := make(map[string]ExportSetting, len(ess))
+	for _, es := range ess {
+		m[es.Name] = es
+	}
+
+	b, err := json.MarshalIndent(m, "", "    ")
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	w.Write(b)
+	fmt.Fprintf(w, "\n")
+	return nil
+}
+
+func cmakeQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, `;`, `\;`)
+	return "\"" + r.Replace(s) + "\""
+}
+
+func exportCmake(ess []ExportSetting, w io.Writer) {
+	fmt.Fprintf(w, "# This file was generated by Apache newt version: %s\n",
+		newtutil.NewtVersionStr)
+
+	for _, es := range ess {
+		fmt.Fprintf(w, "\n# %s\n", exportComment(es))
+		fmt.Fprintf(w, "set(%s %s)\n", settingName(es.Name),
+			cmakeQuote(exportScalar(es.Value)))
+	}
+}
+
+func exportMake(ess []ExportSetting, w io.Writer) {
+	r := strings.NewReplacer("$", "$$", "#", `\#`)
+
+	fmt.Fprintf(w, "# This file was generated by Apache newt version: %s\n",
+		newtutil.NewtVersionStr)
+
+	for _, es := range ess {
+		fmt.Fprintf(w, "\n# %s\n", exportComment(es))
+		fmt.Fprintf(w, "%s := %s\n", settingName(es.Name),
+			r.Replace(exportScalar(es.Value)))
+	}
+}
+
+func exportPython(ess []ExportSetting, w io.Writer) {
+	fmt.Fprintf(w, "# This file was generated by Apache newt version: %s\n",
+		newtutil.NewtVersionStr)
+
+	for _, es := range ess {
+		var s string
+		switch v := es.Value.(type) {
+		case nil:
+			s = "None"
+		case bool:
+			if v {
+				s = "True"
+			} else {
+				s = "False"
+			}
+		case string:
+			// A JSON string is also a valid Python string literal.
+			b, _ := json.Marshal(v)
+			s = string(b)
+		default:
+			s = fmt.Sprintf("%v", v)
+		}
+
+		fmt.Fprintf(w, "\n# %s\n", exportComment(es))
+		fmt.Fprintf(w, "%s = %s\n", settingName(es.Name), s)
+	}
+}
+
+func rustQuote(s string) string {
+	var buf bytes.Buffer
+
+	buf.WriteByte('"')
+	for _, c := range s {
+		switch {
+		case c == '"' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(c)
+		case c == '\n':
+			buf.WriteString(`\n`)
+		case c == '\t':
+			buf.WriteString(`\t`)
+		case c == '\r':
+			buf.WriteString(`\r`)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&buf, `\u{%x}`, c)
+		default:
+			buf.WriteRune(c)
+		}
+	}
+	buf.WriteByte('"')
+
+	return buf.String()
+}
+
+func exportRust(ess []ExportSetting, w io.Writer) {
+	fmt.Fprintf(w, "// This file was generated by Apache newt version: %s\n",
+		newtutil.NewtVersionStr)
+
+	for _, es := range ess {
+		name := settingName(es.Name)
+
+		fmt.Fprintf(w, "\n/// %s\n", exportComment(es))
+		switch v := es.Value.(type) {
+		case nil:
+			fmt.Fprintf(w, "// %s is undefined.\n", name)
+		case bool:
+			fmt.Fprintf(w, "pub const %s: bool = %t;\n", name, v)
+		case int64:
+			fmt.Fprintf(w, "pub const %s: i64 = %d;\n", name, v)
+		default:
+			fmt.Fprintf(w, "pub const %s: &str = %s;\n", name,
+				rustQuote(fmt.Sprintf("%v", v)))
+		}
+	}
+}
+
+func exportEnv(ess []ExportSetting, w io.Writer) {
+	fmt.Fprintf(w, "# This file was generated by Apache newt version: %s\n",
+		newtutil.NewtVersionStr)
+
+	for _, es := range ess {
+		s := exportScalar(es.Value)
+		if _, ok := es.Value.(string); ok {
+			s = "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+		}
+
+		fmt.Fprintf(w, "\n# %s\n", exportComment(es))
+		fmt.Fprintf(w, "%s=%s\n", settingName(es.Name), s)
+	}
+}
+
+// Export encodes every setting in the specified format (one of the
+// EXPORT_FORMAT_[...] constants).
+func (cfg *Cfg) Export(format string) ([]byte, error) {
+	ess := cfg.ExportSettings()
+	buf := bytes.Buffer{}
+
+	switch format {
+	case EXPORT_FORMAT_JSON:
+		if err := exportJson(ess, &buf); err != nil {
+			return nil, err
+		}
+	case EXPORT_FORMAT_CMAKE:
+		exportCmake(ess, &buf)
+	case EXPORT_FORMAT_MAKE:
+		exportMake(ess, &buf)
+	case EXPORT_FORMAT_PYTHON:
+		exportPython(ess, &buf)
+	case EXPORT_FORMAT_RUST:
+		exportRust(ess, &buf)
+	case EXPORT_FORMAT_ENV:
+		exportEnv(ess, &buf)
+	default:
+		return nil, util.FmtNewtError(
+			"invalid syscfg export format \"%s\"; must be one of %v",
+			format, ExportFormats)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ExportPath returns the path of the file that the specified export format is
+// written to by EnsureExported.
+func ExportPath(dir string, format string) string {
+	return dir + "/" + exportFilenames[format]
+}
+
+// EnsureExported writes the settings in each of the specified formats to the
+// given directory.  Files whose contents are unchanged are not rewritten.
+func EnsureExported(cfg Cfg, dir string, formats []string) error {
+	for _, format := range formats {
+		b, err := cfg.Export(format)
+		if err != nil {
+			return err
+		}
+
+		path := ExportPath(dir, format)
+		writeReqd, err := util.FileContentsChanged(path, b)
+		if err != nil {
+			return err
+		}
+		if !writeReqd {
+			log.Debugf("syscfg unchanged; not writing %s export (%s).",
+				format, path)
+			continue
+		}
+
+		log.Debugf("syscfg changed; writing %s export (%s).", format, path)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return util.NewNewtError(err.Error())
+		}
+		if err := ioutil.WriteFile(path, b, 0644); err != nil {
+			return util.NewNewtError(err.Error())
+		}
+	}
+
+	return nil
+}
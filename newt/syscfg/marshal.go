@@ -31,6 +31,17 @@ var cfgSettingNameTypeMap = map[string]CfgSettingType{
 	"flash_owner":   CFG_SETTING_TYPE_FLASH_OWNER,
 }
 
+var cfgValueTypeNameMap = map[string]CfgValueType{
+	"":        CFG_VALUE_TYPE_NONE,
+	"int":     CFG_VALUE_TYPE_INT,
+	"bool":    CFG_VALUE_TYPE_BOOL,
+	"string":  CFG_VALUE_TYPE_STRING,
+	"choice":  CFG_VALUE_TYPE_CHOICE,
+	"bitmask": CFG_VALUE_TYPE_BITMASK,
+	"address": CFG_VALUE_TYPE_ADDR,
+	"size":    CFG_VALUE_TYPE_SIZE,
+}
+
 var cfgSettingNameStateMap = map[string]CfgSettingState{
 	"good":       CFG_SETTING_STATE_GOOD,
 	"deprecated": CFG_SETTING_STATE_DEPRECATED,
@@ -149,3 +160,39 @@ func (t *CfgFlashConflictCode) UnmarshalJSON(b []byte) error {
 	*t = x
 	return nil
 }
+
+func (t CfgValueType) String() string {
+	for k, v := range cfgValueTypeNameMap {
+		if v == t {
+			return k
+		}
+	}
+	return "???"
+}
+
+func CfgValueTypeFromString(s string) (CfgValueType, error) {
+	if t, ok := cfgValueTypeNameMap[s]; ok {
+		return t, nil
+	}
+
+	return 0, util.FmtNewtError("cannot parse syscfg value type: \"%s\"", s)
+}
+
+func (t CfgValueType) MarshalJSON() ([]byte, error) {
+	return util.MarshalJSONStringer(t)
+}
+
+func (t *CfgValueType) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	x, err := CfgValueTypeFromString(s)
+	if err != nil {
+		return err
+	}
+
+	*t = x
+	return nil
+}
@@ -0,0 +1,182 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package syscfg
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/dachalco/mynewt-newt/newt/flashmap"
+	"github.com/dachalco/mynewt-newt/newt/parse"
+)
+
+// Restriction expressions may refer to properties of the target hardware
+// (flash area sizes and offsets, RAM size) and of the linked image (memory
+// region sizes and usage).  These properties are stored in the settings map
+// under keys produced by parse.PropKey(), which cannot collide with setting
+// names.
+
+// MemRegion describes a linker memory region of a linked image.
+type MemRegion struct {
+	Name string
+	Size int
+	Used int
+}
+
+// Records the BSP properties that restrictions can refer to.
+func (cfg *Cfg) setBspProps(flashMap flashmap.FlashMap, ramSize int) {
+	for name, area := range flashMap.Areas {
+		cfg.Props[parse.PropKey("flash_size", name)] = strconv.Itoa(area.Size)
+		cfg.Props[parse.PropKey("flash_offset", name)] =
+			strconv.Itoa(area.Offset)
+	}
+
+	if ramSize > 0 {
+		cfg.Props[parse.PropKey("ram_size", "")] = strconv.Itoa(ramSize)
+	}
+}
+
+// Retrieves the names of the property functions that a restriction calls.
+func (r *CfgRestriction) propFuncs() []string {
+	var expr string
+	switch r.Code {
+	case CFG_RESTRICTION_CODE_EXPR:
+		expr = normalizeExpr(r.Expr, r.BaseSetting)
+	case CFG_RESTRICTION_CODE_RANGE:
+		expr = r.createRangeExpr()
+	default:
+		return nil
+	}
+
+	tokens, _ := parse.Lex(expr)
+
+	var names []string
+	for _, name := range parse.FuncNames(tokens) {
+		if parse.IsPropFunc(name) {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// Indicates whether a restriction can only be evaluated after the image has
+// been linked.
+func (r *CfgRestriction) isLinkTime() bool {
+	for _, name := range r.propFuncs() {
+		if parse.IsLinkFunc(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Produces the map that a restriction is evaluated against: the specified
+// settings plus any properties that the restriction refers to.
+func (cfg *Cfg) restrictionSettings(
+	r CfgRestriction, settings map[string]string) map[string]string {
+
+	if len(cfg.Props) == 0 || len(r.propFuncs()) == 0 {
+		return settings
+	}
+
+	merged := make(map[string]string, len(settings)+len(cfg.Props))
+	for k, v := range settings {
+		merged[k] = v
+	}
+	for k, v := range cfg.Props {
+		merged[k] = v
+	}
+
+	return merged
+}
+
+// HasLinkRestrictions indicates whether any restriction refers to properties
+// of the linked image (mem_size() or mem_used()).
+func (cfg *Cfg) HasLinkRestrictions() bool {
+	for _, entry := range cfg.Settings {
+		for _, r := range entry.Restrictions {
+			if r.isLinkTime() {
+				return true
+			}
+		}
+	}
+	for _, rslice := range cfg.PackageRestrictions {
+		for _, r := range rslice {
+			if r.isLinkTime() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// DetectLinkViolations evaluates the restrictions that refer to properties of
+// the linked image against the image's memory regions.  It returns a
+// description of each unmet restriction, or "" if they are all met.
+func (cfg *Cfg) DetectLinkViolations(regions []MemRegion) string {
+	for _, region := range regions {
+		cfg.Props[parse.PropKey("mem_size", region.Name)] =
+			strconv.Itoa(region.Size)
+		cfg.Props[parse.PropKey("mem_used", region.Name)] =
+			strconv.Itoa(region.Used)
+	}
+	cfg.linked = true
+
+	settings := cfg.SettingValues()
+
+	var lines []string
+	for _, entry := range cfg.Settings {
+		for _, r := range entry.Restrictions {
+			if r.isLinkTime() && !cfg.restrictionMet(r, settings) {
+				lines = append(lines, cfg.settingViolationText(entry, r))
+			}
+		}
+	}
+	for pkgName, rslice := range cfg.PackageRestrictions {
+		for _, r := range rslice {
+			if r.isLinkTime() && !cfg.restrictionMet(r, settings) {
+				lines = append(lines, cfg.packageViolationText(pkgName, r))
+			}
+		}
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+
+	sort.Strings(lines)
+
+	str := "Memory restriction violations detected:\n"
+	for _, line := range lines {
+		str += "    " + line + "\n"
+	}
+
+	str += "\nMemory regions:\n"
+	for _, region := range regions {
+		str += fmt.Sprintf("    %s: %d of %d bytes used\n",
+			region.Name, region.Used, region.Size)
+	}
+
+	return str
+}
@@ -57,6 +57,7 @@ package syscfg
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
@@ -250,6 +251,100 @@ func (cfg *Cfg) packageViolationText(pkgName string, r CfgRestriction) string {
 	return fmt.Sprintf("Package %s requires: %s", pkgName, r.Expr)
 }
 
+// SettingNames returns the names of the settings that the restriction
+// involves, including the setting it is attached to.
+func (r CfgRestriction) SettingNames() []string {
+	return r.relevantSettingNames()
+}
+
+// Text describes the restriction.
+func (r CfgRestriction) Text() string {
+	switch r.Code {
+	case CFG_RESTRICTION_CODE_NOTNULL:
+		return "must not be null"
+	case CFG_RESTRICTION_CODE_CHOICE:
+		return "must be one of defined choices"
+	case CFG_RESTRICTION_CODE_RANGE:
+		return "must be in range: " + r.Expr
+	default:
+		return "requires: " + r.Expr
+	}
+}
+
+// OwnedRestriction is a restriction and the setting or package that imposes
+// it.
+type OwnedRestriction struct {
+	// The setting that imposes the restriction; empty for a package
+	// restriction.
+	Setting string
+
+	// The package that imposes the restriction.  For a setting restriction,
+	// this is the package that defines the setting.
+	Pkg string
+
+	Restriction CfgRestriction
+}
+
+// RestrictionsInvolving returns the restrictions that involve the specified
+// setting: setting restrictions sorted by setting name, followed by package
+// restrictions sorted by package name.
+func (cfg *Cfg) RestrictionsInvolving(name string) []OwnedRestriction {
+	var ors []OwnedRestriction
+
+	involves := func(r CfgRestriction) bool {
+		for _, n := range r.SettingNames() {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	settingNames := make([]string, 0, len(cfg.Settings))
+	for n, _ := range cfg.Settings {
+		settingNames = append(settingNames, n)
+	}
+	sort.Strings(settingNames)
+
+	for _, n := range settingNames {
+		entry := cfg.Settings[n]
+		for _, r := range entry.Restrictions {
+			if involves(r) {
+				ors = append(ors, OwnedRestriction{
+					Setting:     n,
+					Pkg:         entry.History[0].Name(),
+					Restriction: r,
+				})
+			}
+		}
+	}
+
+	pkgNames := make([]string, 0, len(cfg.PackageRestrictions))
+	for n, _ := range cfg.PackageRestrictions {
+		pkgNames = append(pkgNames, n)
+	}
+	sort.Strings(pkgNames)
+
+	for _, n := range pkgNames {
+		for _, r := range cfg.PackageRestrictions[n] {
+			if involves(r) {
+				ors = append(ors, OwnedRestriction{
+					Pkg:         n,
+					Restriction: r,
+				})
+			}
+		}
+	}
+
+	return ors
+}
+
+// RestrictionMet indicates whether the specified restriction is satisfied by
+// the current settings.
+func (cfg *Cfg) RestrictionMet(r CfgRestriction) bool {
+	return cfg.restrictionMet(r, cfg.SettingValues())
+}
+
 func (r *CfgRestriction) relevantSettingNames() []string {
 	var names []string
 
@@ -259,18 +354,10 @@ func (r *CfgRestriction) relevantSettingNames() []string {
 
 	if r.Code == CFG_RESTRICTION_CODE_EXPR {
 		tokens, _ := parse.Lex(normalizeExpr(r.Expr, r.BaseSetting))
-		for _, token := range tokens {
-			if token.Code == parse.TOKEN_IDENT {
-				names = append(names, token.Text)
-			}
-		}
+		names = append(names, parse.IdentNames(tokens)...)
 	} else if r.Code == CFG_RESTRICTION_CODE_RANGE {
 		tokens, _ := parse.Lex(r.createRangeExpr())
-		for _, token := range tokens {
-			if token.Code == parse.TOKEN_IDENT {
-				names = append(names, token.Text)
-			}
-		}
+		names = append(names, parse.IdentNames(tokens)...)
 	}
 
 	return names
@@ -279,6 +366,12 @@ func (r *CfgRestriction) relevantSettingNames() []string {
 func (cfg *Cfg) restrictionMet(
 	r CfgRestriction, settings map[string]string) bool {
 
+	// Restrictions on the linked image are checked after linking.
+	if !cfg.linked && r.isLinkTime() {
+		return true
+	}
+	settings = cfg.restrictionSettings(r, settings)
+
 	baseEntry := cfg.Settings[r.BaseSetting]
 
 	switch r.Code {
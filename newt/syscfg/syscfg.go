@@ -93,8 +93,13 @@ type CfgEntry struct {
 	Name         string
 	Value        string
 	ValueRefName string
+	DerivedExpr  string
 	Description  string
 	SettingType  CfgSettingType
+	ValueType    CfgValueType
+	ValueMin     *int64
+	ValueMax     *int64
+	ValueFlags   []string
 	Restrictions []CfgRestriction
 	ValidChoices []string
 	PackageDef   *pkg.LocalPackage
@@ -151,6 +156,23 @@ type Cfg struct {
 
 	// Unresolved value references
 	UnresolvedValueRefs map[string]struct{}
+
+	// Values that don't conform to their setting's value type.
+	TypeViolations map[string]CfgTypeViolation
+
+	// Derived settings that could not be calculated
+	// ([setting-name] => reason).
+	DerivedErrors map[string]string
+
+	// Attempted overrides of derived settings.
+	DerivedOverrides map[string][]CfgPoint
+
+	// BSP and link-time properties that restrictions can refer to
+	// ([property-key] => value).
+	Props map[string]string
+
+	// Whether link-time properties have been recorded.
+	linked bool
 }
 
 func NewCfg() Cfg {
@@ -167,6 +189,10 @@ func NewCfg() Cfg {
 		Deprecated:          map[string]struct{}{},
 		Defunct:             map[string]struct{}{},
 		UnresolvedValueRefs: map[string]struct{}{},
+		TypeViolations:      map[string]CfgTypeViolation{},
+		DerivedErrors:       map[string]string{},
+		DerivedOverrides:    map[string][]CfgPoint{},
+		Props:               map[string]string{},
 	}
 }
 
@@ -213,6 +239,7 @@ func (cfg *Cfg) ExpandRef(val string) (string, string, error) {
 }
 
 func (cfg *Cfg) ResolveValueRefs() {
+	settings := cfg.SettingValues()
 	for k, entry := range cfg.Settings {
 		refName, val, err := cfg.ExpandRef(strings.TrimSpace(entry.Value))
 		if err != nil {
@@ -226,8 +253,30 @@ func (cfg *Cfg) ResolveValueRefs() {
 			entry.ValueRefName = refName
 			entry.Value = val
 			cfg.Settings[k] = entry
+			cfg.checkValueType(entry, settings)
+		}
+	}
+}
+
+// ReresolveValues recalculates the settings whose values come from other
+// settings (value references and derived settings).  It is used after
+// settings are changed in an already-resolved configuration.
+func (cfg *Cfg) ReresolveValues() {
+	for k, entry := range cfg.Settings {
+		_, unresolved := cfg.UnresolvedValueRefs[k]
+		if entry.ValueRefName != "" || unresolved {
+			// Restore the unexpanded reference.
+			entry.Value = mostRecentPoint(entry).Value
+			entry.ValueRefName = ""
+			cfg.Settings[k] = entry
 		}
 	}
+
+	cfg.UnresolvedValueRefs = map[string]struct{}{}
+	cfg.DerivedErrors = map[string]string{}
+
+	cfg.ResolveValueRefs()
+	cfg.ResolveDerived()
 }
 
 // If the specified package has any injected settings, returns a new map
@@ -436,10 +485,20 @@ func readSetting(name string, lpkg *pkg.LocalPackage,
 		entry.State = CFG_SETTING_STATE_GOOD
 	}
 
-	// The value field for setting definition is required.
+	// The value field for setting definition is required, unless the setting
+	// is derived from other settings.
 	valueVal, valueExist := vals["value"]
-	if valueExist {
+	_, derivedExist := vals["derived"]
+	if valueExist && derivedExist {
+		return entry, util.FmtNewtError(
+			"setting %s specifies both value and derived fields", name)
+	} else if valueExist {
 		entry.Value = stringValue(valueVal)
+	} else if derivedExist {
+		if err := entry.readDerived(vals); err != nil {
+			return entry,
+				util.PreNewtError(err, "error parsing setting %s", name)
+		}
 	} else {
 		return entry, util.FmtNewtError(
 			"setting %s does not have required value field", name)
@@ -458,6 +517,11 @@ func readSetting(name string, lpkg *pkg.LocalPackage,
 	}
 	entry.appendValue(lpkg, entry.Value)
 
+	if err := entry.readValueType(vals); err != nil {
+		return entry,
+			util.PreNewtError(err, "error parsing setting %s", name)
+	}
+
 	entry.Restrictions = []CfgRestriction{}
 	restrictionStrings := cast.ToStringSlice(vals["restrictions"])
 	for _, rstring := range restrictionStrings {
@@ -640,7 +704,12 @@ func (cfg *Cfg) readValsOnce(lpkg *pkg.LocalPackage,
 		}
 
 		entry, ok := cfg.Settings[k]
-		if ok {
+		if ok && entry.DerivedExpr != "" {
+			cfg.addDerivedOverride(k, CfgPoint{
+				Value:  stringValue(v),
+				Source: lpkg,
+			})
+		} else if ok {
 			entry.appendValue(lpkg, v)
 			cfg.Settings[k] = entry
 		} else {
@@ -708,6 +777,24 @@ func (cfg *Cfg) DeletePkg(lpkg *pkg.LocalPackage) {
 		}
 	}
 
+	// Discard any attempts by the deleted package to override derived
+	// settings.
+	for name, points := range cfg.DerivedOverrides {
+		for i := 0; i < len(points); /* i inc. in loop body */ {
+			if points[i].Source == lpkg {
+				points = append(points[:i], points[i+1:]...)
+			} else {
+				i++
+			}
+		}
+
+		if len(points) == 0 {
+			delete(cfg.DerivedOverrides, name)
+		} else {
+			cfg.DerivedOverrides[name] = points
+		}
+	}
+
 	// Next, delete the specified package from the master settings map.
 	for name, entry := range cfg.Settings {
 		if entry.PackageDef == lpkg {
@@ -717,6 +804,10 @@ func (cfg *Cfg) DeletePkg(lpkg *pkg.LocalPackage) {
 				p := entry.History[i]
 				cfg.addOrphan(name, stringValue(p.Value), p.Source)
 			}
+			for _, p := range cfg.DerivedOverrides[name] {
+				cfg.addOrphan(name, p.Value, p.Source)
+			}
+			delete(cfg.DerivedOverrides, name)
 			delete(cfg.Settings, name)
 		} else {
 			// Remove any overrides created by the deleted package.
@@ -914,8 +1005,9 @@ func (cfg *Cfg) ErrorText() string {
 			historyMap[settingName] = baseEntry.History
 			for _, r := range rslice {
 				for _, name := range r.relevantSettingNames() {
-					reqEntry := cfg.Settings[name]
-					historyMap[name] = reqEntry.History
+					if reqEntry, ok := cfg.Settings[name]; ok {
+						historyMap[name] = reqEntry.History
+					}
 				}
 				str += "    " + cfg.settingViolationText(baseEntry, r) + "\n"
 			}
@@ -923,8 +1015,9 @@ func (cfg *Cfg) ErrorText() string {
 		for pkgName, rslice := range cfg.PackageViolations {
 			for _, r := range rslice {
 				for _, name := range r.relevantSettingNames() {
-					reqEntry := cfg.Settings[name]
-					historyMap[name] = reqEntry.History
+					if reqEntry, ok := cfg.Settings[name]; ok {
+						historyMap[name] = reqEntry.History
+					}
 				}
 				str += "    " + cfg.packageViolationText(pkgName, r) + "\n"
 			}
@@ -986,6 +1079,26 @@ func (cfg *Cfg) ErrorText() string {
 		}
 	}
 
+	// Value type violations.
+	if len(cfg.TypeViolations) > 0 {
+		str += "Syscfg value type violations detected:\n"
+
+		settingNames := make([]string, 0, len(cfg.TypeViolations))
+		for k, _ := range cfg.TypeViolations {
+			settingNames = append(settingNames, k)
+		}
+		sort.Strings(settingNames)
+
+		for _, name := range settingNames {
+			historyMap[name] = cfg.Settings[name].History
+			str += "    " + cfg.typeViolationText(cfg.TypeViolations[name]) +
+				"\n"
+		}
+	}
+
+	// Derived setting errors.
+	str += cfg.derivedErrorText(historyMap)
+
 	// Unresolved value references
 	if len(cfg.UnresolvedValueRefs) > 0 {
 		str += "Unresolved value references:\n"
@@ -1069,6 +1182,22 @@ func normalizePkgType(typ interfaces.PackageType) interfaces.PackageType {
 	}
 }
 
+// The package priorities, lowest first.  A setting can only be overridden by a
+// package with a higher priority than the setting's definer.
+var PriorityOrder = []interfaces.PackageType{
+	pkg.PACKAGE_TYPE_LIB,
+	pkg.PACKAGE_TYPE_BSP,
+	pkg.PACKAGE_TYPE_UNITTEST,
+	pkg.PACKAGE_TYPE_APP,
+	pkg.PACKAGE_TYPE_TARGET,
+}
+
+// PkgPriority determines the syscfg priority of a package (one of the
+// PriorityOrder types).
+func PkgPriority(lpkg *pkg.LocalPackage) interfaces.PackageType {
+	return normalizePkgType(lpkg.Type())
+}
+
 func categorizePkgs(
 	lpkgs []*pkg.LocalPackage) map[interfaces.PackageType][]*pkg.LocalPackage {
 
@@ -1123,8 +1252,10 @@ func (cfg *Cfg) detectAmbiguities() {
 }
 
 // Detects and records errors in the build's syscfg.  This should only be
-// called after APIs are resolved to avoid false positives.
-func (cfg *Cfg) DetectErrors(flashMap flashmap.FlashMap) {
+// called after APIs are resolved to avoid false positives.  Restrictions that
+// refer to the linked image are not evaluated; see DetectLinkViolations().
+func (cfg *Cfg) DetectErrors(flashMap flashmap.FlashMap, ramSize int) {
+	cfg.setBspProps(flashMap, ramSize)
 	cfg.detectAmbiguities()
 	cfg.detectViolations()
 	cfg.detectPriorityViolations()
@@ -1161,25 +1292,13 @@ func Read(lpkgs []*pkg.LocalPackage, apis []string,
 
 	lpkgMap := categorizePkgs(lpkgs)
 
-	for _, ptype := range []interfaces.PackageType{
-		pkg.PACKAGE_TYPE_LIB,
-		pkg.PACKAGE_TYPE_BSP,
-		pkg.PACKAGE_TYPE_UNITTEST,
-		pkg.PACKAGE_TYPE_APP,
-		pkg.PACKAGE_TYPE_TARGET,
-	} {
+	for _, ptype := range PriorityOrder {
 		if err := cfg.readDefsForPkgType(lpkgMap[ptype], settings); err != nil {
 			return cfg, err
 		}
 	}
 
-	for _, ptype := range []interfaces.PackageType{
-		pkg.PACKAGE_TYPE_LIB,
-		pkg.PACKAGE_TYPE_BSP,
-		pkg.PACKAGE_TYPE_UNITTEST,
-		pkg.PACKAGE_TYPE_APP,
-		pkg.PACKAGE_TYPE_TARGET,
-	} {
+	for _, ptype := range PriorityOrder {
 		if err := cfg.readValsForPkgType(lpkgMap[ptype], settings); err != nil {
 			return cfg, err
 		}
@@ -1191,6 +1310,8 @@ func Read(lpkgs []*pkg.LocalPackage, apis []string,
 		}
 	}
 
+	cfg.detectTypeViolations()
+
 	return cfg, nil
 }
 
@@ -1356,6 +1477,8 @@ func writeSettingsOnePkg(cfg Cfg, pkgName string, pkgEntries []CfgEntry,
 
 	fmt.Fprintf(w, "/*** %s */\n", pkgName)
 
+	settings := cfg.SettingValues()
+
 	first := true
 	for _, n := range names {
 		entry := cfg.Settings[n]
@@ -1368,6 +1491,13 @@ func writeSettingsOnePkg(cfg Cfg, pkgName string, pkgEntries []CfgEntry,
 		writeComment(entry, w)
 		if entry.ValidChoices != nil {
 			writeChoiceDefine(settingName(n), entry.Value, entry.ValidChoices, w)
+		} else if entry.ValueType != CFG_VALUE_TYPE_NONE {
+			// Type violations are reported before the header is written.
+			val, err := entry.CValue(settings)
+			if err != nil {
+				val = entry.Value
+			}
+			writeDefine(settingName(n), val, w)
 		} else {
 			writeDefine(settingName(n), entry.Value, w)
 		}
@@ -0,0 +1,411 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package syscfg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"github.com/dachalco/mynewt-newt/newt/parse"
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// The type of a setting's value, as specified by the `value_type` field of
+// its definition.  Settings without a value type are untyped; their values are
+// written to syscfg.h verbatim.
+type CfgValueType int
+
+const (
+	CFG_VALUE_TYPE_NONE CfgValueType = iota
+	CFG_VALUE_TYPE_INT
+	CFG_VALUE_TYPE_BOOL
+	CFG_VALUE_TYPE_STRING
+	CFG_VALUE_TYPE_CHOICE
+	CFG_VALUE_TYPE_BITMASK
+	CFG_VALUE_TYPE_ADDR
+	CFG_VALUE_TYPE_SIZE
+)
+
+// A setting value that does not conform to the setting's value type.
+type CfgTypeViolation struct {
+	SettingName string
+
+	// The history point that supplied the offending value.
+	Point CfgPoint
+
+	Text string
+}
+
+// Indicates whether the specified value type accepts the `min` and `max`
+// fields.
+func (t CfgValueType) hasLimits() bool {
+	return t == CFG_VALUE_TYPE_INT ||
+		t == CFG_VALUE_TYPE_ADDR ||
+		t == CFG_VALUE_TYPE_SIZE
+}
+
+var sizeSuffixes = map[string]int64{
+	"K": 1024,
+	"M": 1024 * 1024,
+}
+
+// parseIntLit parses an integer literal in base-10 or base-16.  As with
+// util.AtoiNoOct, a leading zero does not imply octal.
+func parseIntLit(s string) (int64, bool) {
+	s = strings.TrimSpace(s)
+	for strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+
+	neg := strings.HasPrefix(s, "-")
+	if neg {
+		s = s[1:]
+	}
+
+	var u uint64
+	var err error
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		u, err = strconv.ParseUint(s[2:], 16, 64)
+	} else {
+		u, err = strconv.ParseUint(s, 10, 64)
+	}
+	if err != nil {
+		return 0, false
+	}
+
+	if neg {
+		return -int64(u), true
+	}
+	return int64(u), true
+}
+
+// parseInt parses an integer setting value.  The value is either a literal or
+// an expression involving other settings.
+func parseInt(s string, settings map[string]string) (int64, error) {
+	if i, ok := parseIntLit(s); ok {
+		return i, nil
+	}
+
+	expr, err := parse.LexAndParse(s)
+	if err != nil || expr == nil {
+		return 0, util.FmtNewtError("\"%s\" is not an integer", s)
+	}
+
+	i, err := parse.EvalInt(expr, settings)
+	if err != nil {
+		return 0, util.FmtNewtError("\"%s\" is not an integer", s)
+	}
+
+	return int64(i), nil
+}
+
+// parseSize parses a size value: an integer, optionally followed by a K or M
+// suffix (e.g., "16K").
+func parseSize(s string, settings map[string]string) (int64, error) {
+	s = strings.TrimSpace(s)
+	for suffix, mult := range sizeSuffixes {
+		if strings.HasSuffix(strings.ToUpper(s), suffix) {
+			i, ok := parseIntLit(s[:len(s)-len(suffix)])
+			if !ok {
+				return 0, util.FmtNewtError("\"%s\" is not a size", s)
+			}
+			return i * mult, nil
+		}
+	}
+
+	i, err := parseInt(s, settings)
+	if err != nil {
+		return 0, util.FmtNewtError("\"%s\" is not a size", s)
+	}
+	return i, nil
+}
+
+// parseBool parses a boolean setting value.
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "1", "true", "yes", "on":
+		return true, nil
+	case "0", "false", "no", "off":
+		return false, nil
+	default:
+		return false, util.FmtNewtError("\"%s\" is not a boolean", s)
+	}
+}
+
+// parseBitmask parses a bitmask value.  The value is either an integer or, if
+// the setting defines flag names, a list of flags separated by '|'.
+func (entry *CfgEntry) parseBitmask(s string,
+	settings map[string]string) (uint64, error) {
+
+	var mask uint64
+
+	if i, err := parseInt(s, settings); err == nil {
+		if i < 0 {
+			return 0, util.FmtNewtError("bitmask \"%s\" is negative", s)
+		}
+		mask = uint64(i)
+	} else {
+		if len(entry.ValueFlags) == 0 {
+			return 0, util.FmtNewtError("\"%s\" is not a bitmask", s)
+		}
+
+		for _, name := range strings.Split(s, "|") {
+			name = strings.TrimSpace(name)
+			bit := -1
+			for i, flag := range entry.ValueFlags {
+				if strings.EqualFold(flag, name) {
+					bit = i
+					break
+				}
+			}
+			if bit < 0 {
+				return 0, util.FmtNewtError(
+					"\"%s\" is not a valid flag; must be one of %v",
+					name, entry.ValueFlags)
+			}
+			mask |= 1 << uint(bit)
+		}
+	}
+
+	if len(entry.ValueFlags) > 0 && mask>>uint(len(entry.ValueFlags)) != 0 {
+		return 0, util.FmtNewtError(
+			"bitmask 0x%x sets undefined bits; %d flags defined",
+			mask, len(entry.ValueFlags))
+	}
+
+	return mask, nil
+}
+
+// checkLimits ensures an integer value is within the setting's min and max.
+func (entry *CfgEntry) checkLimits(i int64) error {
+	if entry.ValueMin != nil && i < *entry.ValueMin {
+		return util.FmtNewtError("value %d is less than minimum %d",
+			i, *entry.ValueMin)
+	}
+	if entry.ValueMax != nil && i > *entry.ValueMax {
+		return util.FmtNewtError("value %d is greater than maximum %d",
+			i, *entry.ValueMax)
+	}
+
+	return nil
+}
+
+// quoteCString converts a string to a C string literal.  A value that is
+// already a string literal is left alone.
+func quoteCString(s string) string {
+	if len(s) >= 2 && strings.HasPrefix(s, "\"") && strings.HasSuffix(s, "\"") {
+		return s
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c == '\n':
+			sb.WriteString("\\n")
+		case c == '\t':
+			sb.WriteString("\\t")
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&sb, "\\%03o", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+
+	return sb.String()
+}
+
+// CValue converts the setting's value to the C text written to syscfg.h.  For
+// untyped settings, this is the raw value.  An error is returned if the value
+// does not conform to the setting's value type.
+func (entry *CfgEntry) CValue(settings map[string]string) (string, error) {
+	val := strings.TrimSpace(entry.Value)
+
+	// An empty value leaves the setting undefined, regardless of type.
+	if val == "" {
+		return "", nil
+	}
+
+	switch entry.ValueType {
+	case CFG_VALUE_TYPE_INT:
+		i, err := parseInt(val, settings)
+		if err != nil {
+			return "", err
+		}
+		if err := entry.checkLimits(i); err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(i, 10), nil
+
+	case CFG_VALUE_TYPE_BOOL:
+		b, err := parseBool(val)
+		if err != nil {
+			return "", err
+		}
+		if b {
+			return "1", nil
+		}
+		return "0", nil
+
+	case CFG_VALUE_TYPE_STRING:
+		return quoteCString(val), nil
+
+	case CFG_VALUE_TYPE_CHOICE:
+		for _, choice := range entry.ValidChoices {
+			if strings.EqualFold(choice, val) {
+				return val, nil
+			}
+		}
+		return "", util.FmtNewtError("\"%s\" is not a valid choice; "+
+			"must be one of %v", val, entry.ValidChoices)
+
+	case CFG_VALUE_TYPE_BITMASK:
+		mask, err := entry.parseBitmask(val, settings)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("0x%x", mask), nil
+
+	case CFG_VALUE_TYPE_ADDR:
+		i, err := parseInt(val, settings)
+		if err != nil {
+			return "", util.FmtNewtError("\"%s\" is not an address", val)
+		}
+		if i < 0 {
+			return "", util.FmtNewtError("address \"%s\" is negative", val)
+		}
+		if err := entry.checkLimits(i); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("0x%x", i), nil
+
+	case CFG_VALUE_TYPE_SIZE:
+		i, err := parseSize(val, settings)
+		if err != nil {
+			return "", err
+		}
+		if err := entry.checkLimits(i); err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(i, 10), nil
+
+	default:
+		return entry.Value, nil
+	}
+}
+
+// readValueType parses the `value_type` field of a setting definition, along
+// with the type-specific `min`, `max`, and `flags` fields.
+func (entry *CfgEntry) readValueType(vals map[interface{}]interface{}) error {
+	typename := stringValue(vals["value_type"])
+	vt, ok := cfgValueTypeNameMap[typename]
+	if !ok {
+		return util.FmtNewtError("invalid value_type: %s", typename)
+	}
+	entry.ValueType = vt
+
+	readLimit := func(key string) (*int64, error) {
+		if vals[key] == nil {
+			return nil, nil
+		}
+		if !vt.hasLimits() {
+			return nil, util.FmtNewtError(
+				"%s is not allowed with value_type %s", key, vt.String())
+		}
+
+		s := stringValue(vals[key])
+		i, err := parseSize(s, nil)
+		if err != nil {
+			return nil, util.FmtNewtError("invalid %s: %s", key, s)
+		}
+		return &i, nil
+	}
+
+	var err error
+	if entry.ValueMin, err = readLimit("min"); err != nil {
+		return err
+	}
+	if entry.ValueMax, err = readLimit("max"); err != nil {
+		return err
+	}
+
+	if vals["flags"] != nil {
+		if vt != CFG_VALUE_TYPE_BITMASK {
+			return util.FmtNewtError(
+				"flags is only allowed with value_type bitmask")
+		}
+		entry.ValueFlags = cast.ToStringSlice(vals["flags"])
+		if len(entry.ValueFlags) > 64 {
+			return util.FmtNewtError("too many flags (%d > 64)",
+				len(entry.ValueFlags))
+		}
+	}
+
+	if vt == CFG_VALUE_TYPE_CHOICE && vals["choices"] == nil {
+		return util.FmtNewtError("value_type choice requires choices")
+	}
+
+	return nil
+}
+
+// checkValueType records a type violation if the setting's value does not
+// conform to its value type.  Values that reference other settings are
+// checked once the reference is resolved.  Choice values are checked by the
+// setting's choice restriction.
+func (cfg *Cfg) checkValueType(entry CfgEntry, settings map[string]string) {
+	delete(cfg.TypeViolations, entry.Name)
+
+	if entry.ValueType == CFG_VALUE_TYPE_NONE ||
+		entry.ValueType == CFG_VALUE_TYPE_CHOICE ||
+		ResolveValueRefName(entry.Value) != "" {
+
+		return
+	}
+
+	if _, err := entry.CValue(settings); err != nil {
+		cfg.TypeViolations[entry.Name] = CfgTypeViolation{
+			SettingName: entry.Name,
+			Point:       mostRecentPoint(entry),
+			Text:        err.Error(),
+		}
+	}
+}
+
+func (cfg *Cfg) detectTypeViolations() {
+	settings := cfg.SettingValues()
+	for _, entry := range cfg.Settings {
+		cfg.checkValueType(entry, settings)
+	}
+}
+
+func (cfg *Cfg) typeViolationText(v CfgTypeViolation) string {
+	entry := cfg.Settings[v.SettingName]
+	return fmt.Sprintf("Setting: %s, Type: %s, Value: %s, Package: %s: %s",
+		v.SettingName, entry.ValueType.String(), v.Point.Value,
+		v.Point.Name(), v.Text)
+}
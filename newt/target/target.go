@@ -21,7 +21,6 @@ package target
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 	"strconv"
 
@@ -51,6 +50,9 @@ type Target struct {
 	KeyFile      string
 	PkgProfiles  map[string]string
 
+	// Overrides the project's license allow-list if non-nil.
+	LicenseAllow []string
+
 	// target.yml configuration structure
 	TargetY ycfg.YCfg
 }
@@ -130,6 +132,10 @@ func (target *Target) Load(basePkg *pkg.LocalPackage) error {
 		"target.package_profiles", nil)
 	util.OneTimeWarningError(err)
 
+	target.LicenseAllow, err = yc.GetValStringSlice(
+		"target.license_allow", nil)
+	util.OneTimeWarningError(err)
+
 	// Note: App not required in the case of unit tests.
 
 	// Remember the name of the configuration file so that it can be specified
@@ -287,14 +293,11 @@ func (t *Target) Save() error {
 		return err
 	}
 
-	file, err := os.Create(t.TargetYamlPath())
-	if err != nil {
-		return util.NewNewtError(err.Error())
-	}
-	defer file.Close()
+	if err := config.SaveFile(t.TargetYamlPath(), t.TargetY.AllSettings(),
+		nil); err != nil {
 
-	s := t.TargetY.YAML()
-	file.WriteString(s)
+		return err
+	}
 
 	if err := t.basePkg.SaveSyscfg(); err != nil {
 		return err
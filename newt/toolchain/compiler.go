@@ -35,7 +35,9 @@ import (
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/dachalco/mynewt-newt/newt/cache"
 	"github.com/dachalco/mynewt-newt/newt/config"
+	"github.com/dachalco/mynewt-newt/newt/newtutil"
 	"github.com/dachalco/mynewt-newt/newt/project"
 	"github.com/dachalco/mynewt-newt/newt/symbol"
 	"github.com/dachalco/mynewt-newt/newt/ycfg"
@@ -72,7 +74,8 @@ type Compiler struct {
 	LinkerScripts []string
 
 	// Needs to be locked whenever a mutable field in this struct is accessed
-	// during a build.  Currently, objPathList is the only such member.
+	// during a build.  This applies to objPathList, compileCommands, and the
+	// dependency tracker's most-recent timestamp.
 	mutex *sync.Mutex
 
 	depTracker            DepTracker
@@ -90,6 +93,10 @@ type Compiler struct {
 	srcDir                string
 	dstDir                string
 
+	// The directory containing the target's build outputs (e.g., generated
+	// headers).  Used to make compile cache keys independent of the target.
+	targetBinDir string
+
 	// The info to be applied during compilation.
 	info CompilerInfo
 
@@ -359,6 +366,12 @@ func (c *Compiler) DstDir() string {
 	return c.dstDir
 }
 
+// SetTargetBinDir specifies the directory containing the target's build
+// outputs.
+func (c *Compiler) SetTargetBinDir(dir string) {
+	c.targetBinDir = filepath.ToSlash(filepath.Clean(dir))
+}
+
 func (c *Compiler) SetSrcDir(srcDir string) {
 	c.srcDir = filepath.ToSlash(filepath.Clean(srcDir))
 }
@@ -383,7 +396,9 @@ func (c *Compiler) SkipSourceFile(srcFile string) error {
 	// Update the dependency tracker with the object file's modification time.
 	// This is necessary later for determining if the library / executable
 	// needs to be rebuilt.
+	c.mutex.Lock()
 	err := c.depTracker.ProcessFileTime(objPath)
+	c.mutex.Unlock()
 	if err != nil {
 		return err
 	}
@@ -487,6 +502,72 @@ func (c *Compiler) CompileFileCmd(file string, compilerType int) (
 	return cmd, nil
 }
 
+// Calculates the command-line invocation necessary to run the preprocessor on
+// a source file.  The preprocessed output is written to stdout.
+//
+// @param compileCmd            The compile command, as returned by
+//                                  CompileFileCmd().
+//
+// @return                      The preprocessor command arguments.
+func preprocessCmd(compileCmd []string) []string {
+	// Replace the trailing "-c -o <obj> <src>" tokens with "-E <src>".
+	n := len(compileCmd)
+	cmd := append([]string{}, compileCmd[:n-4]...)
+	return append(cmd, "-E", compileCmd[n-1])
+}
+
+// Creates a replacer that maps the target's output directory and the project
+// root to fixed tokens.  Applied to cache key inputs so that the keys do not
+// depend on the target being built or on the location of the checkout.
+func (c *Compiler) cacheKeyReplacer() *strings.Replacer {
+	pairs := []string{}
+	if c.targetBinDir != "" {
+		pairs = append(pairs, c.targetBinDir, "<target-bin>")
+	}
+	pairs = append(pairs, c.baseDir, "<project>")
+
+	return strings.NewReplacer(pairs...)
+}
+
+// Calculates the compile cache key for a source file.  The key covers the
+// preprocessed translation unit and the compiler command line minus the
+// output path and the include paths, so identical objects produced for
+// different targets or in different checkouts share a cache entry.  The
+// include paths are omitted because their effect is captured by the
+// preprocessed text; paths in the text and in the remaining flags are
+// rewritten with cacheKeyReplacer().
+//
+// The preprocessor output is retained in the job so that the executor can
+// reuse it.
+//
+// @param job                   The compile job.
+func (c *Compiler) cacheKey(job *ExecJob) (string, error) {
+	pp, _, err := job.Preprocess()
+	if err != nil {
+		return "", err
+	}
+
+	rep := c.cacheKeyReplacer()
+
+	compileCmd := job.Cmd
+	n := len(compileCmd)
+	keyCmd := []string{}
+	for i := 0; i < n-4; i++ {
+		arg := compileCmd[i]
+		switch {
+		case arg == "-I" || arg == "-iquote":
+			// The path is the next argument.
+			i++
+		case strings.HasPrefix(arg, "-I") || strings.HasPrefix(arg, "-iquote"):
+		default:
+			keyCmd = append(keyCmd, rep.Replace(arg))
+		}
+	}
+	keyCmd = append(keyCmd, "-c", rep.Replace(compileCmd[n-1]))
+
+	return cache.Key([]byte(rep.Replace(string(pp))), keyCmd), nil
+}
+
 // Generates a dependency Makefile (.d) for the specified source file.
 //
 // @param file                  The name of the source file.
@@ -528,6 +609,16 @@ func (c *Compiler) GenDepsForFile(file string, compilerType int) error {
 		return err
 	}
 
+	return c.writeDepsFile(file, o)
+}
+
+// Writes the dependency Makefile (.d) for the specified source file.
+//
+// @param file                  The name of the source file.
+// @param deps                  The dependency rule generated by the compiler.
+func (c *Compiler) writeDepsFile(file string, deps []byte) error {
+	depPath := c.dstFilePath(file) + ".d"
+
 	// Write the compiler output to a dependency file.
 	f, err := os.OpenFile(depPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 	if err != nil {
@@ -535,7 +626,7 @@ func (c *Compiler) GenDepsForFile(file string, compilerType int) error {
 	}
 	defer f.Close()
 
-	if _, err := f.Write(o); err != nil {
+	if _, err := f.Write(deps); err != nil {
 		return util.ChildNewtError(err)
 	}
 
@@ -615,17 +706,55 @@ func (c *Compiler) CompileFile(file string, compilerType int) error {
 		return util.NewNewtError("Unknown compiler type")
 	}
 
-	o, err := util.ShellCommand(cmd, nil)
-	if err != nil {
-		return err
+	// Consult the compile cache before invoking the compiler.  Assembly files
+	// are not preprocessed, so they are always built from scratch.
+	job := ExecJob{
+		Cmd:          cmd,
+		CompilerType: compilerType,
+		ObjPath:      objPath,
 	}
-	util.StatusMessage(util.VERBOSITY_DEFAULT, "%s", string(o))
 
+	cacheKey := ""
+	if cache.Enabled() && compilerType != COMPILER_TYPE_ASM {
+		cacheKey, err = c.cacheKey(&job)
+		if err != nil {
+			log.Debugf("Not using compile cache for %s: %s", srcPath,
+				err.Error())
+			cacheKey = ""
+		}
+	}
+
+	if cacheKey != "" && cache.Fetch(cacheKey, objPath) {
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Using cached object for %s\n", srcPath)
+	} else {
+		res, err := CurExecutor().Compile(job)
+		if err != nil {
+			return err
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s", string(res.Output))
+
+		if res.Deps != nil {
+			if err := c.writeDepsFile(file, res.Deps); err != nil {
+				return err
+			}
+		}
+
+		if cacheKey != "" {
+			if err := cache.Store(cacheKey, objPath); err != nil {
+				log.Warnf("Failed to add %s to compile cache: %s", objPath,
+					err.Error())
+			}
+		}
+	}
+
+	c.mutex.Lock()
 	c.compileCommands = append(c.compileCommands,
 		CompileCommand{
 			Command: strings.Join(cmd, " "),
 			File:    file,
 		})
+	c.mutex.Unlock()
 
 	err = writeCommandFile(objPath, cmd)
 	if err != nil {
@@ -633,7 +762,9 @@ func (c *Compiler) CompileFile(file string, compilerType int) error {
 	}
 
 	// Tell the dependency tracker that an object file was just rebuilt.
+	c.mutex.Lock()
 	c.depTracker.SetMostRecent(objPath, time.Now())
+	c.mutex.Unlock()
 
 	return nil
 }
@@ -1175,9 +1306,17 @@ func (c *Compiler) CopySymbolsCmd(infile string, outfile string, sm *symbol.Symb
 func (c *Compiler) CompileArchiveCmd(archiveFile string,
 	objFiles []string) []string {
 
+	// In reproducible mode, use deterministic mode: zero timestamps, owner
+	// IDs, and file modes in the archive.  Members are always added in sorted
+	// order.
+	ops := "rcs"
+	if newtutil.NewtReproducible {
+		ops += "D"
+	}
+
 	cmd := []string{
 		c.arPath,
-		"rcs",
+		ops,
 		archiveFile,
 	}
 	cmd = append(cmd, c.getObjFiles(objFiles)...)
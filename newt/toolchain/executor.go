@@ -0,0 +1,142 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package toolchain
+
+import (
+	"bytes"
+	"os/exec"
+	"sync"
+
+	"github.com/dachalco/mynewt-newt/util"
+)
+
+// ExecJob describes a single source file compilation.
+type ExecJob struct {
+	// The full compile command, as returned by CompileFileCmd().  The command
+	// ends with "-c -o <obj> <src>".
+	Cmd []string
+
+	// One of the COMPILER_TYPE_[...] constants.
+	CompilerType int
+
+	// The object file that the command produces.
+	ObjPath string
+
+	// The preprocessed source and the preprocessor's diagnostics, if the
+	// preprocessor has already been run (e.g., to calculate the compile cache
+	// key).  Nil if it has not.
+	Preprocessed     []byte
+	PreprocessOutput []byte
+}
+
+// ExecResult is the outcome of a successful compilation.
+type ExecResult struct {
+	// Compiler output (e.g., warnings).
+	Output []byte
+
+	// Makefile dependency rule for the object file.  If nil, the dependency
+	// file generated by the dependency tracker is kept as is.
+	Deps []byte
+}
+
+// An Executor runs compile commands on behalf of a Compiler.  The executor is
+// responsible for leaving the object file at the job's object path.
+type Executor interface {
+	Compile(job ExecJob) (ExecResult, error)
+}
+
+// LocalExecutor runs compile commands on the local host.
+type LocalExecutor struct{}
+
+func (e LocalExecutor) Compile(job ExecJob) (ExecResult, error) {
+	o, err := util.ShellCommand(job.Cmd, nil)
+	if err != nil {
+		return ExecResult{}, err
+	}
+
+	return ExecResult{Output: o}, nil
+}
+
+var executorMtx sync.Mutex
+var executor Executor = LocalExecutor{}
+
+// SetExecutor changes the executor used for all subsequent compilations.
+func SetExecutor(e Executor) {
+	executorMtx.Lock()
+	defer executorMtx.Unlock()
+
+	executor = e
+}
+
+// CurExecutor retrieves the executor used for compilations.
+func CurExecutor() Executor {
+	executorMtx.Lock()
+	defer executorMtx.Unlock()
+
+	return executor
+}
+
+// PreprocessCmd calculates the command-line invocation necessary to run the
+// preprocessor on the job's source file.  The preprocessed output is written
+// to stdout.
+func (job *ExecJob) PreprocessCmd() []string {
+	return preprocessCmd(job.Cmd)
+}
+
+// Preprocess runs the preprocessor on the job's source file, or reuses the
+// output of an earlier run.  Only the preprocessor's stdout is captured; the
+// diagnostics are returned separately.
+func (job *ExecJob) Preprocess() ([]byte, []byte, error) {
+	if job.Preprocessed != nil {
+		return job.Preprocessed, job.PreprocessOutput, nil
+	}
+
+	cmdStrs := job.PreprocessCmd()
+	util.LogShellCmd(cmdStrs, nil)
+
+	stderr := &bytes.Buffer{}
+	cmd := exec.Command(cmdStrs[0], cmdStrs[1:]...)
+	cmd.Stderr = stderr
+
+	o, err := cmd.Output()
+	if err != nil {
+		nerr := util.ChildNewtError(err)
+		if stderr.Len() > 0 {
+			nerr.Text = stderr.String()
+		}
+		return nil, stderr.Bytes(), nerr
+	}
+
+	job.Preprocessed = o
+	job.PreprocessOutput = stderr.Bytes()
+
+	return o, job.PreprocessOutput, nil
+}
+
+// SrcPath retrieves the path of the source file being compiled.
+func (job *ExecJob) SrcPath() string {
+	return job.Cmd[len(job.Cmd)-1]
+}
+
+// BaseCmd retrieves the compile command without the trailing
+// "-c -o <obj> <src>" tokens.
+func (job *ExecJob) BaseCmd() []string {
+	return append([]string{}, job.Cmd[:len(job.Cmd)-4]...)
+}
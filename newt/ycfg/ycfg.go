@@ -21,6 +21,7 @@ package ycfg
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/spf13/cast"
@@ -325,6 +326,49 @@ func (yc *YCfg) Get(key string,
 	}
 }
 
+// GetAll retrieves all nodes with the specified key, regardless of whether
+// their conditionals are satisfied.  Unconditional entries have a nil Expr.
+// The returned error is a set of warnings just as in `Get`.
+func (yc *YCfg) GetAll(key string) ([]YCfgEntry, error) {
+	node := yc.find(key)
+	if node == nil {
+		return nil, nil
+	}
+
+	entries := []YCfgEntry{}
+
+	if node.Value != nil {
+		entries = append(entries, YCfgEntry{Value: node.Value})
+	}
+
+	names := make([]string, 0, len(node.Children))
+	for name, _ := range node.Children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errLines []string
+	for _, name := range names {
+		expr, err := parse.LexAndParse(name)
+		if err != nil {
+			errLines = append(errLines,
+				fmt.Sprintf("%s: %s", yc.name, err.Error()))
+			continue
+		}
+
+		entries = append(entries, YCfgEntry{
+			Value: node.Children[name].Value,
+			Expr:  expr,
+		})
+	}
+
+	if len(errLines) > 0 {
+		return entries, util.NewNewtError(strings.Join(errLines, "\n"))
+	} else {
+		return entries, nil
+	}
+}
+
 // GetSlice retrieves all entries with the specified key and coerces their
 // values to type []interface{}.  The returned []YCfgEntry is formed from the
 // union of all these slices.  The returned error is a set of warnings just as
@@ -672,6 +716,25 @@ func (yc *YCfg) Traverse(cb func(node *YCfgNode, depth int)) {
 	}
 }
 
+// ConditionalKeys returns the nodes whose names are syscfg conditions, sorted
+// by full name.  Keys consist of two elements (e.g., "pkg.cflags"); any
+// further elements are conditions.
+func (yc *YCfg) ConditionalKeys() []*YCfgNode {
+	var nodes []*YCfgNode
+
+	yc.Traverse(func(node *YCfgNode, depth int) {
+		if node.Parent != nil && node.Parent.Parent != nil {
+			nodes = append(nodes, node)
+		}
+	})
+
+	sort.Slice(nodes, func(i int, j int) bool {
+		return nodes[i].FullName() < nodes[j].FullName()
+	})
+
+	return nodes
+}
+
 // AllSettings converts the YCfg into a map with the following form:
 //     <node-full-name>: <node-value>
 func (yc *YCfg) AllSettings() map[string]interface{} {
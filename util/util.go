@@ -48,6 +48,10 @@ var ExecuteShell bool
 var EscapeShellCmds bool
 var logFile *os.File
 
+// Destination of status messages and of the output of interactive child
+// processes.
+var stdout *os.File = os.Stdout
+
 func ParseEqualsPair(v string) (string, string, error) {
 	s := strings.Split(v, "=")
 	return s[0], s[1], nil
@@ -130,9 +134,21 @@ func WriteMessage(f *os.File, level int, message string,
 	}
 }
 
+// SetStdout redirects status messages and the output of interactive child
+// processes to the specified file.  It does not affect other writes to
+// os.Stdout.
+func SetStdout(f *os.File) {
+	stdout = f
+}
+
+// Stdout retrieves the destination of status messages.
+func Stdout() *os.File {
+	return stdout
+}
+
 // Print Silent, Quiet and Verbose aware status messages to stdout.
 func StatusMessage(level int, message string, args ...interface{}) {
-	WriteMessage(os.Stdout, level, message, args...)
+	WriteMessage(stdout, level, message, args...)
 }
 
 // Print Silent, Quiet and Verbose aware status messages to stderr.
@@ -483,7 +499,7 @@ func ShellInteractiveCommand(cmdStr []string, env map[string]string,
 	// and set the additional environment variables
 	pa := os.ProcAttr{
 		Env:   envSlice,
-		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+		Files: []*os.File{os.Stdin, stdout, os.Stderr},
 	}
 
 	// Start up a new shell.
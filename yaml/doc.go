@@ -0,0 +1,784 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package yaml
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// This file implements a YAML document model that supports surgical edits.
+// A document retains its source text; each edit splices the text of the
+// affected key only, so comments, key order, and unrelated keys survive
+// untouched.  After every edit the document is reparsed, so any node pointers
+// obtained before an edit are invalidated by it.
+//
+// Flow collections (e.g., `[a, b]` or `{a: 1}`) are treated as atomic: an
+// edit inside one rewrites the entire collection in block style.
+
+type DocNodeKind int
+
+const (
+	DOC_NODE_SCALAR DocNodeKind = iota
+	DOC_NODE_MAPPING
+	DOC_NODE_SEQUENCE
+)
+
+// DocNode is a single node in a YAML document.
+type DocNode struct {
+	Kind DocNodeKind
+
+	// Scalar text (DOC_NODE_SCALAR only).
+	Value string
+
+	// Mapping keys and values (DOC_NODE_MAPPING only).  Keys are always
+	// scalars.
+	Keys []*DocNode
+	Vals []*DocNode
+
+	// Sequence elements (DOC_NODE_SEQUENCE only).
+	Items []*DocNode
+
+	// Whether this is a flow collection.
+	Flow bool
+
+	// Whether this is a plain (unquoted, non-block) scalar.
+	Plain bool
+
+	// Zero-based position of the start of the node.
+	Line   int
+	Column int
+
+	// Byte offsets of the node's text within the document.  A block
+	// collection ends where its last descendant ends.
+	start int
+	end   int
+}
+
+// Document is a YAML document that can be edited in place.
+type Document struct {
+	src  []byte
+	root *DocNode
+}
+
+type docParser struct {
+	parser yaml_parser_t
+
+	// Maps the parser's character indices to byte offsets.
+	offs []int
+}
+
+func (dp *docParser) off(mark yaml_mark_t) int {
+	if mark.index >= len(dp.offs) {
+		return dp.offs[len(dp.offs)-1]
+	}
+	return dp.offs[mark.index]
+}
+
+func (dp *docParser) next() (yaml_event_t, error) {
+	event := yaml_event_t{}
+	if !yaml_parser_parse(&dp.parser, &event) {
+		return event, fmt.Errorf("line %d: %s", dp.parser.problem_mark.line+1,
+			dp.parser.problem)
+	}
+
+	return event, nil
+}
+
+// parseNode builds the node that starts with the specified event.
+func (dp *docParser) parseNode(src []byte, event yaml_event_t) (*DocNode,
+	error) {
+
+	node := &DocNode{
+		Line:   event.start_mark.line,
+		Column: event.start_mark.column,
+		start:  dp.off(event.start_mark),
+		end:    dp.off(event.end_mark),
+	}
+
+	switch event.typ {
+	case yaml_SCALAR_EVENT:
+		node.Kind = DOC_NODE_SCALAR
+		node.Value = string(event.value)
+		node.Plain = event.scalar_style() == yaml_PLAIN_SCALAR_STYLE
+		return node, nil
+
+	case yaml_MAPPING_START_EVENT:
+		node.Kind = DOC_NODE_MAPPING
+		node.Flow = event.mapping_style() == yaml_FLOW_MAPPING_STYLE
+
+	case yaml_SEQUENCE_START_EVENT:
+		node.Kind = DOC_NODE_SEQUENCE
+		node.Flow = event.sequence_style() == yaml_FLOW_SEQUENCE_STYLE
+
+	case yaml_ALIAS_EVENT:
+		return nil, fmt.Errorf("line %d: aliases are not supported",
+			event.start_mark.line+1)
+
+	default:
+		return nil, fmt.Errorf("line %d: unexpected event: %s",
+			event.start_mark.line+1, constNames[event.typ])
+	}
+
+	for {
+		event, err := dp.next()
+		if err != nil {
+			return nil, err
+		}
+
+		if event.typ == yaml_MAPPING_END_EVENT ||
+			event.typ == yaml_SEQUENCE_END_EVENT {
+
+			if node.Flow {
+				node.end = dp.off(event.end_mark)
+			}
+			return node, nil
+		}
+
+		child, err := dp.parseNode(src, event)
+		if err != nil {
+			return nil, err
+		}
+
+		if node.Kind == DOC_NODE_SEQUENCE {
+			node.Items = append(node.Items, child)
+			node.end = child.end
+			continue
+		}
+
+		if child.Kind != DOC_NODE_SCALAR {
+			return nil, fmt.Errorf("line %d: mapping key is not a scalar",
+				child.Line+1)
+		}
+
+		event, err = dp.next()
+		if err != nil {
+			return nil, err
+		}
+		val, err := dp.parseNode(src, event)
+		if err != nil {
+			return nil, err
+		}
+
+		// An empty value is reported at the position of the following
+		// token.  Relocate it to just after the key's colon.
+		if val.Kind == DOC_NODE_SCALAR && val.start == val.end {
+			colon := child.end
+			for colon < len(src) && src[colon] != ':' {
+				colon++
+			}
+			if colon < len(src) {
+				colon++
+			}
+			val.start = colon
+			val.end = colon
+			val.Line = child.Line
+		}
+
+		node.Keys = append(node.Keys, child)
+		node.Vals = append(node.Vals, val)
+		node.end = val.end
+		if node.end < child.end {
+			node.end = child.end
+		}
+	}
+}
+
+func parseDocNodes(src []byte) (*DocNode, error) {
+	dp := &docParser{}
+	for i, _ := range string(src) {
+		dp.offs = append(dp.offs, i)
+	}
+	dp.offs = append(dp.offs, len(src))
+
+	yaml_parser_initialize(&dp.parser)
+	yaml_parser_set_input_string(&dp.parser, src)
+
+	for {
+		event, err := dp.next()
+		if err != nil {
+			return nil, err
+		}
+
+		switch event.typ {
+		case yaml_STREAM_END_EVENT, yaml_DOCUMENT_END_EVENT:
+			// Empty document.
+			return &DocNode{Kind: DOC_NODE_MAPPING}, nil
+
+		case yaml_SCALAR_EVENT, yaml_MAPPING_START_EVENT,
+			yaml_SEQUENCE_START_EVENT, yaml_ALIAS_EVENT:
+
+			// Only the first document in the stream is considered.
+			node, err := dp.parseNode(src, event)
+			if err != nil {
+				return nil, err
+			}
+			if node.Kind != DOC_NODE_MAPPING {
+				return nil, errors.New("top-level node is not a mapping")
+			}
+
+			// Make sure nothing follows the top-level node in the document.
+			if err := dp.parseDocEnd(); err != nil {
+				return nil, err
+			}
+			return node, nil
+		}
+	}
+}
+
+// parseDocEnd consumes the remaining events in the stream.  It fails if the
+// document contains anything other than its top-level node, or if the rest of
+// the stream is malformed.
+func (dp *docParser) parseDocEnd() error {
+	event, err := dp.next()
+	if err != nil {
+		return err
+	}
+
+	switch event.typ {
+	case yaml_DOCUMENT_END_EVENT:
+	case yaml_STREAM_END_EVENT:
+		return nil
+	default:
+		return fmt.Errorf("line %d: unexpected content after top-level node",
+			event.start_mark.line+1)
+	}
+
+	for {
+		event, err := dp.next()
+		if err != nil {
+			return err
+		}
+		if event.typ == yaml_STREAM_END_EVENT {
+			return nil
+		}
+	}
+}
+
+// ParseDocument parses the text of a YAML document.  The top-level node must
+// be a mapping.
+func ParseDocument(b []byte) (*Document, error) {
+	root, err := parseDocNodes(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Document{
+		src:  append([]byte{}, b...),
+		root: root,
+	}, nil
+}
+
+// Bytes returns the text of the document.
+func (d *Document) Bytes() []byte {
+	return d.src
+}
+
+// Root returns the document's top-level mapping.
+func (d *Document) Root() *DocNode {
+	return d.root
+}
+
+// Keys returns the document's top-level keys in the order they appear.
+func (d *Document) Keys() []string {
+	keys := make([]string, len(d.root.Keys))
+	for i, k := range d.root.Keys {
+		keys[i] = k.Value
+	}
+
+	return keys
+}
+
+// Index returns the position of the specified key in a mapping node, or -1 if
+// the node is not a mapping or does not contain the key.
+func (node *DocNode) Index(key string) int {
+	for i, k := range node.Keys {
+		if k.Value == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Decode converts the node to the same representation that Unmarshal
+// produces.
+func (node *DocNode) Decode() interface{} {
+	switch node.Kind {
+	case DOC_NODE_MAPPING:
+		m := map[interface{}]interface{}{}
+		for i, k := range node.Keys {
+			m[k.Value] = node.Vals[i].Decode()
+		}
+		return m
+
+	case DOC_NODE_SEQUENCE:
+		s := make([]interface{}, len(node.Items))
+		for i, item := range node.Items {
+			s[i] = item.Decode()
+		}
+		return s
+
+	default:
+		return genValue(node.Value)
+	}
+}
+
+// Get retrieves the node at the specified path of mapping keys.  It returns
+// nil if there is no such node.
+func (d *Document) Get(path ...string) *DocNode {
+	node := d.root
+	for _, key := range path {
+		idx := node.Index(key)
+		if idx < 0 {
+			return nil
+		}
+		node = node.Vals[idx]
+	}
+
+	return node
+}
+
+// splice replaces the specified range of the document's text and reparses
+// the result.  The document is left unchanged if the new text doesn't parse.
+func (d *Document) splice(start int, end int, text string) error {
+	src := make([]byte, 0, len(d.src)-(end-start)+len(text))
+	src = append(src, d.src[:start]...)
+	src = append(src, text...)
+	src = append(src, d.src[end:]...)
+
+	root, err := parseDocNodes(src)
+	if err != nil {
+		return fmt.Errorf("edit produced invalid YAML: %s", err.Error())
+	}
+
+	d.src = src
+	d.root = root
+	return nil
+}
+
+func (d *Document) lineStart(pos int) int {
+	for pos > 0 && d.src[pos-1] != '\n' {
+		pos--
+	}
+	return pos
+}
+
+func (d *Document) lineEnd(pos int) int {
+	if pos > 0 && d.src[pos-1] == '\n' {
+		return pos
+	}
+	for pos < len(d.src) && d.src[pos] != '\n' {
+		pos++
+	}
+	if pos < len(d.src) {
+		pos++
+	}
+	return pos
+}
+
+// entryRange calculates the text range occupied by a block mapping entry:
+// from the start of the key's line to the end of the value's last line.
+func (d *Document) entryRange(m *DocNode, idx int) (int, int) {
+	end := m.Vals[idx].end
+	if end < m.Keys[idx].end {
+		end = m.Keys[idx].end
+	}
+
+	return d.lineStart(m.Keys[idx].start), d.lineEnd(end)
+}
+
+// scalarText produces the YAML text of a scalar.  Empty values are written as
+// nulls, which newt reads as empty strings.
+func scalarText(val interface{}) string {
+	if val == nil {
+		return ""
+	}
+
+	return EscapeString(fmt.Sprintf("%v", val))
+}
+
+func isScalar(val interface{}) bool {
+	switch val.(type) {
+	case []interface{}, []string,
+		map[interface{}]interface{}, map[string]interface{}:
+
+		return false
+	default:
+		return true
+	}
+}
+
+func toItfSlice(val interface{}) ([]interface{}, bool) {
+	switch t := val.(type) {
+	case []interface{}:
+		return t, true
+
+	case []string:
+		s := make([]interface{}, len(t))
+		for i, v := range t {
+			s[i] = v
+		}
+		return s, true
+
+	default:
+		return nil, false
+	}
+}
+
+func toItfMap(val interface{}) (map[interface{}]interface{}, bool) {
+	switch t := val.(type) {
+	case map[interface{}]interface{}:
+		return t, true
+
+	case map[string]interface{}:
+		m := make(map[interface{}]interface{}, len(t))
+		for k, v := range t {
+			m[k] = v
+		}
+		return m, true
+
+	default:
+		return nil, false
+	}
+}
+
+// renderValue produces the block YAML text of a value that follows a
+// mapping key or sequence dash at the specified indentation.
+func renderValue(val interface{}, indent int) string {
+	if m, ok := toItfMap(val); ok {
+		s := "\n"
+		for _, k := range sortedKeys(m) {
+			s += renderEntry(EscapeString(k), m[k], indent+4)
+		}
+		return s
+	}
+
+	if seq, ok := toItfSlice(val); ok {
+		s := "\n"
+		for _, elem := range seq {
+			s += fmt.Sprintf("%*s-", indent+4, "")
+			s += renderValue(elem, indent+4)
+		}
+		return s
+	}
+
+	text := scalarText(val)
+	if text == "" {
+		return "\n"
+	}
+	return " " + text + "\n"
+}
+
+// renderEntry produces the block YAML text of a mapping entry indented by the
+// specified number of spaces.
+func renderEntry(key string, val interface{}, indent int) string {
+	return fmt.Sprintf("%*s%s:", indent, "", key) + renderValue(val, indent)
+}
+
+// normalize converts a decoded YAML value to a canonical form for comparison:
+// map keys and scalars become strings.
+func normalize(v interface{}) interface{} {
+	if m, ok := toItfMap(v); ok {
+		n := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			n[fmt.Sprintf("%v", k)] = normalize(v)
+		}
+		return n
+	}
+
+	if seq, ok := toItfSlice(v); ok {
+		s := make([]interface{}, len(seq))
+		for i, v := range seq {
+			s[i] = normalize(v)
+		}
+		return s
+	}
+
+	switch t := v.(type) {
+	case nil:
+		return ""
+
+	default:
+		return fmt.Sprintf("%v", t)
+	}
+}
+
+// ValuesEqual indicates whether two decoded YAML values are equivalent.
+// Scalars are compared by their string representations.
+func ValuesEqual(a interface{}, b interface{}) bool {
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+func sortedKeys(m map[interface{}]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k, _ := range m {
+		keys = append(keys, fmt.Sprintf("%v", k))
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// nest wraps a value in a chain of single-entry mappings.
+func nest(path []string, val interface{}) interface{} {
+	for i := len(path) - 1; i >= 0; i-- {
+		val = map[interface{}]interface{}{path[i]: val}
+	}
+	return val
+}
+
+// setIn applies a change to a decoded value.
+func setIn(cur interface{}, path []string, val interface{}) interface{} {
+	if len(path) == 0 {
+		return val
+	}
+
+	m, ok := toItfMap(cur)
+	if !ok {
+		return nest(path, val)
+	}
+
+	n := make(map[interface{}]interface{}, len(m)+1)
+	for k, v := range m {
+		n[k] = v
+	}
+	n[path[0]] = setIn(m[path[0]], path[1:], val)
+
+	return n
+}
+
+// flowAncestor finds the shortest prefix of the specified path that refers to
+// a flow collection.  It returns -1 if the path doesn't traverse one.
+func (d *Document) flowAncestor(path []string) int {
+	node := d.root
+	for i, key := range path {
+		if node.Flow {
+			return i
+		}
+		idx := node.Index(key)
+		if idx < 0 {
+			return -1
+		}
+		node = node.Vals[idx]
+	}
+
+	return -1
+}
+
+// Set assigns a value to the entry at the specified path of mapping keys,
+// creating the entry and any missing parent mappings as necessary.  If the
+// entry already has an equivalent value, the document is left untouched.  A
+// map value is applied key by key, so only the differing entries of an
+// existing mapping get rewritten.
+func (d *Document) Set(path []string, val interface{}) error {
+	if len(path) == 0 {
+		return errors.New("empty YAML path")
+	}
+
+	// Edits inside a flow collection rewrite the whole collection.
+	if i := d.flowAncestor(path); i == 0 {
+		return d.setRoot(setIn(d.root.Decode(), path, val))
+	} else if i > 0 {
+		cur := d.Get(path[:i]...).Decode()
+		return d.Set(path[:i], setIn(cur, path[i:], val))
+	}
+
+	// Find the deepest existing mapping along the path.
+	parent := d.root
+	depth := 0
+	for depth < len(path)-1 {
+		idx := parent.Index(path[depth])
+		if idx < 0 || parent.Vals[idx].Kind != DOC_NODE_MAPPING {
+			break
+		}
+		parent = parent.Vals[idx]
+		depth++
+	}
+
+	key := path[depth]
+	idx := parent.Index(key)
+
+	if idx < 0 {
+		return d.insert(parent, key, nest(path[depth+1:], val))
+	}
+
+	if depth < len(path)-1 {
+		// The entry exists but isn't a mapping; replace it.
+		old := parent.Vals[idx].Decode()
+		return d.replace(parent, idx, setIn(old, path[depth+1:], val))
+	}
+
+	old := parent.Vals[idx]
+	if ValuesEqual(old.Decode(), val) {
+		return nil
+	}
+
+	// Update an existing block mapping entry by entry.
+	if m, ok := toItfMap(val); ok && len(m) > 0 &&
+		old.Kind == DOC_NODE_MAPPING && !old.Flow {
+
+		for _, k := range sortedKeys(m) {
+			sub := append(append([]string{}, path...), k)
+			if err := d.Set(sub, m[k]); err != nil {
+				return err
+			}
+		}
+		for _, k := range old.Keys {
+			if _, ok := m[k.Value]; !ok {
+				sub := append(append([]string{}, path...), k.Value)
+				if err := d.Delete(sub...); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	// Replace a simple scalar in place; this preserves any trailing comment.
+	if isScalar(val) && old.Kind == DOC_NODE_SCALAR &&
+		!strings.ContainsAny(string(d.src[old.start:old.end]), "\n") {
+
+		start := old.start
+		text := scalarText(val)
+		if old.start == old.end {
+			text = " " + text
+		} else if text == "" {
+			// Remove the space that preceded the old value.
+			for start > 0 && d.src[start-1] == ' ' {
+				start--
+			}
+		}
+		return d.splice(start, old.end, text)
+	}
+
+	return d.replace(parent, idx, val)
+}
+
+// setRoot rewrites the top-level flow mapping in block style.
+func (d *Document) setRoot(val interface{}) error {
+	m, ok := toItfMap(val)
+	if !ok {
+		return errors.New("top-level node is not a mapping")
+	}
+
+	text := ""
+	for _, k := range sortedKeys(m) {
+		text += renderEntry(EscapeString(k), m[k], 0)
+	}
+	if text == "" {
+		text = "{}"
+	}
+
+	return d.splice(d.root.start, d.root.end, strings.TrimSuffix(text, "\n"))
+}
+
+// replace rewrites an entire mapping entry.
+func (d *Document) replace(m *DocNode, idx int, val interface{}) error {
+	start, end := d.entryRange(m, idx)
+	key := string(d.src[m.Keys[idx].start:m.Keys[idx].end])
+
+	return d.splice(start, end, renderEntry(key, val, m.Keys[idx].Column))
+}
+
+// insert adds a new entry to the end of a block mapping.
+func (d *Document) insert(m *DocNode, key string, val interface{}) error {
+	pos := len(d.src)
+	indent := 0
+	if len(m.Keys) > 0 {
+		_, pos = d.entryRange(m, len(m.Keys)-1)
+		indent = m.Keys[0].Column
+	}
+
+	text := renderEntry(EscapeString(key), val, indent)
+	if pos > 0 && d.src[pos-1] != '\n' {
+		text = "\n" + text
+	}
+
+	return d.splice(pos, pos, text)
+}
+
+// Delete removes the entry at the specified path of mapping keys.  Deleting
+// a nonexistent entry is not an error.
+func (d *Document) Delete(path ...string) error {
+	if len(path) == 0 {
+		return errors.New("empty YAML path")
+	}
+
+	parent := d.Get(path[:len(path)-1]...)
+	if parent == nil || parent.Kind != DOC_NODE_MAPPING {
+		return nil
+	}
+
+	idx := parent.Index(path[len(path)-1])
+	if idx < 0 {
+		return nil
+	}
+
+	if parent.Flow {
+		m := parent.Decode().(map[interface{}]interface{})
+		delete(m, path[len(path)-1])
+		if len(path) == 1 {
+			return d.setRoot(m)
+		}
+		return d.Set(path[:len(path)-1], m)
+	}
+
+	start, end := d.entryRange(parent, idx)
+	return d.splice(start, end, "")
+}
+
+// Sync makes the document's top-level entries match the specified settings.
+// Changed entries are rewritten, new ones are appended, and entries absent
+// from the settings are removed.  Keyword entries (those starting with "$")
+// and entries with null values are never removed.
+func (d *Document) Sync(settings map[string]interface{}) error {
+	keys := make([]string, 0, len(settings))
+	for k, _ := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if err := d.Set([]string{k}, settings[k]); err != nil {
+			return err
+		}
+	}
+
+	for _, k := range d.Keys() {
+		if _, ok := settings[k]; ok || strings.HasPrefix(k, "$") {
+			continue
+		}
+
+		val := d.Get(k)
+		if val.Kind == DOC_NODE_SCALAR && val.Plain && val.Value == "" {
+			continue
+		}
+
+		if err := d.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}